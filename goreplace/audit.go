@@ -0,0 +1,64 @@
+package goreplace
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditLog is an append-only log of the changed files (--audit-log),
+// it is safe to record results of multiple workers at the same time
+type AuditLog struct {
+	mutex sync.Mutex
+	file  *os.File
+
+	// now returns the timestamp of an entry, replaced in tests
+	now func() time.Time
+}
+
+// OpenAuditLog opens filename for appending, it is created if it doesn't exist
+func OpenAuditLog(filename string) (*AuditLog, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditLog{file: file, now: time.Now}, nil
+}
+
+// Record appends one line per replaced search term of a changed file as
+// "timestamp path search->replace count", other results are ignored
+func (l *AuditLog) Record(result ChangeResult) error {
+	if !result.Changed || result.Error != nil {
+		return nil
+	}
+
+	timestamp := l.now().Format(time.RFC3339)
+
+	var entries []string
+	for _, change := range result.Changes {
+		entries = append(entries, fmt.Sprintf("%s %s %q->%q %d\n", timestamp, result.File.Path, change.Search, change.Replace, change.Count))
+	}
+
+	// no search terms, eg. in --mode=template
+	if len(entries) == 0 {
+		entries = append(entries, fmt.Sprintf("%s %s - %d\n", timestamp, result.File.Path, result.Replacements))
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, entry := range entries {
+		if _, err := l.file.WriteString(entry); err != nil {
+			return fmt.Errorf("Can't write audit log %s: %s", l.file.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the audit log
+func (l *AuditLog) Close() error {
+	return l.file.Close()
+}
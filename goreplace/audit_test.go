@@ -0,0 +1,72 @@
+package goreplace
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fileitems []FileItem
+	for i := 0; i < 20; i++ {
+		path := writeTestFile(t, dir, fmt.Sprintf("file%02d.txt", i), "foo bar\nfoo\n")
+		fileitems = append(fileitems, FileItem{path, path})
+	}
+	unchanged := writeTestFile(t, dir, "unchanged.txt", "other\n")
+	fileitems = append(fileitems, FileItem{unchanged, unchanged})
+
+	auditLog, err := OpenAuditLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog.now = func() time.Time {
+		return time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:      []string{"foo", "bar"},
+		Replace:     []string{"baz", "qux"},
+		ThreadCount: 4,
+	})
+	r.AuditLog = auditLog
+
+	if _, err := r.ProcessFiles(context.Background(), changesets, fileitems); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content := readTestFile(t, filepath.Join(dir, "audit.log"))
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if len(lines) != 40 {
+		t.Fatalf("expected two entries for each of the 20 changed files, got %d:\n%s", len(lines), content)
+	}
+
+	for _, fileitem := range fileitems[:20] {
+		expected := []string{
+			fmt.Sprintf("2017-01-02T03:04:05Z %s \"foo\"->\"baz\" 2", fileitem.Path),
+			fmt.Sprintf("2017-01-02T03:04:05Z %s \"bar\"->\"qux\" 1", fileitem.Path),
+		}
+		for _, entry := range expected {
+			if !strings.Contains(content, entry+"\n") {
+				t.Errorf("expected entry %q in audit log", entry)
+			}
+		}
+	}
+
+	if strings.Contains(content, unchanged) {
+		t.Errorf("expected no entry for unchanged file, got:\n%s", content)
+	}
+}
@@ -0,0 +1,105 @@
+package goreplace
+
+import (
+	"regexp/syntax"
+	"strings"
+)
+
+// Strings which are equal with full (and Turkic) case folding, but not with the
+// simple case folding of (?i), eg. "ß" and "ss" or "İ" and "i"
+// The longest string of a group is listed first
+var fullCaseFolding = [][]string{
+	{"ss", "ß"},
+	{"i̇", "İ", "i"},
+	{"ʼn", "ŉ"},
+	{"ffi", "ﬃ"},
+	{"ffl", "ﬄ"},
+	{"ff", "ﬀ"},
+	{"fi", "ﬁ"},
+	{"fl", "ﬂ"},
+	{"st", "ﬅ", "ﬆ"},
+}
+
+// Expand case-insensitive literals of regex to also match their full case folding,
+// the regex is returned unchanged if it contains no such literal
+func fullCaseFoldRegex(regex string) (string, error) {
+	re, err := syntax.Parse(regex, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+
+	if !expandFullCaseFolding(re) {
+		return regex, nil
+	}
+
+	return re.String(), nil
+}
+
+// Replace case-insensitive literals in re and its subexpressions with an
+// alternation of the full case folding variants, returns true if re was changed
+func expandFullCaseFolding(re *syntax.Regexp) bool {
+	changed := false
+	for _, sub := range re.Sub {
+		if expandFullCaseFolding(sub) {
+			changed = true
+		}
+	}
+
+	if re.Op != syntax.OpLiteral || re.Flags&syntax.FoldCase == 0 {
+		return changed
+	}
+
+	literal := func(runes []rune) *syntax.Regexp {
+		return &syntax.Regexp{Op: syntax.OpLiteral, Flags: re.Flags, Rune: runes}
+	}
+
+	var (
+		parts   []*syntax.Regexp
+		pending []rune
+	)
+	for i := 0; i < len(re.Rune); {
+		group, length := fullCaseFoldingAt(re.Rune[i:])
+		if group == nil {
+			pending = append(pending, re.Rune[i])
+			i++
+			continue
+		}
+
+		if len(pending) > 0 {
+			parts = append(parts, literal(pending))
+			pending = nil
+		}
+
+		alternate := &syntax.Regexp{Op: syntax.OpAlternate, Flags: re.Flags}
+		for _, variant := range group {
+			alternate.Sub = append(alternate.Sub, literal([]rune(variant)))
+		}
+		parts = append(parts, alternate)
+		i += length
+	}
+
+	if parts == nil {
+		return changed
+	}
+	if len(pending) > 0 {
+		parts = append(parts, literal(pending))
+	}
+
+	*re = syntax.Regexp{Op: syntax.OpConcat, Flags: re.Flags, Sub: parts}
+	return true
+}
+
+// Group of full case folding variants the runes start with (longest match)
+// and the number of matched runes
+func fullCaseFoldingAt(runes []rune) ([]string, int) {
+	for _, group := range fullCaseFolding {
+		for _, variant := range group {
+			length := len([]rune(variant))
+			if length <= len(runes) && strings.EqualFold(string(runes[:length]), variant) {
+				return group, length
+			}
+		}
+	}
+
+	return nil, 0
+}
@@ -0,0 +1,67 @@
+package goreplace
+
+import (
+	"testing"
+)
+
+func TestBuildSearchTermFullCaseFolding(t *testing.T) {
+	tests := []struct {
+		search  string
+		regex   bool
+		matches []string
+		misses  []string
+	}{
+		{"straße", false, []string{"straße", "STRASSE", "Strasse", "STRAẞE"}, []string{"strase"}},
+		{"STRASSE", false, []string{"straße", "strasse"}, []string{"strae"}},
+		{"istanbul", false, []string{"İstanbul", "ISTANBUL", "i̇stanbul"}, []string{"stanbul"}},
+		{"İstanbul", false, []string{"istanbul", "İSTANBUL", "Istanbul"}, []string{"stanbul"}},
+		{"ǅemal", false, []string{"ǆemal", "Ǆemal"}, nil},
+		{"Ωmega", false, []string{"ωMEGA", "ΩMEGA"}, nil},
+		{"file", false, []string{"ﬁle", "FILE"}, nil},
+		{"a.c", false, []string{"A.C"}, []string{"abc"}},
+		{"groß(e|es)", true, []string{"GROSSE", "grosses", "Großes"}, []string{"grose"}},
+		{"^stra(ß)e$|foo", true, []string{"STRASSE", "FOO"}, []string{"xstraße"}},
+	}
+
+	for _, test := range tests {
+		r, err := NewReplacer(Options{Regex: test.regex, CaseInsensitive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		term, err := r.BuildSearchTerm(test.search)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, value := range test.matches {
+			if !term.MatchString(value) {
+				t.Errorf("%s: expected %q to match (%s)", test.search, value, term)
+			}
+		}
+		for _, value := range test.misses {
+			if term.MatchString(value) {
+				t.Errorf("%s: expected %q not to match (%s)", test.search, value, term)
+			}
+		}
+	}
+}
+
+func TestBuildSearchTermFullCaseFoldingKeepsGroups(t *testing.T) {
+	r, err := NewReplacer(Options{Regex: true, CaseInsensitive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	term, err := r.BuildSearchTerm(`(?P<street>stra(ss)e) ([0-9]+)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if term.NumSubexp() != 3 || term.SubexpNames()[1] != "street" {
+		t.Errorf("expected groups to be kept, got %s", term)
+	}
+	if result := term.ReplaceAllString("Straße 12", "$3 ${street}"); result != "12 Straße" {
+		t.Errorf("expected %q, got %q", "12 Straße", result)
+	}
+}
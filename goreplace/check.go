@@ -0,0 +1,257 @@
+package goreplace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Match found by CheckFile, column is the 1-based byte position in the line
+type checkMatch struct {
+	Column int
+	Search string
+	Text   string
+}
+
+// Match is a match of a search term reported by --check or --locations,
+// column is the 1-based character (unicode code point) position in the line
+// like SARIF expects it and --locations reports it, tabs are not expanded
+type Match struct {
+	Path   string
+	Line   int
+	Column int
+	Search string
+	Text   string
+}
+
+// Line shown around matches (--context)
+type contextLine struct {
+	Number int
+	Text   string
+}
+
+// CheckFile searches the changesets in file without changing it (--check)
+// and returns the matches as "file:line: match" lines and if any search term matched
+// With --locations the lines are "file:line:column:offset: match", column is the
+// 1-based character (unicode code point) position with tabs expanded by --tab-width
+// and offset is the 0-based byte offset from the start of the file
+func (r *Replacer) CheckFile(fileitem FileItem, changesets []Changeset) (string, bool, error) {
+	output, matches, err := r.checkFile(fileitem, changesets)
+	return output, len(matches) > 0, err
+}
+
+// CheckReader searches the changesets in the content read from in like CheckFile,
+// name is used as path in the report (eg. for stdin)
+func (r *Replacer) CheckReader(in io.Reader, name string, changesets []Changeset) (string, bool, error) {
+	output, matches, err := r.checkReader(name, bufio.NewReader(in), changesets)
+	return output, len(matches) > 0, err
+}
+
+// Searches the changesets in file like CheckFile, returns the report and the matches
+func (r *Replacer) checkFile(fileitem FileItem, changesets []Changeset) (string, []Match, error) {
+	file, err := r.FileSystem.Open(fileitem.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	return r.checkReader(fileitem.Path, bufio.NewReader(file), changesets)
+}
+
+// Searches the changesets in the content of reader like CheckFile, name is used as path in the report
+func (r *Replacer) checkReader(name string, reader *bufio.Reader, changesets []Changeset) (string, []Match, error) {
+	var (
+		report  []string
+		matches []Match
+	)
+
+	// --context, lines before the next match and number of lines still
+	// to report after the last match
+	var (
+		before       []contextLine
+		after        int
+		lastReported int
+	)
+
+	scanner := r.newCodeScanner()
+	lineNumber := 0
+
+	// byte order mark is not part of the first line, but of the offset
+	lineOffset := len(readByteOrderMark(reader))
+	line, lineEnding, e := readLineWithEnding(reader)
+	for e == nil {
+		lineNumber++
+
+		// line is always scanned to keep state of --lang
+		lineMatches := r.findLineMatches(line, changesets, scanner)
+
+		// --only-lines, --min-indent, --max-indent
+		if !r.opts.lineSelected(lineNumber) || !r.opts.indentSelected(line) {
+			lineMatches = nil
+		}
+
+		if r.opts.Context > 0 {
+			if len(lineMatches) > 0 {
+				// separate groups of lines which are not adjacent
+				first := lineNumber - len(before)
+				if lastReported > 0 && first > lastReported+1 {
+					report = append(report, "--")
+				}
+
+				for _, context := range before {
+					report = append(report, fmt.Sprintf("%s-%d- %s", name, context.Number, context.Text))
+				}
+				before = nil
+				after = r.opts.Context
+				lastReported = lineNumber
+			} else if after > 0 {
+				report = append(report, fmt.Sprintf("%s-%d- %s", name, lineNumber, line))
+				after--
+				lastReported = lineNumber
+			} else {
+				before = append(before, contextLine{lineNumber, line})
+				if len(before) > r.opts.Context {
+					before = before[1:]
+				}
+			}
+		}
+
+		for _, match := range lineMatches {
+			matches = append(matches, Match{name, lineNumber, utf8.RuneCountInString(line[:match.Column-1]) + 1, match.Search, match.Text})
+
+			if r.opts.Locations {
+				// --locations, same column as the match unless tabs are expanded
+				report = append(report, fmt.Sprintf("%s:%d:%d:%d: %s", name, lineNumber, r.displayColumn(line, match.Column), lineOffset+match.Column-1, match.Text))
+			} else {
+				report = append(report, fmt.Sprintf("%s:%d: %s", name, lineNumber, match.Text))
+			}
+		}
+
+		lineOffset += len(line) + len(lineEnding)
+		line, lineEnding, e = readLineWithEnding(reader)
+	}
+
+	if e != io.EOF {
+		return "", nil, e
+	}
+
+	// --distinct
+	if r.opts.Distinct && len(matches) > 0 {
+		report = append(report, fmt.Sprintf("%s: %d matches, %d distinct", name, len(matches), countDistinctMatches(matches)))
+	}
+
+	return strings.Join(report, "\n"), matches, nil
+}
+
+// Number of different matched strings (--distinct)
+func countDistinctMatches(matches []Match) int {
+	distinct := map[string]bool{}
+	for _, match := range matches {
+		distinct[match.Text] = true
+	}
+
+	return len(distinct)
+}
+
+// Checks if any changeset matches in file (--files-with-matches),
+// reading stops at the first match
+func (r *Replacer) fileMatches(fileitem FileItem, changesets []Changeset) (bool, error) {
+	file, err := r.FileSystem.Open(fileitem.Path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	return r.readerMatches(bufio.NewReader(file), changesets)
+}
+
+// Checks if any changeset matches in the content of reader, reading stops at the first match
+func (r *Replacer) readerMatches(reader *bufio.Reader, changesets []Changeset) (bool, error) {
+	scanner := r.newCodeScanner()
+	lineNumber := 0
+
+	readByteOrderMark(reader)
+	line, _, e := readLineWithEnding(reader)
+	for e == nil {
+		lineNumber++
+
+		// line is always scanned to keep state of --lang
+		matches := r.findLineMatches(line, changesets, scanner)
+		if len(matches) > 0 && r.opts.lineSelected(lineNumber) && r.opts.indentSelected(line) {
+			return true, nil
+		}
+
+		line, _, e = readLineWithEnding(reader)
+	}
+
+	if e != io.EOF {
+		return false, e
+	}
+
+	return false, nil
+}
+
+// All matches of the changesets in line, only in the segments selected by --in if --lang is used
+func (r *Replacer) findLineMatches(line string, changesets []Changeset, scanner *codeScanner) []checkMatch {
+	// without --lang the whole line is searched
+	segments := []codeSegment{{r.selectedSegment(), line}}
+	if scanner != nil {
+		segments = scanner.scan(line)
+	}
+
+	var ret []checkMatch
+	for _, changeset := range changesets {
+		// --if-line-matches
+		if !lineConditionMatch(line, changeset) {
+			continue
+		}
+
+		offset := 0
+		for _, segment := range segments {
+			if segment.Kind == r.selectedSegment() {
+				for _, match := range r.findMatches(segment.Text, changeset) {
+					ret = append(ret, checkMatch{offset + match[0] + 1, changeset.SearchPlain, segment.Text[match[0]:match[1]]})
+				}
+			}
+			offset += len(segment.Text)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Column < ret[j].Column
+	})
+
+	return ret
+}
+
+// Character column of a match at the 1-based byte column for --locations,
+// tabs are expanded with --tab-width
+func (r *Replacer) displayColumn(line string, column int) int {
+	ret := 1
+	for _, char := range line[:column-1] {
+		if char == '\t' && r.opts.TabWidth > 0 {
+			// advance to next tab stop
+			ret += r.opts.TabWidth - (ret-1)%r.opts.TabWidth
+		} else {
+			ret++
+		}
+	}
+
+	return ret
+}
+
+// Positions of all matches of the search term in content
+func (r *Replacer) findMatches(content string, changeset Changeset) [][]int {
+	// --invert-match, whole content is reported if it doesn't match
+	if r.opts.InvertMatch {
+		if r.searchMatch(content, changeset) {
+			return [][]int{{0, len(content)}}
+		}
+		return nil
+	}
+
+	return r.tokenMatches(content, changeset.Search.FindAllStringIndex(content, -1))
+}
@@ -0,0 +1,295 @@
+package goreplace
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "this is a testline\nthis is the foobar and foobaz line\n"
+	path := writeTestFile(t, dir, "test.txt", content)
+
+	r, changesets := newTestReplacer(t, Options{
+		Search: []string{"fooba[rz]"},
+		Regex:  true,
+		Check:  true,
+	})
+
+	output, matched, err := r.CheckFile(FileItem{path, path}, changesets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matched {
+		t.Error("expected search term to match")
+	}
+
+	expected := path + ":2: foobar\n" + path + ":2: foobaz"
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+
+	if readTestFile(t, path) != content {
+		t.Error("expected file not to be changed")
+	}
+}
+
+func TestCheckFileNoMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "this is a testline\n")
+
+	r, changesets := newTestReplacer(t, Options{Search: []string{"foobar"}, Check: true})
+
+	output, matched, err := r.CheckFile(FileItem{path, path}, changesets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matched || output != "" {
+		t.Errorf("expected no match, got %q", output)
+	}
+}
+
+func TestCheckFileLocations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "foobar line\r\nthe foobar and foobar\n\n  foobar")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:    []string{"foobar"},
+		Locations: true,
+	})
+
+	output, _, err := r.CheckFile(FileItem{path, path}, changesets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		path + ":1:1:0: foobar",
+		path + ":2:5:17: foobar",
+		path + ":2:16:28: foobar",
+		path + ":4:3:38: foobar",
+	}, "\n")
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestCheckFileDistinct(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "foobar and foobaz\nfoobar\nfoobar foobar\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:   []string{"fooba[rz]"},
+		Regex:    true,
+		Check:    true,
+		Distinct: true,
+	})
+
+	output, _, err := r.CheckFile(FileItem{path, path}, changesets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(output, "\n")
+	expected := path + ": 5 matches, 2 distinct"
+	if len(lines) != 6 || lines[5] != expected {
+		t.Errorf("expected last line %q, got %q", expected, output)
+	}
+}
+
+func TestCheckFileLocationsTabWidth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "\tfoobar\nab\tfoobar\n\t\tfoobar\n")
+
+	tests := []struct {
+		tabWidth int
+		expected []string
+	}{
+		{0, []string{":1:2:1: foobar", ":2:4:11: foobar", ":3:3:20: foobar"}},
+		{4, []string{":1:5:1: foobar", ":2:5:11: foobar", ":3:9:20: foobar"}},
+		{8, []string{":1:9:1: foobar", ":2:9:11: foobar", ":3:17:20: foobar"}},
+	}
+
+	for _, test := range tests {
+		r, changesets := newTestReplacer(t, Options{
+			Search:    []string{"foobar"},
+			Locations: true,
+			TabWidth:  test.tabWidth,
+		})
+
+		output, _, err := r.CheckFile(FileItem{path, path}, changesets)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := path + strings.Join(test.expected, "\n"+path)
+		if output != expected {
+			t.Errorf("--tab-width=%d: expected %q, got %q", test.tabWidth, expected, output)
+		}
+	}
+}
+
+func TestCheckFileContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lines := []string{"a", "b", "foo 3", "d", "e", "f", "g", "foo 8", "i", "foo 10", "k"}
+	path := writeTestFile(t, dir, "test.txt", strings.Join(lines, "\n")+"\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foo"},
+		Check:   true,
+		Context: 1,
+	})
+
+	output, matched, err := r.CheckFile(FileItem{path, path}, changesets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matched {
+		t.Error("expected search term to match")
+	}
+
+	expected := strings.Join([]string{
+		path + "-2- b",
+		path + ":3: foo",
+		path + "-4- d",
+		"--",
+		path + "-7- g",
+		path + ":8: foo",
+		path + "-9- i",
+		path + ":10: foo",
+		path + "-11- k",
+	}, "\n")
+	if output != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, output)
+	}
+}
+
+func TestProcessFilesFilesWithMatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	matching := writeTestFile(t, dir, "a.txt", "foobar\nfoobar\n")
+	other := writeTestFile(t, dir, "b.txt", "barfoo\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:           []string{"foobar"},
+		FilesWithMatches: true,
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{matching, matching}, {other, other}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+		if result.Matched {
+			paths = append(paths, result.Output)
+		}
+	}
+
+	if strings.Join(paths, "\n") != matching {
+		t.Errorf("expected only %s, got %v", matching, paths)
+	}
+
+	if readTestFile(t, matching) != "foobar\nfoobar\n" {
+		t.Error("expected file not to be changed")
+	}
+}
+
+func TestCheckFileColumns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// "ä" has two bytes, the match starts at byte 4 and character 3
+	path := writeTestFile(t, dir, "test.txt", "ä\tfoobar\n")
+
+	for tabWidth, column := range map[int]int{0: 3, 4: 5, 8: 9} {
+		r, changesets := newTestReplacer(t, Options{
+			Search:    []string{"foobar"},
+			Locations: true,
+			TabWidth:  tabWidth,
+		})
+
+		result := r.processFile(FileItem{path, path}, changesets)
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+
+		// --locations reports characters, tabs are expanded with --tab-width
+		if expected := fmt.Sprintf("%s:1:%d:3: foobar", path, column); result.Output != expected {
+			t.Errorf("--tab-width=%d: expected %q, got %q", tabWidth, expected, result.Output)
+		}
+
+		// SARIF reports unicode code points independent of --tab-width
+		if len(result.Matches) != 1 || result.Matches[0].Column != 3 {
+			t.Errorf("--tab-width=%d: expected match in column 3, got %+v", tabWidth, result.Matches)
+		}
+	}
+}
+
+func TestDisplayColumn(t *testing.T) {
+	tests := []struct {
+		line     string
+		column   int // byte column
+		tabWidth int
+		expected int
+	}{
+		{"éé\tfoo", 6, 4, 5},
+		{"éé\tfoo", 6, 8, 9},
+		{"éé\tfoo", 6, 0, 4},
+		{"\t\tfoo", 3, 4, 9},
+		{"日本foo", 7, 0, 3},
+		{"foo", 1, 4, 1},
+	}
+
+	for _, test := range tests {
+		r, _ := newTestReplacer(t, Options{Search: []string{"foo"}, Locations: true, TabWidth: test.tabWidth})
+		if column := r.displayColumn(test.line, test.column); column != test.expected {
+			t.Errorf("%q at byte %d, --tab-width=%d: expected column %d, got %d", test.line, test.column, test.tabWidth, test.expected, column)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package goreplace
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Numbers accepted as operands of --compute
+var computeNumber = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+var errDivisionByZero = errors.New("division by zero")
+
+// Recursive descent parser for the arithmetic expression of --compute
+// (+, -, *, /, %, parentheses, numbers and group references $1, ${1}, ${name})
+type computeParser struct {
+	expr  string
+	pos   int
+	group func(name string) (string, error)
+}
+
+// Evaluate expression, group returns the text of the referenced group
+func evalCompute(expr string, group func(name string) (string, error)) (float64, error) {
+	p := &computeParser{expr: expr, group: group}
+
+	ret, err := p.parseExpr()
+	if err != nil {
+		return 0, err
+	}
+
+	if p.skipSpace(); p.pos < len(p.expr) {
+		return 0, fmt.Errorf("unexpected \"%s\"", p.expr[p.pos:])
+	}
+
+	return ret, nil
+}
+
+func (p *computeParser) skipSpace() {
+	for p.pos < len(p.expr) && (p.expr[p.pos] == ' ' || p.expr[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// Next operator if it is one of ops, position is moved behind it
+func (p *computeParser) operator(ops string) byte {
+	if p.skipSpace(); p.pos < len(p.expr) && strings.IndexByte(ops, p.expr[p.pos]) >= 0 {
+		p.pos++
+		return p.expr[p.pos-1]
+	}
+
+	return 0
+}
+
+// expr = term { ("+" | "-") term }
+func (p *computeParser) parseExpr() (float64, error) {
+	ret, err := p.parseTerm()
+	for err == nil {
+		op := p.operator("+-")
+		if op == 0 {
+			break
+		}
+
+		var value float64
+		if value, err = p.parseTerm(); err != nil {
+			break
+		}
+
+		if op == '+' {
+			ret += value
+		} else {
+			ret -= value
+		}
+	}
+
+	return ret, err
+}
+
+// term = factor { ("*" | "/" | "%") factor }
+func (p *computeParser) parseTerm() (float64, error) {
+	ret, err := p.parseFactor()
+	for err == nil {
+		op := p.operator("*/%")
+		if op == 0 {
+			break
+		}
+
+		var value float64
+		if value, err = p.parseFactor(); err != nil {
+			break
+		}
+
+		switch op {
+		case '*':
+			ret *= value
+		case '/':
+			if value == 0 {
+				return 0, errDivisionByZero
+			}
+			ret /= value
+		case '%':
+			// remainder of the division, also for fractional operands (7.5 % 2 is 1.5)
+			if value == 0 {
+				return 0, errDivisionByZero
+			}
+			ret = math.Mod(ret, value)
+		}
+	}
+
+	return ret, err
+}
+
+// factor = ("-" | "+") factor | "(" expr ")" | number | reference
+func (p *computeParser) parseFactor() (float64, error) {
+	switch p.operator("-+($") {
+	case '-':
+		value, err := p.parseFactor()
+		return -value, err
+	case '+':
+		return p.parseFactor()
+	case '(':
+		value, err := p.parseExpr()
+		if err == nil && p.operator(")") == 0 {
+			err = errors.New("missing \")\"")
+		}
+		return value, err
+	case '$':
+		return p.parseReference()
+	}
+
+	start := p.pos
+	for p.pos < len(p.expr) && (p.expr[p.pos] == '.' || ('0' <= p.expr[p.pos] && p.expr[p.pos] <= '9')) {
+		p.pos++
+	}
+
+	return parseComputeNumber(p.expr[start:p.pos])
+}
+
+// reference = "$" name | "${" name "}", the "$" is already consumed
+func (p *computeParser) parseReference() (float64, error) {
+	var name string
+	if p.pos < len(p.expr) && p.expr[p.pos] == '{' {
+		end := strings.IndexByte(p.expr[p.pos:], '}')
+		if end < 0 {
+			return 0, errors.New("missing \"}\"")
+		}
+		name = p.expr[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+	} else {
+		start := p.pos
+		for p.pos < len(p.expr) && isBackrefNameChar(p.expr[p.pos]) {
+			p.pos++
+		}
+		name = p.expr[start:p.pos]
+	}
+
+	text, err := p.group(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseComputeNumber(text)
+}
+
+func parseComputeNumber(text string) (float64, error) {
+	if !computeNumber.MatchString(text) {
+		if text == "" {
+			return 0, errors.New("missing number")
+		}
+		return 0, fmt.Errorf("\"%s\" is not a number", text)
+	}
+
+	return strconv.ParseFloat(text, 64)
+}
+
+// Check syntax and group references of the --compute expression
+func validateCompute(search *regexp.Regexp, expr string) error {
+	if err := validateBackrefs(search, expr); err != nil {
+		return err
+	}
+
+	// all groups are assumed to be 1, the values are only known for each match
+	_, err := evalCompute(expr, func(name string) (string, error) {
+		return "1", nil
+	})
+	if err != nil && err != errDivisionByZero {
+		return fmt.Errorf("Invalid --compute expression \"%s\": %s", expr, err)
+	}
+
+	return nil
+}
+
+// Computed replacement of a match (--compute), the match is kept
+// with a warning if the expression can't be evaluated for it
+func (r *Replacer) computeReplacement(changeset Changeset, content string, match []int, position linePosition) string {
+	value, err := evalCompute(changeset.Replace, func(name string) (string, error) {
+		index := -1
+		if num, err := strconv.Atoi(name); err == nil {
+			index = num
+		} else {
+			for i, groupName := range changeset.Search.SubexpNames() {
+				if groupName == name {
+					index = i
+				}
+			}
+		}
+
+		if index < 0 || 2*index+1 >= len(match) {
+			return "", fmt.Errorf("unknown group \"%s\"", name)
+		} else if match[2*index] < 0 {
+			return "", fmt.Errorf("group \"%s\" did not match", name)
+		}
+
+		return content[match[2*index]:match[2*index+1]], nil
+	})
+
+	if err != nil {
+		r.logWarning(fmt.Sprintf("%s:%d: unable to compute \"%s\": %s, match not changed", position.File, position.Line, changeset.Replace, err))
+		return content[match[0]:match[1]]
+	}
+
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,94 @@
+package goreplace
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEvalCompute(t *testing.T) {
+	groups := map[string]string{"1": "6", "2": "-4", "3": "1.5", "name": "10", "text": "abc"}
+	group := func(name string) (string, error) {
+		return groups[name], nil
+	}
+
+	tests := map[string]float64{
+		"1 + 2 * 3":         7,
+		"(1 + 2) * 3":       9,
+		"${1} * 2 + ${2}":   8,
+		"$1 / 4":            1.5,
+		"$1 % 4":            2,
+		"$3 % 1":            0.5,
+		"7.5 % 2":           1.5,
+		"7 % 0.5":           0,
+		"-7.5 % 2":          -1.5,
+		"-$2 - -1":          5,
+		"${name} * ${3}":    15,
+		" ( $1+$2 ) *2 ":    4,
+		"2 * (3 + (4 - 1))": 12,
+	}
+	for expr, expected := range tests {
+		if value, err := evalCompute(expr, group); err != nil || value != expected {
+			t.Errorf("%q: expected %v, got %v (%v)", expr, expected, value, err)
+		}
+	}
+
+	for _, expr := range []string{"$text + 1", "1 +", "(1 + 2", "1 / (2 - 2)", "$1 % 0", "1 % (1 - 1)", "1 2", "${1"} {
+		if value, err := evalCompute(expr, group); err == nil {
+			t.Errorf("%q: expected error, got %v", expr, value)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileCompute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "size=3x4\nsize=10x2.5\nsize=ax4\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{`(\w+)x([0-9.]+)`},
+		Replace: []string{"${1} * 2 + ${2}"},
+		Regex:   true,
+		Compute: true,
+	})
+
+	var log bytes.Buffer
+	r.Logger = &log
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "size=10\nsize=22.5\nsize=ax4\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+
+	if !strings.Contains(log.String(), ":3: unable to compute") {
+		t.Errorf("expected warning for non-numeric group, got %q", log.String())
+	}
+}
+
+func TestBuildChangesetsInvalidCompute(t *testing.T) {
+	for _, replace := range []string{"$1 +", "$2 * 2"} {
+		r, err := NewReplacer(Options{
+			Search:  []string{`([0-9]+)`},
+			Replace: []string{replace},
+			Regex:   true,
+			Compute: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := r.BuildChangesets(); err == nil {
+			t.Errorf("%q: expected error", replace)
+		}
+	}
+}
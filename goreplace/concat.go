@@ -0,0 +1,205 @@
+package goreplace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Files processed as one document (--concat),
+// matched and replaced are tracked for each file
+type concatDocument struct {
+	contents []string
+	matched  []bool
+	replaced []int
+	changes  [][]ChangeCount
+}
+
+// Offsets of the file boundaries in the joined document,
+// starts[i] is the offset of the first byte of file i
+func (d *concatDocument) starts() []int {
+	ret := make([]int, len(d.contents))
+	offset := 0
+	for i, content := range d.contents {
+		ret[i] = offset
+		offset += len(content)
+	}
+
+	return ret
+}
+
+// File a match starting at offset belongs to, empty files never contain a match
+func (d *concatDocument) fileAt(starts []int, offset int) int {
+	for i := len(d.contents) - 1; i > 0; i-- {
+		if starts[i] <= offset && len(d.contents[i]) > 0 {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// Apply changeset to the joined document and split the result back into the files
+// Matches spanning file boundaries are replaced in the file where they start, the
+// files keep their line structure: the file where the match starts keeps its last
+// line ending and the file where it ends loses the line ending of its first line
+// if nothing of the line is left (it is moved to the first file if that had none)
+func (r *Replacer) applyChangesetToDocument(doc *concatDocument, changeset Changeset) {
+	content := strings.Join(doc.contents, "")
+	starts := doc.starts()
+
+	ret := make([]strings.Builder, len(doc.contents))
+
+	// copy unchanged content between from and to into the files it belongs to
+	copyRange := func(from, to int) {
+		for i, start := range starts {
+			end := start + len(doc.contents[i])
+			if from < end && to > start {
+				ret[i].WriteString(content[maxInt(from, start):minInt(to, end)])
+			}
+		}
+	}
+
+	lastIndex := 0
+	for _, match := range changeset.Search.FindAllStringSubmatchIndex(content, -1) {
+		i := doc.fileAt(starts, match[0])
+		copyRange(lastIndex, match[0])
+
+		if r.opts.RegexBackref {
+			// --regex-backrefs
+			ret[i].Write(changeset.Search.ExpandString(nil, r.replaceTerm(changeset), content, match))
+		} else {
+			ret[i].WriteString(r.replaceTerm(changeset))
+		}
+
+		doc.matched[i] = true
+		doc.replaced[i]++
+		lastIndex = match[1]
+
+		// match spanning file boundaries
+		if end := starts[i] + len(doc.contents[i]); match[1] > end {
+			newline := trailingLineEnding(content[match[0]:end])
+
+			if j := doc.fileAt(starts, match[1]-1); j > i {
+				if ending := leadingLineEnding(content[match[1] : starts[j]+len(doc.contents[j])]); ending != "" {
+					lastIndex += len(ending)
+					if newline == "" {
+						newline = ending
+					}
+				}
+			}
+
+			ret[i].WriteString(newline)
+		}
+	}
+	copyRange(lastIndex, len(content))
+
+	for i := range doc.contents {
+		doc.contents[i] = ret[i].String()
+	}
+}
+
+// Process all files as one document (--concat), files are written after
+// all changesets were applied
+func (r *Replacer) processConcat(ctx context.Context, changesets []Changeset, fileitems []FileItem) ([]ChangeResult, error) {
+	doc := &concatDocument{
+		contents: make([]string, len(fileitems)),
+		matched:  make([]bool, len(fileitems)),
+		replaced: make([]int, len(fileitems)),
+		changes:  make([][]ChangeCount, len(fileitems)),
+	}
+
+	for i, fileitem := range fileitems {
+		content, err := r.readFile(fileitem.Path)
+		if err != nil {
+			return nil, err
+		}
+		doc.contents[i] = string(content)
+	}
+	original := append([]string{}, doc.contents...)
+
+	for _, changeset := range changesets {
+		replaced := append([]int{}, doc.replaced...)
+		r.applyChangesetToDocument(doc, changeset)
+
+		for i := range doc.replaced {
+			if count := doc.replaced[i] - replaced[i]; count > 0 {
+				doc.changes[i] = append(doc.changes[i], ChangeCount{changeset.SearchPlain, changeset.Replace, count})
+			}
+		}
+	}
+
+	var ret []ChangeResult
+	for i, fileitem := range fileitems {
+		if ctx.Err() != nil {
+			break
+		}
+
+		result := ChangeResult{File: fileitem, Matched: doc.matched[i], Replacements: doc.replaced[i], Changes: doc.changes[i]}
+		if doc.contents[i] == original[i] && r.opts.Output == "" && r.opts.OutputStripFileExt == "" {
+			result.Output = fmt.Sprintf("%s no match", fileitem.Path)
+
+			// --copy-unchanged
+			if r.opts.CopyUnchanged {
+				result.Output, result.Error = r.copyUnchangedFile(fileitem)
+			}
+		} else {
+			var buffer bytes.Buffer
+			buffer.WriteString(doc.contents[i])
+
+			result.Output, result.Error = r.writeContentToFile(fileitem, buffer)
+			result.Changed = result.Error == nil
+		}
+		r.recordAudit(&result)
+
+		if r.OnResult != nil {
+			r.OnResult(result)
+		}
+		ret = append(ret, result)
+	}
+
+	// deterministic output order
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].File.Path < ret[j].File.Path
+	})
+
+	return ret, ctx.Err()
+}
+
+// Line ending at the end of content, empty if there is none
+func trailingLineEnding(content string) string {
+	if strings.HasSuffix(content, "\r\n") {
+		return "\r\n"
+	} else if strings.HasSuffix(content, "\n") {
+		return "\n"
+	}
+
+	return ""
+}
+
+// Line ending at the start of content, empty if there is none
+func leadingLineEnding(content string) string {
+	if strings.HasPrefix(content, "\r\n") {
+		return "\r\n"
+	} else if strings.HasPrefix(content, "\n") {
+		return "\n"
+	}
+
+	return ""
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
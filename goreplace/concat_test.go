@@ -0,0 +1,98 @@
+package goreplace
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestProcessFilesConcat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := writeTestFile(t, dir, "part1.txt", "header\nBEGIN foo\n")
+	second := writeTestFile(t, dir, "part2.txt", "foo END\nfooter foo\n")
+	third := writeTestFile(t, dir, "part3.txt", "unchanged\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:       []string{`BEGIN (\w+)\n(\w+) END`, "footer foo"},
+		Replace:      []string{"BLOCK $1+$2", "footer bar"},
+		Regex:        true,
+		RegexBackref: true,
+		Concat:       true,
+	})
+
+	fileitems := []FileItem{{first, first}, {second, second}, {third, third}}
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// match spanning the boundary is written to the file where it starts,
+	// the files keep their line endings
+	expected := map[string]string{
+		first:  "header\nBLOCK foo+foo\n",
+		second: "footer bar\n",
+		third:  "unchanged\n",
+	}
+	for path, content := range expected {
+		if actual := readTestFile(t, path); actual != content {
+			t.Errorf("%s: expected %q, got %q", path, content, actual)
+		}
+	}
+
+	for _, result := range results {
+		if result.Changed != (result.File.Path != third) {
+			t.Errorf("%s: expected changed %v, got %v", result.File.Path, result.File.Path != third, result.Changed)
+		}
+	}
+}
+
+func TestProcessFilesConcatAcrossBoundary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		first, second  string
+		expectedFirst  string
+		expectedSecond string
+	}{
+		// whole lines joined, no empty line is left
+		{"a\nhello\n", "world\nb\n", "a\nX\n", "b\n"},
+		{"hello\r\n", "world\r\n", "X\r\n", ""},
+		// first file without line ending gets the one of the joined line
+		{"hello", "world\n", "X\n", ""},
+		// rest of the line stays in the second file
+		{"hello\n", "world!\n", "X\n", "!\n"},
+	}
+
+	for _, test := range tests {
+		first := writeTestFile(t, dir, "a.txt", test.first)
+		second := writeTestFile(t, dir, "b.txt", test.second)
+
+		r, changesets := newTestReplacer(t, Options{
+			Search:  []string{`hello\r?\n?world`},
+			Replace: []string{"X"},
+			Regex:   true,
+			Concat:  true,
+		})
+
+		if _, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{first, first}, {second, second}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if content := readTestFile(t, first); content != test.expectedFirst {
+			t.Errorf("%q+%q: expected first file %q, got %q", test.first, test.second, test.expectedFirst, content)
+		}
+		if content := readTestFile(t, second); content != test.expectedSecond {
+			t.Errorf("%q+%q: expected second file %q, got %q", test.first, test.second, test.expectedSecond, content)
+		}
+	}
+}
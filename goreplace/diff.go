@@ -0,0 +1,296 @@
+package goreplace
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Unchanged lines shown around changed lines in --diff
+const diffContext = 3
+
+// One line of a diff, kind is ' ' (unchanged), '-' (removed) or '+' (added)
+// a and b are the 0-based line numbers in the original and the replaced content
+type diffOp struct {
+	kind byte
+	text string
+	a, b int
+}
+
+// Split content into lines, line endings are kept
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// Diff lines a and b based on their longest common subsequence,
+// removed lines are listed before added lines
+func diffLines(a, b []string) []diffOp {
+	d := &lineDiff{a: a, b: b}
+	d.compare(0, len(a), 0, len(b))
+
+	var ops []diffOp
+	i, j := 0, 0
+	for _, match := range append(d.matches, [2]int{len(a), len(b)}) {
+		for ; i < match[0]; i++ {
+			ops = append(ops, diffOp{'-', a[i], i, j})
+		}
+		for ; j < match[1]; j++ {
+			ops = append(ops, diffOp{'+', b[j], i, j})
+		}
+		if i < len(a) {
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		}
+	}
+
+	return ops
+}
+
+// Myers' diff algorithm in linear space, the lines are split at the middle
+// snake of the shortest edit script recursively. Memory only grows with the
+// number of lines (not lines of a * lines of b), so large files can be diffed.
+type lineDiff struct {
+	a, b    []string
+	matches [][2]int // indices of equal lines in a and b, in order
+}
+
+// Find equal lines of a[a0:a1] and b[b0:b1]
+func (d *lineDiff) compare(a0, a1, b0, b1 int) {
+	// common prefix and suffix
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.matches = append(d.matches, [2]int{a0, b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-1-suffix] == d.b[b1-1-suffix] {
+		suffix++
+	}
+
+	// only added or removed lines are left otherwise
+	if a0 < a1-suffix && b0 < b1-suffix {
+		x, y, u, v := d.middleSnake(a0, a1-suffix, b0, b1-suffix)
+		d.compare(a0, x, b0, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.matches = append(d.matches, [2]int{x, y})
+		}
+		d.compare(u, a1-suffix, v, b1-suffix)
+	}
+
+	for k := suffix; k > 0; k-- {
+		d.matches = append(d.matches, [2]int{a1 - k, b1 - k})
+	}
+}
+
+// Middle snake of the shortest edit script of a[a0:a1] and b[b0:b1], searched
+// from the start and the end at the same time. Returns start (x, y) and end (u, v)
+// of the snake, the lines between them are equal.
+func (d *lineDiff) middleSnake(a0, a1, b0, b1 int) (int, int, int, int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+
+	// furthest x (forward) and smallest x (backward) on diagonal k = x - y,
+	// indices are offset as backward diagonals are shifted by delta
+	offset := 2*(n+m) + 2
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	forward[offset+1] = 0
+	backward[offset+delta-1] = n
+
+	for D := 0; D <= (n+m+1)/2; D++ {
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			if odd && k >= delta-(D-1) && k <= delta+(D-1) && x >= backward[offset+k] {
+				return a0 + startX, b0 + startY, a0 + x, b0 + y
+			}
+		}
+
+		for c := -D; c <= D; c += 2 {
+			k := c + delta
+			var x int
+			if c == D || (c != -D && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k-1]
+			} else {
+				x = backward[offset+k+1] - 1
+			}
+			y := x - k
+			endX, endY := x, y
+			for x > 0 && y > 0 && d.a[a0+x-1] == d.b[b0+y-1] {
+				x--
+				y--
+			}
+			backward[offset+k] = x
+
+			if !odd && k >= -D && k <= D && x <= forward[offset+k] {
+				return a0 + x, b0 + y, a0 + endX, b0 + endY
+			}
+		}
+	}
+
+	// not reached, the searches always overlap
+	return a0, b0, a0, b0
+}
+
+// Range of a hunk header, start is the line before the hunk if it is empty
+func diffRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	} else if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// Format changes between original and replaced content as unified diff,
+// an empty string is returned if the content is identical
+func formatDiff(fileitem FileItem, original, replaced string) string {
+	return formatUnifiedDiff(fileitem.Path, fileitem.Output, original, replaced)
+}
+
+// Format changes between original and replaced content as unified diff
+// with the file names oldName and newName in the header
+func formatUnifiedDiff(oldName, newName, original, replaced string) string {
+	ops := diffLines(splitLines(original), splitLines(replaced))
+
+	var buffer bytes.Buffer
+	for start := 0; start < len(ops); {
+		// next changed line
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+
+		// changes close to each other are shown in one hunk
+		last := first
+		for k := first + 1; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				if k-last-1 > 2*diffContext {
+					break
+				}
+				last = k
+			}
+		}
+
+		from := maxInt(first-diffContext, start)
+		to := minInt(last+diffContext+1, len(ops))
+
+		countA, countB := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+
+		if buffer.Len() == 0 {
+			buffer.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+		}
+		buffer.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", diffRange(ops[from].a, countA), diffRange(ops[from].b, countB)))
+		for _, op := range ops[from:to] {
+			buffer.WriteString(string(op.kind) + op.text)
+			if !strings.HasSuffix(op.text, "\n") {
+				buffer.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = to
+	}
+
+	return buffer.String()
+}
+
+// Diff of the file on disk and the content which would be written (--diff)
+func (r *Replacer) diffFile(fileitem FileItem, content bytes.Buffer) (string, error) {
+	original, err := r.readFile(fileitem.Path)
+	if err != nil {
+		return "", err
+	}
+
+	return formatDiff(fileitem, string(original), content.String()), nil
+}
+
+// Path of a file in --patch-file, relative to the working directory with / as separator
+func patchPath(path string) string {
+	if filepath.IsAbs(path) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil {
+				path = rel
+			}
+		}
+	}
+
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// Record the diff of the file on disk and the content which would be written
+// with a/ and b/ path prefixes for --patch-file
+func (r *Replacer) recordPatch(fileitem FileItem, content bytes.Buffer) error {
+	original, err := r.readFile(fileitem.Path)
+	if err != nil {
+		return err
+	}
+
+	patch := formatUnifiedDiff("a/"+patchPath(fileitem.Path), "b/"+patchPath(fileitem.Output), string(original), content.String())
+	if patch == "" {
+		return nil
+	}
+
+	r.patchesMutex.Lock()
+	defer r.patchesMutex.Unlock()
+
+	if r.patches == nil {
+		r.patches = map[string]string{}
+	}
+	r.patches[fileitem.Output] = patch
+
+	return nil
+}
+
+// WritePatchFile writes the diffs of all processed files as one patch to
+// --patch-file (--dry-run), it can be applied with git apply or patch -p1
+func (r *Replacer) WritePatchFile() error {
+	r.patchesMutex.Lock()
+	defer r.patchesMutex.Unlock()
+
+	paths := make([]string, 0, len(r.patches))
+	for path := range r.patches {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buffer bytes.Buffer
+	for _, path := range paths {
+		buffer.WriteString(r.patches[path])
+	}
+
+	return writeFileAtomic(r.opts.PatchFile, buffer.Bytes(), 0644)
+}
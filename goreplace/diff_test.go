@@ -0,0 +1,164 @@
+package goreplace
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatDiff(t *testing.T) {
+	fileitem := FileItem{"test.txt", "test.txt"}
+
+	tests := []struct {
+		original string
+		replaced string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n",
+			"1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\nthirteen\n14\n15\n",
+			"--- test.txt\n+++ test.txt\n" +
+				"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+				"@@ -10,6 +10,6 @@\n 10\n 11\n 12\n-13\n+thirteen\n 14\n 15\n",
+		},
+		{
+			"a\nb\nc\n",
+			"a\nc\n",
+			"--- test.txt\n+++ test.txt\n@@ -1,3 +1,2 @@\n a\n-b\n c\n",
+		},
+		{
+			"a",
+			"b",
+			"--- test.txt\n+++ test.txt\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			"",
+			"a\n",
+			"--- test.txt\n+++ test.txt\n@@ -0,0 +1 @@\n+a\n",
+		},
+	}
+
+	for _, test := range tests {
+		if diff := formatDiff(fileitem, test.original, test.replaced); diff != test.expected {
+			t.Errorf("diff of %q and %q: expected\n%s\ngot\n%s", test.original, test.replaced, test.expected, diff)
+		}
+	}
+}
+
+func TestFormatDiffLargeFile(t *testing.T) {
+	// first and last line changed, the lines in between are compared
+	// without a table of all line pairs
+	var original, replaced strings.Builder
+	for i := 1; i <= 20000; i++ {
+		original.WriteString(fmt.Sprintf("line %d\n", i))
+		if i == 1 || i == 20000 {
+			replaced.WriteString(fmt.Sprintf("LINE %d\n", i))
+		} else {
+			replaced.WriteString(fmt.Sprintf("line %d\n", i))
+		}
+	}
+
+	diff := formatDiff(FileItem{"test.txt", "test.txt"}, original.String(), replaced.String())
+	for _, expected := range []string{"@@ -1,4 +1,4 @@\n-line 1\n+LINE 1\n", "@@ -19997,4 +19997,4 @@\n line 19997\n line 19998\n line 19999\n-line 20000\n+LINE 20000\n"} {
+		if !strings.Contains(diff, expected) {
+			t.Errorf("expected %q in diff, got\n%s", expected, diff)
+		}
+	}
+}
+
+func TestProcessFilesDiffInteractingChangesets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// first changeset creates matches of the second one
+	path := writeTestFile(t, dir, "test.txt", "foo\nkeep\nbar\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foo", "bar"},
+		Replace: []string{"bar", "baz"},
+		DryRun:  true,
+		Diff:    true,
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{path, path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "--- " + path + "\n+++ " + path + "\n@@ -1,3 +1,3 @@\n-foo\n+baz\n keep\n-bar\n+baz\n"
+	if results[0].Output != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, results[0].Output)
+	}
+	if content := readTestFile(t, path); content != "foo\nkeep\nbar\n" {
+		t.Errorf("expected file to be untouched, got %q", content)
+	}
+}
+
+func TestWritePatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// paths in the patch are relative to the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.Mkdir("sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "b.txt", "foo\nkeep\n")
+	writeTestFile(t, dir, "sub/a.txt", "keep\nfoo\n")
+	writeTestFile(t, dir, "c.txt", "unchanged\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:    []string{"foo"},
+		Replace:   []string{"bar"},
+		DryRun:    true,
+		PatchFile: "changes.patch",
+	})
+
+	fileitems := []FileItem{{"sub/a.txt", "sub/a.txt"}, {filepath.Join(dir, "b.txt"), filepath.Join(dir, "b.txt")}, {"c.txt", "c.txt"}}
+	if _, err := r.ProcessFiles(context.Background(), changesets, fileitems); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WritePatchFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "--- a/b.txt\n+++ b/b.txt\n@@ -1,2 +1,2 @@\n-foo\n+bar\n keep\n" +
+		"--- a/sub/a.txt\n+++ b/sub/a.txt\n@@ -1,2 +1,2 @@\n keep\n-foo\n+bar\n"
+	if patch := readTestFile(t, "changes.patch"); patch != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, patch)
+	}
+	if content := readTestFile(t, "b.txt"); content != "foo\nkeep\n" {
+		t.Errorf("expected file to be untouched, got %q", content)
+	}
+
+	// patch applies cleanly to the files
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch not available")
+	}
+	if output, err := exec.Command("patch", "-p1", "-i", "changes.patch").CombinedOutput(); err != nil {
+		t.Fatalf("expected patch to apply: %s\n%s", err, output)
+	}
+	if content := readTestFile(t, "sub/a.txt"); content != "keep\nbar\n" {
+		t.Errorf("expected patched content %q, got %q", "keep\nbar\n", content)
+	}
+}
@@ -0,0 +1,675 @@
+package goreplace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Readln returns a single line (without the ending \n)
+// from the input buffered reader.
+// An error is returned iff there is an error with the
+// buffered reader.
+func Readln(r *bufio.Reader) (string, error) {
+	var (
+		isPrefix bool  = true
+		err      error = nil
+		line, ln []byte
+	)
+	for isPrefix && err == nil {
+		line, isPrefix, err = r.ReadLine()
+		ln = append(ln, line...)
+	}
+	return string(ln), err
+}
+
+// Reads a single line from the buffered reader and returns it
+// without and its line ending ("\n", "\r\n" or "" for the last line)
+// An error is returned if there is no more line to read
+func readLineWithEnding(reader *bufio.Reader) (string, string, error) {
+	line, err := reader.ReadString('\n')
+	if line == "" && err != nil {
+		return "", "", err
+	}
+
+	if strings.HasSuffix(line, "\r\n") {
+		return line[:len(line)-2], "\r\n", nil
+	} else if strings.HasSuffix(line, "\n") {
+		return line[:len(line)-1], "\n", nil
+	}
+
+	return line, "", nil
+}
+
+// UTF-8 byte order mark at the start of files, other encodings
+// (eg. UTF-16) aren't decoded so their byte order mark is kept as content
+const byteOrderMark = "\xef\xbb\xbf"
+
+// Read byte order mark from the start of reader,
+// returns an empty string if there is none
+func readByteOrderMark(reader *bufio.Reader) string {
+	if prefix, err := reader.Peek(len(byteOrderMark)); err == nil && string(prefix) == byteOrderMark {
+		reader.Discard(len(byteOrderMark))
+		return byteOrderMark
+	}
+
+	return ""
+}
+
+// Read search terms (one per line, empty lines are ignored) from file
+func readSearchFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var terms []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		term := strings.TrimSuffix(scanner.Text(), "\r")
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms, scanner.Err()
+}
+
+// Header of --ensure-header, value is the name of a file containing the
+// header or the header itself, it always ends with a line ending
+func readHeader(value string) (string, error) {
+	header := value
+	if info, err := os.Stat(value); err == nil && info.Mode().IsRegular() {
+		content, err := ioutil.ReadFile(value)
+		if err != nil {
+			return "", err
+		}
+		header = string(content)
+	}
+
+	header = strings.Replace(header, "\r\n", "\n", -1)
+	if strings.TrimSpace(header) == "" {
+		return "", errors.New("header is empty")
+	}
+	if !strings.HasSuffix(header, "\n") {
+		header += "\n"
+	}
+
+	return header, nil
+}
+
+// Read replacements from map file (one from=to per line)
+func readMapFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ret := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		split := strings.SplitN(line, "=", 2)
+		if len(split) != 2 || split[0] == "" {
+			return nil, fmt.Errorf("Invalid map entry \"%s\" in %s, expected from=to", line, path)
+		}
+		ret[split[0]] = split[1]
+	}
+
+	return ret, scanner.Err()
+}
+
+// renamePlan is the planned rename of a file (--rename)
+type renamePlan struct {
+	newPath  string   // new path of the file, empty if the name is not changed
+	searches []string // search terms which matched in the file name
+	err      error
+}
+
+// Plan rename of file by applying the changesets to its basename (--rename),
+// renamed contains the new paths of all planned renames to detect collisions.
+// Files are planned before any content is written, so a file which can't be
+// renamed is left untouched.
+func (r *Replacer) planRename(file FileItem, changesets []Changeset, renamed map[string]bool) renamePlan {
+	var plan renamePlan
+
+	path := file.Output
+	dir, name := filepath.Split(path)
+
+	newName := name
+	for _, changeset := range changesets {
+		var matchCount int
+		newName, _, matchCount = r.replaceText(newName, changeset, 0, -1, linePosition{File: path})
+
+		// --require-match, matches of the file name count too
+		if matchCount > 0 && !contains(plan.searches, changeset.SearchPlain) {
+			plan.searches = append(plan.searches, changeset.SearchPlain)
+		}
+	}
+
+	// --replace-cmd, file isn't renamed if the command failed
+	if err := r.commandFailure(path); err != nil {
+		plan.err = err
+		return plan
+	}
+
+	if newName == name {
+		return plan
+	}
+
+	if newName == "" || strings.ContainsRune(newName, filepath.Separator) {
+		plan.err = fmt.Errorf("Unable to rename %s: invalid file name \"%s\"", path, newName)
+		return plan
+	}
+
+	newPath := filepath.Join(dir, newName)
+	if _, err := r.FileSystem.Lstat(newPath); err == nil || renamed[newPath] {
+		plan.err = fmt.Errorf("Unable to rename %s to %s: file already exists", path, newPath)
+		return plan
+	}
+
+	// --dry-run
+	if !r.opts.DryRun {
+		if err := r.checkRoot(path); err != nil {
+			plan.err = err
+			return plan
+		}
+	}
+
+	renamed[newPath] = true
+	plan.newPath = newPath
+	return plan
+}
+
+// Rename file to the new path of its plan (--rename)
+func (r *Replacer) renameFile(result *ChangeResult, plan renamePlan) {
+	if len(plan.searches) > 0 {
+		result.Matched = true
+		for _, search := range plan.searches {
+			if !contains(result.Searches, search) {
+				result.Searches = append(result.Searches, search)
+			}
+		}
+	}
+
+	if plan.newPath == "" {
+		return
+	}
+
+	path := result.File.Output
+
+	// --dry-run
+	if !r.opts.DryRun {
+		if err := r.FileSystem.Rename(path, plan.newPath); err != nil {
+			result.Error = err
+			return
+		}
+	}
+
+	result.Changed = true
+	result.Renamed = plan.newPath
+	r.logMessage(fmt.Sprintf("Renamed %s to %s", path, plan.newPath))
+}
+
+// Write content to file
+func (r *Replacer) writeContentToFile(fileitem FileItem, content bytes.Buffer) (string, error) {
+	// --dry-run
+	if r.opts.DryRun {
+		r.reportDryRunCreate(fileitem.Output, 0644)
+
+		// --patch-file
+		if r.opts.PatchFile != "" {
+			if err := r.recordPatch(fileitem, content); err != nil {
+				return "", err
+			}
+		}
+
+		// --diff
+		if r.opts.Diff {
+			return r.diffFile(fileitem, content)
+		}
+
+		return content.String(), nil
+	} else {
+		// --root, checked before directories of --output-dir are created
+		if err := r.checkRoot(fileitem.Output); err != nil {
+			return "", err
+		}
+
+		// --output-dir
+		if err := r.createOutputDir(fileitem); err != nil {
+			return "", err
+		}
+
+		// --remove-empty-files
+		if r.opts.RemoveEmptyFiles && isEmptyContent(content.String()) {
+			if err := r.FileSystem.Remove(fileitem.Output); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+
+			return fmt.Sprintf("%s removed, content is empty\n", fileitem.Output), nil
+		}
+
+		// --validate-cmd
+		// original content is restored if validation fails
+		var backup *fileBackup
+		if r.opts.ValidateCmd != "" {
+			var err error
+			if backup, err = r.backupFile(fileitem.Output); err != nil {
+				return "", err
+			}
+		}
+
+		// --retry
+		var err error
+		err = r.writeFileWithRetry(fileitem.Output, content.Bytes(), 0644)
+		if err != nil {
+			return "", err
+		}
+
+		// --validate-cmd
+		if backup != nil {
+			if err := r.validateFile(fileitem.Output, backup); err != nil {
+				return "", err
+			}
+		}
+
+		return fmt.Sprintf("%s found and replaced match\n", fileitem.Path), nil
+	}
+}
+
+// Report mode and owner of a file which would be created (--dry-run),
+// existing files keep their mode and owner when they are written
+func (r *Replacer) reportDryRunCreate(filename string, perm os.FileMode) {
+	if _, err := r.FileSystem.Stat(filename); !os.IsNotExist(err) {
+		return
+	}
+
+	r.logf("Dry run: %s would be created with mode %04o, owned by the current user\n", filename, applyUmask(perm))
+}
+
+// Copy file without match to its destination in --output-dir or --output-template,
+// mode of the source file is kept
+func (r *Replacer) copyUnchangedFile(fileitem FileItem) (string, error) {
+	output := fmt.Sprintf("%s no match, copied unchanged", fileitem.Path)
+
+	info, err := r.FileSystem.Stat(fileitem.Path)
+	if err != nil {
+		return "", err
+	}
+
+	// --dry-run
+	if r.opts.DryRun {
+		r.reportDryRunCreate(fileitem.Output, info.Mode().Perm())
+		return output, nil
+	}
+
+	content, err := r.readFile(fileitem.Path)
+	if err != nil {
+		return "", err
+	}
+
+	// --root, checked before directories of --output-dir are created
+	if err := r.checkRoot(fileitem.Output); err != nil {
+		return "", err
+	}
+
+	if err := r.createOutputDir(fileitem); err != nil {
+		return "", err
+	}
+
+	if err := r.writeFileWithRetry(fileitem.Output, content, info.Mode().Perm()); err != nil {
+		return "", err
+	}
+
+	return output, nil
+}
+
+// Path of filename below --output-dir, mirroring its path relative to root
+func (r *Replacer) outputDirPath(root string, filename string) (string, error) {
+	rel, err := filepath.Rel(root, filename)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Can't write %s to --output-dir %s: not below %s", filename, r.opts.OutputDir, root)
+	}
+
+	return filepath.Join(r.opts.OutputDir, rel), nil
+}
+
+// Variables of --output-template
+var outputTemplateVariable = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Checks that --output-template only uses known variables and
+// contains the file name, so files are not written to the same path
+func validateOutputTemplate(template string) error {
+	for _, variable := range outputTemplateVariable.FindAllString(template, -1) {
+		if !contains([]string{"{dir}", "{name}", "{ext}", "{base}"}, variable) {
+			return fmt.Errorf("unknown variable %s", variable)
+		}
+	}
+
+	if !strings.Contains(template, "{name}") && !strings.Contains(template, "{base}") {
+		return errors.New("{name} or {base} is required")
+	}
+
+	return nil
+}
+
+// Path of filename by --output-template, eg. {dir}/{name}.generated{ext}
+// for dir/file.txt is dir/file.generated.txt
+func (r *Replacer) outputTemplatePath(filename string) string {
+	base := filepath.Base(filename)
+	ext := filepath.Ext(base)
+
+	variables := strings.NewReplacer(
+		"{dir}", filepath.Dir(filename),
+		"{name}", strings.TrimSuffix(base, ext),
+		"{ext}", ext,
+		"{base}", base,
+	)
+
+	return filepath.Clean(variables.Replace(filepath.FromSlash(r.opts.OutputTemplate)))
+}
+
+// Create parent directories of the destination in --output-dir or --output-template
+func (r *Replacer) createOutputDir(fileitem FileItem) error {
+	if r.opts.OutputDir == "" && r.opts.OutputTemplate == "" {
+		return nil
+	}
+
+	return r.FileSystem.MkdirAll(filepath.Dir(fileitem.Output), 0755)
+}
+
+// Checks if content is empty, a byte order mark alone is no content
+func isEmptyContent(content string) bool {
+	return content == "" || content == byteOrderMark
+}
+
+// Checks if file contains --require-content,
+// reading is stopped at the first match
+func (r *Replacer) containsRequiredContent(fileitem FileItem) (bool, error) {
+	file, err := r.FileSystem.Open(fileitem.Path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	return r.opts.requireContent.MatchReader(bufio.NewReader(file)), nil
+}
+
+// Checks if filename is inside of --root, symlinks are resolved
+// so the file which would actually be written is checked
+func (r *Replacer) checkRoot(filename string) error {
+	if r.opts.root == "" {
+		return nil
+	}
+
+	path, err := resolveFileSystemPath(r.FileSystem, filename)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(r.opts.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Refusing to write %s: outside of --root %s", filename, r.opts.Root)
+	}
+
+	return nil
+}
+
+// Absolute path of filename with resolved symlinks, only the existing
+// directories are resolved if the file doesn't exist yet
+func resolvePath(filename string) (string, error) {
+	return resolveFileSystemPath(osFS{}, filename)
+}
+
+// Absolute path of filename with symlinks resolved by fs
+func resolveFileSystemPath(fs FileSystem, filename string) (string, error) {
+	path, err := fs.EvalSymlinks(filename)
+	if parent := filepath.Dir(filename); os.IsNotExist(err) && parent != filename {
+		// missing directories (eg. of --output-dir) are resolved up to the nearest existing one
+		var dir string
+		dir, err = resolveFileSystemPath(fs, parent)
+		path = filepath.Join(dir, filepath.Base(filename))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Abs(path)
+}
+
+// Write content to a temporary file next to the destination and rename it
+// afterwards, so an interrupted write never leaves a partially written file
+func writeFileAtomic(filename string, content []byte, perm os.FileMode) error {
+	tmpFile, err := createAtomicFile(filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(content)
+	return tmpFile.commit(err, perm)
+}
+
+// Temporary file next to filename which replaces it when committed
+type atomicFile struct {
+	*os.File
+	filename string      // destination, symlinks are resolved
+	original os.FileInfo // existing destination, nil for new files
+}
+
+// Create temporary file for filename, writing through symlinks
+func createAtomicFile(filename string) (*atomicFile, error) {
+	if realpath, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = realpath
+	}
+	original, _ := os.Stat(filename)
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return nil, err
+	}
+
+	return &atomicFile{File: tmpFile, filename: filename, original: original}, nil
+}
+
+// Close temporary file and rename it to its destination, keeping mode and owner
+// of an existing file (perm with the umask applied is used for new files). The
+// temporary file is removed instead if err is set (eg. a failed write) or committing fails.
+func (f *atomicFile) commit(err error, perm os.FileMode) error {
+	tmpFilename := f.Name()
+	if f.original != nil {
+		perm = f.original.Mode().Perm()
+	} else {
+		perm = applyUmask(perm)
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFilename, perm)
+	}
+	if err == nil && f.original != nil {
+		err = preserveOwner(tmpFilename, f.original)
+	}
+	if err == nil {
+		err = os.Rename(tmpFilename, f.filename)
+	}
+
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+
+	return nil
+}
+
+// Close and remove temporary file, destination is not changed
+func (f *atomicFile) discard() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// Filters of the files below a --path root (--path-pattern, --path-regex, ...)
+type pathFilter struct {
+	root         string
+	pathRegex    *regexp.Regexp
+	pathRegexNot *regexp.Regexp
+}
+
+func (r *Replacer) newPathFilter(root string) *pathFilter {
+	filter := &pathFilter{root: root}
+
+	// --path-regex
+	if r.opts.PathRegex != "" {
+		filter.pathRegex = regexp.MustCompile(r.opts.PathRegex)
+	}
+
+	// --path-regex-not
+	if r.opts.PathRegexNot != "" {
+		filter.pathRegexNot = regexp.MustCompile(r.opts.PathRegexNot)
+	}
+
+	return filter
+}
+
+// Reason why the directory isn't searched, empty if it is searched
+func (r *Replacer) dirSkipReason(filter *pathFilter, path string, f os.FileInfo) string {
+	// --skip-hidden
+	if r.opts.SkipHidden && path != filter.root && strings.HasPrefix(f.Name(), ".") {
+		return "hidden (--skip-hidden)"
+	}
+
+	if contains(pathFilterDirectories, f.Name()) {
+		return "ignored directory"
+	}
+
+	// --max-depth
+	if r.opts.maxDepth >= 0 && path != filter.root {
+		if rel, _ := filepath.Rel(filter.root, path); strings.Count(rel, string(filepath.Separator)) >= r.opts.maxDepth {
+			return "deeper than --max-depth"
+		}
+	}
+
+	return ""
+}
+
+// Reason why the file isn't selected, empty if it is selected
+func (r *Replacer) fileSkipReason(filter *pathFilter, path string, f os.FileInfo) string {
+	filename := f.Name()
+
+	// --skip-hidden
+	if r.opts.SkipHidden && path != filter.root && strings.HasPrefix(filename, ".") {
+		return "hidden (--skip-hidden)"
+	}
+
+	// --path-pattern
+	if r.opts.PathPattern != "" {
+		if matched, _ := filepath.Match(r.opts.PathPattern, filename); !matched {
+			return "doesn't match --path-pattern"
+		}
+	}
+
+	// --path-regex
+	if filter.pathRegex != nil && !filter.pathRegex.MatchString(path) {
+		return "doesn't match --path-regex"
+	}
+
+	// --path-regex-not
+	if filter.pathRegexNot != nil && filter.pathRegexNot.MatchString(path) {
+		return "excluded by --path-regex-not"
+	}
+
+	// --newer-than, --min-size, --max-size, --modified-after, --modified-before, --name-regex
+	return r.fileFilterSkipReason(f)
+}
+
+// SearchFilesInPath searches files in path and calls callback for every file matching the path filters
+// The walk is stopped and the context error returned if the context is cancelled
+func (r *Replacer) SearchFilesInPath(ctx context.Context, path string, callback func(os.FileInfo, string)) error {
+	filter := r.newPathFilter(path)
+
+	// collect all files
+	return r.FileSystem.Walk(path, func(path string, f os.FileInfo, err error) error {
+		// stop walking on cancellation
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// eg. missing --path or unreadable directory
+		if err != nil {
+			return err
+		}
+
+		// skip directories
+		if f.IsDir() {
+			if reason := r.dirSkipReason(filter, path, f); reason != "" {
+				r.explainSkip(path, reason)
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if reason := r.fileSkipReason(filter, path, f); reason != "" {
+			r.explainSkip(path, reason)
+			return nil
+		}
+
+		callback(f, path)
+		return nil
+	})
+}
+
+// Checks if the file would be selected by searching files in the root of the filter,
+// the directories between root and file are checked as well
+func (r *Replacer) selectedInPath(filter *pathFilter, path string) bool {
+	f, err := r.FileSystem.Lstat(path)
+	if err != nil || f.IsDir() {
+		return false
+	}
+
+	rel, err := filepath.Rel(filter.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+
+	// directories from root down to the file
+	dirs := []string{filter.root}
+	if sub := filepath.Dir(rel); sub != "." {
+		dir := filter.root
+		for _, name := range strings.Split(sub, string(filepath.Separator)) {
+			dir = filepath.Join(dir, name)
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		info, err := r.FileSystem.Lstat(dir)
+		if err != nil || r.dirSkipReason(filter, dir, info) != "" {
+			return false
+		}
+	}
+
+	return r.fileSkipReason(filter, path, f) == ""
+}
+
+// Log why a file or directory was skipped while searching files (--explain-skips)
+func (r *Replacer) explainSkip(path string, reason string) {
+	if r.opts.ExplainSkips {
+		r.logf("Skipped %s: %s\n", path, reason)
+	}
+}
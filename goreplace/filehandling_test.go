@@ -0,0 +1,592 @@
+package goreplace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearchFilesInPathCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 20; i++ {
+		writeTestFile(t, dir, fmt.Sprintf("test%d.txt", i), "foobar\n")
+	}
+
+	r, err := NewReplacer(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	found := 0
+	err = r.SearchFilesInPath(ctx, dir, func(f os.FileInfo, path string) {
+		found++
+		if found == 5 {
+			cancel()
+		}
+	})
+
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if found != 5 {
+		t.Errorf("expected walk to stop after 5 files, got %d", found)
+	}
+}
+
+func TestSearchFilesInPathMissingRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewReplacer(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.SearchFilesInPath(context.Background(), filepath.Join(dir, "missing"), func(f os.FileInfo, path string) {
+		t.Errorf("unexpected file %s", path)
+	})
+	if !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestProcessFilesRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	inside := writeTestFile(t, root, "inside.txt", "foobar\n")
+	outside := writeTestFile(t, dir, "outside.txt", "foobar\n")
+	link := filepath.Join(root, "link.txt")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Skip("symlinks not supported: ", err)
+	}
+	traversal := filepath.Join(root, "..", "outside.txt")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foobar"},
+		Replace: []string{"barfoo"},
+		Root:    root,
+	})
+
+	fileitems := []FileItem{{inside, inside}, {link, link}, {traversal, traversal}}
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.File.Path == inside {
+			if result.Error != nil {
+				t.Errorf("%s: expected file inside of --root to be written, got %s", result.File.Path, result.Error)
+			}
+		} else if result.Error == nil || result.Changed {
+			t.Errorf("%s: expected write outside of --root to be refused", result.File.Path)
+		}
+	}
+
+	if content := readTestFile(t, inside); content != "barfoo\n" {
+		t.Errorf("expected %q, got %q", "barfoo\n", content)
+	}
+	if content := readTestFile(t, outside); content != "foobar\n" {
+		t.Errorf("expected file outside of --root to be untouched, got %q", content)
+	}
+}
+
+func TestProcessFilesOutputDirRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	src := filepath.Join(root, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, src, "changed.txt", "foobar\n")
+	writeTestFile(t, src, "unchanged.txt", "other\n")
+
+	tests := []struct {
+		outputDir string
+		allowed   bool
+	}{
+		{filepath.Join(dir, "out", "nested"), false},
+		{filepath.Join(root, "out", "nested"), true},
+	}
+
+	for _, test := range tests {
+		r, changesets := newTestReplacer(t, Options{
+			Search:        []string{"foobar"},
+			Replace:       []string{"barfoo"},
+			Path:          src,
+			OutputDir:     test.outputDir,
+			CopyUnchanged: true,
+			Root:          root,
+		})
+
+		fileitems, err := r.BuildFileitems(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, result := range results {
+			if (result.Error == nil) != test.allowed {
+				t.Errorf("%s: expected allowed %v, got error %v", test.outputDir, test.allowed, result.Error)
+			}
+		}
+
+		// directories outside of --root are not created before the write is refused
+		if _, err := os.Stat(filepath.Dir(test.outputDir)); os.IsNotExist(err) == test.allowed {
+			t.Errorf("%s: expected directory created %v", test.outputDir, test.allowed)
+		}
+	}
+}
+
+func TestSearchFilesInPathMaxDepth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "root.txt", "foobar\n")
+	writeTestFile(t, filepath.Join(dir, "a"), "level1.txt", "foobar\n")
+	writeTestFile(t, filepath.Join(dir, "a", "b"), "level2.txt", "foobar\n")
+
+	tests := []struct {
+		maxDepth string
+		expected int
+	}{
+		{"", 3},
+		{"0", 1},
+		{"1", 2},
+		{"2", 3},
+	}
+
+	for _, test := range tests {
+		r, err := NewReplacer(Options{MaxDepth: test.maxDepth})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found []string
+		err = r.SearchFilesInPath(context.Background(), dir, func(f os.FileInfo, path string) {
+			found = append(found, f.Name())
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(found) != test.expected {
+			t.Errorf("--max-depth=%s: expected %d files, got %v", test.maxDepth, test.expected, found)
+		}
+	}
+}
+
+func TestSearchFilesInPathSkipHidden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, ".config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "visible.txt", "foobar\n")
+	writeTestFile(t, dir, ".hidden", "foobar\n")
+	writeTestFile(t, filepath.Join(dir, ".config"), "settings.txt", "foobar\n")
+
+	tests := []struct {
+		skipHidden bool
+		expected   int
+	}{
+		{false, 3},
+		{true, 1},
+	}
+
+	for _, test := range tests {
+		r, err := NewReplacer(Options{SkipHidden: test.skipHidden})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found []string
+		err = r.SearchFilesInPath(context.Background(), dir, func(f os.FileInfo, path string) {
+			found = append(found, f.Name())
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(found) != test.expected {
+			t.Errorf("--skip-hidden=%v: expected %d files, got %v", test.skipHidden, test.expected, found)
+		}
+	}
+}
+
+func TestSearchFilesInPathRegexNot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "vendor"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "main.go", "foobar\n")
+	writeTestFile(t, dir, "main.txt", "foobar\n")
+	writeTestFile(t, filepath.Join(dir, "vendor"), "lib.go", "foobar\n")
+
+	r, err := NewReplacer(Options{PathRegex: `\.go$`, PathRegexNot: `/vendor/`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	err = r.SearchFilesInPath(context.Background(), dir, func(f os.FileInfo, path string) {
+		found = append(found, f.Name())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 1 || found[0] != "main.go" {
+		t.Errorf("expected only main.go, got %v", found)
+	}
+}
+
+func TestSearchFilesInPathExplainSkips(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "main.go", "foobar\n")
+	writeTestFile(t, dir, "main.txt", "foobar\n")
+
+	r, err := NewReplacer(Options{Path: dir, PathPattern: "*.go", ExplainSkips: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	r.Logger = &log
+
+	err = r.SearchFilesInPath(context.Background(), dir, func(f os.FileInfo, path string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("Skipped %s: ignored directory\nSkipped %s: doesn't match --path-pattern\n", filepath.Join(dir, ".git"), filepath.Join(dir, "main.txt"))
+	if log.String() != expected {
+		t.Errorf("expected %q, got %q", expected, log.String())
+	}
+}
+
+func TestApplyChangesetsToFileByteOrderMark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		preserveBOM string
+		expected    string
+	}{
+		{"", "\xef\xbb\xbfbar = 1\nkey = 2\n"},
+		{"yes", "\xef\xbb\xbfbar = 1\nkey = 2\n"},
+		{"no", "bar = 1\nkey = 2\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", "\xef\xbb\xbfkey = 1\nkey = 2\n")
+
+		r, changesets := newTestReplacer(t, Options{
+			Search:      []string{"^key = 1"},
+			Replace:     []string{"bar = 1"},
+			Regex:       true,
+			PreserveBOM: test.preserveBOM,
+		})
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if content := readTestFile(t, path); content != test.expected {
+			t.Errorf("--preserve-bom=%s: expected %q, got %q", test.preserveBOM, test.expected, content)
+		}
+	}
+
+	// UTF-16 isn't decoded, its byte order mark is content
+	path := writeTestFile(t, dir, "test.txt", "\xff\xfek\x00e\x00y\x00")
+	r, changesets := newTestReplacer(t, Options{Search: []string{"k"}, Replace: []string{"K"}, PreserveBOM: "no"})
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+	if content := readTestFile(t, path); content != "\xff\xfeK\x00e\x00y\x00" {
+		t.Errorf("expected UTF-16 byte order mark to be kept, got %q", content)
+	}
+}
+
+func TestProcessFilesOutputDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub", "deep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, src, "a.txt", "foobar\n")
+	writeTestFile(t, filepath.Join(src, "sub", "deep"), "b.txt", "foobar\n")
+	writeTestFile(t, filepath.Join(src, "sub"), "c.txt", "other\n")
+
+	for _, copyUnchanged := range []bool{false, true} {
+		out := filepath.Join(dir, fmt.Sprintf("out-%v", copyUnchanged))
+
+		r, changesets := newTestReplacer(t, Options{
+			Search:        []string{"foobar"},
+			Replace:       []string{"barfoo"},
+			Path:          src,
+			OutputDir:     out,
+			CopyUnchanged: copyUnchanged,
+		})
+
+		fileitems, err := r.BuildFileitems(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			if result.Error != nil {
+				t.Fatalf("%s: %s", result.File.Path, result.Error)
+			}
+		}
+
+		for _, name := range []string{"a.txt", filepath.Join("sub", "deep", "b.txt")} {
+			if content := readTestFile(t, filepath.Join(out, name)); content != "barfoo\n" {
+				t.Errorf("%s: expected %q, got %q", name, "barfoo\n", content)
+			}
+			if content := readTestFile(t, filepath.Join(src, name)); content != "foobar\n" {
+				t.Errorf("%s: expected source to be untouched, got %q", name, content)
+			}
+		}
+
+		unchanged := filepath.Join(out, "sub", "c.txt")
+		if copyUnchanged {
+			if content := readTestFile(t, unchanged); content != "other\n" {
+				t.Errorf("expected unchanged file to be copied, got %q", content)
+			}
+		} else if _, err := os.Stat(unchanged); !os.IsNotExist(err) {
+			t.Errorf("expected unchanged file not to be written without --copy-unchanged")
+		}
+	}
+}
+
+func TestProcessFilesOutputDirError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestFile(t, src, "a.txt", "foobar\n")
+
+	// --output-dir below a file can't be created
+	blocker := writeTestFile(t, dir, "blocker", "")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:    []string{"foobar"},
+		Replace:   []string{"barfoo"},
+		Path:      src,
+		OutputDir: filepath.Join(blocker, "out"),
+	})
+
+	fileitems, err := r.BuildFileitems(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].Error == nil {
+		t.Fatalf("expected error for --output-dir which can't be created, got %+v", results)
+	}
+
+	if content := readTestFile(t, path); content != "foobar\n" {
+		t.Errorf("expected source to be unchanged, got %q", content)
+	}
+}
+
+func TestProcessFilesDryRunReportsCreatedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	out := filepath.Join(dir, "out")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, src, "new.txt", "foobar\n")
+	writeTestFile(t, src, "existing.txt", "foobar\n")
+	writeTestFile(t, out, "existing.txt", "old\n")
+	if err := os.Chmod(writeTestFile(t, src, "private.txt", "other\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:        []string{"foobar"},
+		Replace:       []string{"barfoo"},
+		Path:          src,
+		OutputDir:     out,
+		CopyUnchanged: true,
+		DryRun:        true,
+	})
+
+	var logger bytes.Buffer
+	r.Logger = &logger
+
+	fileitems, err := r.BuildFileitems(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ProcessFiles(context.Background(), changesets, fileitems); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		fmt.Sprintf("Dry run: %s would be created with mode %04o", filepath.Join(out, "new.txt"), applyUmask(0644)),
+		fmt.Sprintf("Dry run: %s would be created with mode %04o", filepath.Join(out, "private.txt"), applyUmask(0600)),
+	} {
+		if !strings.Contains(logger.String(), expected) {
+			t.Errorf("expected %q in output, got %q", expected, logger.String())
+		}
+	}
+	if strings.Contains(logger.String(), "existing.txt") {
+		t.Errorf("expected no note for existing file, got %q", logger.String())
+	}
+	if _, err := os.Stat(filepath.Join(out, "new.txt")); !os.IsNotExist(err) {
+		t.Error("expected no file to be created with --dry-run")
+	}
+}
+
+func TestOutputTemplatePath(t *testing.T) {
+	tests := []struct {
+		template string
+		filename string
+		expected string
+	}{
+		{"{dir}/{name}.generated{ext}", "conf/app.yaml", "conf/app.generated.yaml"},
+		{"{dir}/{name}.generated{ext}", "Makefile", "Makefile.generated"},
+		{"build/{dir}/{base}", "src/main.go", "build/src/main.go"},
+		{"out/{name}.txt", "/tmp/data.tar.gz", "out/data.tar.txt"},
+		{"{dir}/{base}.orig", "a.txt", "a.txt.orig"},
+	}
+
+	for _, test := range tests {
+		r, _ := newTestReplacer(t, Options{Search: []string{"foo"}, Replace: []string{"bar"}, OutputTemplate: test.template})
+
+		expected := filepath.FromSlash(test.expected)
+		if output := r.outputTemplatePath(filepath.FromSlash(test.filename)); output != expected {
+			t.Errorf("%s with %s: expected %s, got %s", test.template, test.filename, expected, output)
+		}
+	}
+
+	for _, template := range []string{"{dir}/out.txt", "{dir}/{file}{ext}", "{dir}/{name"} {
+		if _, err := NewReplacer(Options{OutputTemplate: template}); err == nil {
+			t.Errorf("%s: expected error", template)
+		}
+	}
+}
+
+func TestProcessFilesOutputTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "app.conf", "foobar\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:         []string{"foobar"},
+		Replace:        []string{"barfoo"},
+		OutputTemplate: "{dir}/generated/{name}.generated{ext}",
+	})
+
+	fileitems, err := r.BuildFileitems(context.Background(), []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Error != nil {
+		t.Fatal(results[0].Error)
+	}
+
+	if content := readTestFile(t, filepath.Join(dir, "generated", "app.generated.conf")); content != "barfoo\n" {
+		t.Errorf("expected %q, got %q", "barfoo\n", content)
+	}
+	if content := readTestFile(t, path); content != "foobar\n" {
+		t.Errorf("expected source to be untouched, got %q", content)
+	}
+}
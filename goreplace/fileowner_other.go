@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package goreplace
+
+import (
+	"os"
+)
+
+// File owners are not preserved on this platform
+func preserveOwner(filename string, original os.FileInfo) error {
+	return nil
+}
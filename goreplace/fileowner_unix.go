@@ -0,0 +1,34 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package goreplace
+
+import (
+	"os"
+	"syscall"
+)
+
+// Set owner (uid/gid) of filename to the owner of the original file,
+// otherwise files rewritten by root would be owned by root afterwards
+func preserveOwner(filename string, original os.FileInfo) error {
+	originalStat, ok := original.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if newStat, ok := stat.Sys().(*syscall.Stat_t); ok && newStat.Uid == originalStat.Uid && newStat.Gid == originalStat.Gid {
+		return nil
+	}
+
+	// only root can give away files, other users keep their own
+	// files like before (eg. group writable files)
+	if err := os.Chown(filename, int(originalStat.Uid), int(originalStat.Gid)); err != nil && !os.IsPermission(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package goreplace
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFileAtomicPreservesOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing file owners requires root")
+	}
+
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "foobar\n")
+	if err := os.Chown(path, 12345, 23456); err != nil {
+		t.Skip("unable to change file owner: ", err)
+	}
+
+	if err := writeFileAtomic(path, []byte("barfoo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := stat.Sys().(*syscall.Stat_t)
+	if owner.Uid != 12345 || owner.Gid != 23456 {
+		t.Errorf("expected owner 12345:23456, got %d:%d", owner.Uid, owner.Gid)
+	}
+	if content := readTestFile(t, path); content != "barfoo\n" {
+		t.Errorf("expected %q, got %q", "barfoo\n", content)
+	}
+}
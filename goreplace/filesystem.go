@@ -0,0 +1,103 @@
+package goreplace
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileSystem is used by the replacer to search, read and write the processed
+// files (including --output-dir directories and --validate-cmd backups), eg. to
+// replace in memory in tests. Files of options (like --search-file, --audit-log
+// or --patch-file) are always on disk.
+type FileSystem interface {
+	// Open opens the file for reading
+	Open(name string) (File, error)
+
+	// Stat returns the file info of the file
+	Stat(name string) (os.FileInfo, error)
+
+	// Lstat returns the file info of the file without following symlinks
+	Lstat(name string) (os.FileInfo, error)
+
+	// WriteFile replaces the content of the file, perm is used for new files
+	WriteFile(name string, content []byte, perm os.FileMode) error
+
+	// Rename moves the file to newpath (--rename)
+	Rename(oldpath, newpath string) error
+
+	// Remove removes the file (--remove-empty-files)
+	Remove(name string) error
+
+	// MkdirAll creates the directory and its parents (--output-dir)
+	MkdirAll(path string, perm os.FileMode) error
+
+	// EvalSymlinks returns the path with resolved symlinks (--root)
+	EvalSymlinks(path string) (string, error)
+
+	// Walk calls walkFn for root and each file and directory below it like filepath.Walk
+	Walk(root string, walkFn filepath.WalkFunc) error
+}
+
+// File is a file opened for reading by a FileSystem
+type File interface {
+	io.ReadCloser
+	Stat() (os.FileInfo, error)
+}
+
+// File system of the operating system, files are written atomically
+type osFS struct{}
+
+func (osFS) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFS) WriteFile(name string, content []byte, perm os.FileMode) error {
+	return writeFileAtomic(name, content, perm)
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFS) EvalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
+
+func (osFS) Walk(root string, walkFn filepath.WalkFunc) error {
+	return filepath.Walk(root, walkFn)
+}
+
+// Checks if files are processed on the file system of the OS
+func (r *Replacer) isOSFileSystem() bool {
+	_, ok := r.FileSystem.(osFS)
+	return ok
+}
+
+// Read the whole content of a file from the file system
+func (r *Replacer) readFile(name string) ([]byte, error) {
+	file, err := r.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ioutil.ReadAll(file)
+}
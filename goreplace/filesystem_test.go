@@ -0,0 +1,330 @@
+package goreplace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// File system which calls writeFile instead of writing to the embedded file system
+type writeHookFS struct {
+	FileSystem
+	writeFile func(filename string, content []byte, perm os.FileMode) error
+}
+
+func (fs writeHookFS) WriteFile(name string, content []byte, perm os.FileMode) error {
+	return fs.writeFile(name, content, perm)
+}
+
+// File system with the content of files by path, directories are implied by the paths
+type memFS struct {
+	mutex sync.Mutex
+	files map[string]string
+}
+
+func newMemFS(files map[string]string) *memFS {
+	return &memFS{files: files}
+}
+
+type memFile struct {
+	*bytes.Reader
+	info os.FileInfo
+}
+
+func (f memFile) Close() error               { return nil }
+func (f memFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+func (fs *memFS) Open(name string) (File, error) {
+	info, err := fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return memFile{bytes.NewReader([]byte(fs.content(name))), info}, nil
+}
+
+// Content of the file, empty if it doesn't exist
+func (fs *memFS) content(name string) string {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.files[filepath.Clean(name)]
+}
+
+func (fs *memFS) Stat(name string) (os.FileInfo, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	name = filepath.Clean(name)
+	if content, ok := fs.files[name]; ok {
+		return memFileInfo{filepath.Base(name), int64(len(content)), false}, nil
+	}
+
+	for path := range fs.files {
+		if strings.HasPrefix(path, name+string(filepath.Separator)) {
+			return memFileInfo{filepath.Base(name), 0, true}, nil
+		}
+	}
+
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+// There are no symlinks
+func (fs *memFS) Lstat(name string) (os.FileInfo, error) {
+	return fs.Stat(name)
+}
+
+func (fs *memFS) WriteFile(name string, content []byte, perm os.FileMode) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.files[filepath.Clean(name)] = string(content)
+	return nil
+}
+
+func (fs *memFS) Rename(oldpath, newpath string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	content, ok := fs.files[filepath.Clean(oldpath)]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	delete(fs.files, filepath.Clean(oldpath))
+	fs.files[filepath.Clean(newpath)] = content
+	return nil
+}
+
+func (fs *memFS) Remove(name string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if _, ok := fs.files[filepath.Clean(name)]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(fs.files, filepath.Clean(name))
+	return nil
+}
+
+// Directories are implied by the paths of the files
+func (fs *memFS) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+// There are no symlinks
+func (fs *memFS) EvalSymlinks(path string) (string, error) {
+	return filepath.Clean(path), nil
+}
+
+// Walks files in lexical order, directories are visited before their files
+func (fs *memFS) Walk(root string, walkFn filepath.WalkFunc) error {
+	root = filepath.Clean(root)
+
+	var paths []string
+	seen := map[string]bool{}
+	fs.mutex.Lock()
+	for path := range fs.files {
+		for dir := path; strings.HasPrefix(dir, root+string(filepath.Separator)) || dir == root; dir = filepath.Dir(dir) {
+			if !seen[dir] {
+				seen[dir] = true
+				paths = append(paths, dir)
+			}
+		}
+	}
+	fs.mutex.Unlock()
+	sort.Strings(paths)
+
+	for i := 0; i < len(paths); i++ {
+		path := paths[i]
+		info, _ := fs.Stat(path)
+		if err := walkFn(path, info, nil); err == filepath.SkipDir {
+			for i+1 < len(paths) && strings.HasPrefix(paths[i+1], path+string(filepath.Separator)) {
+				i++
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type memFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.isDir }
+func (i memFileInfo) Sys() interface{}   { return nil }
+func (i memFileInfo) Mode() os.FileMode {
+	if i.isDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func TestProcessFilesInMemory(t *testing.T) {
+	fs := newMemFS(map[string]string{
+		filepath.Join("src", "a.txt"):           "foo bar\n",
+		filepath.Join("src", "sub", "b.txt"):    "foo\nfoo\n",
+		filepath.Join("src", "sub", "c.txt"):    "other\n",
+		filepath.Join("src", ".git", "HEAD"):    "foo\n",
+		filepath.Join("elsewhere", "d.txt"):     "foo\n",
+		filepath.Join("elsewhere", "other.txt"): "foo\n",
+	})
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foo"},
+		Replace: []string{"baz"},
+		Path:    "src",
+	})
+	r.FileSystem = fs
+
+	fileitems, err := r.BuildFileitems(context.Background(), []string{filepath.Join("elsewhere", "d.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("%s: %s", result.File.Path, result.Error)
+		}
+	}
+
+	expected := map[string]string{
+		filepath.Join("src", "a.txt"):           "baz bar\n",
+		filepath.Join("src", "sub", "b.txt"):    "baz\nbaz\n",
+		filepath.Join("src", "sub", "c.txt"):    "other\n",
+		filepath.Join("src", ".git", "HEAD"):    "foo\n",
+		filepath.Join("elsewhere", "d.txt"):     "baz\n",
+		filepath.Join("elsewhere", "other.txt"): "foo\n",
+	}
+	for path, content := range expected {
+		if fs.files[path] != content {
+			t.Errorf("%s: expected %q, got %q", path, content, fs.files[path])
+		}
+	}
+	if len(fs.files) != len(expected) {
+		t.Errorf("expected %d files, got %d", len(expected), len(fs.files))
+	}
+}
+
+func TestProcessFilesInMemoryRenameAndRemove(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		expected map[string]string
+	}{
+		{"rename", Options{Replace: []string{"bar"}, Rename: "content"}, map[string]string{filepath.Join("src", "bar.txt"): "bar\n"}},
+		{"remove-empty-files", Options{Replace: []string{""}, DropEmptyLines: true, RemoveEmptyFiles: true}, map[string]string{}},
+	}
+
+	for _, test := range tests {
+		fs := newMemFS(map[string]string{filepath.Join("src", "foo.txt"): "foo\n"})
+
+		opts := test.opts
+		opts.Search = []string{"foo"}
+		opts.Path = "src"
+		r, changesets := newTestReplacer(t, opts)
+		r.FileSystem = fs
+
+		fileitems, err := r.BuildFileitems(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			if result.Error != nil {
+				t.Fatalf("%s: %s: %s", test.name, result.File.Path, result.Error)
+			}
+		}
+
+		if !reflect.DeepEqual(fs.files, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, fs.files)
+		}
+	}
+}
+
+func TestProcessFilesInMemoryDoesNotTouchDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(run func([]string) ([]byte, error)) { runValidateCmd = run }(runValidateCmd)
+
+	// file on disk at the path of an in-memory file must neither be
+	// used as backup nor be written when the backup is restored
+	invalid := writeTestFile(t, dir, "invalid.txt", "on disk\n")
+	runValidateCmd = func(args []string) ([]byte, error) {
+		if args[len(args)-1] == invalid {
+			return nil, errors.New("exit status 1")
+		}
+		return nil, nil
+	}
+
+	src := filepath.Join(dir, "src")
+	out := filepath.Join(dir, "out")
+	fs := newMemFS(map[string]string{
+		filepath.Join(src, "a.txt"): "foo\n",
+		invalid:                     "foo\n",
+	})
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:      []string{"foo"},
+		Replace:     []string{"bar"},
+		Path:        src,
+		OutputDir:   out,
+		ValidateCmd: "check",
+	})
+	r.FileSystem = fs
+
+	fileitems, err := r.BuildFileitems(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileitems = append(fileitems, FileItem{invalid, invalid})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if (result.Error != nil) != (result.File.Path == invalid) {
+			t.Errorf("%s: unexpected error %v", result.File.Path, result.Error)
+		}
+	}
+
+	if content := fs.content(filepath.Join(out, "a.txt")); content != "bar\n" {
+		t.Errorf("expected %q in --output-dir, got %q", "bar\n", content)
+	}
+	if content := fs.content(invalid); content != "foo\n" {
+		t.Errorf("expected in-memory file to be restored, got %q", content)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("expected --output-dir not to be created on disk")
+	}
+	if content := readTestFile(t, invalid); content != "on disk\n" {
+		t.Errorf("expected file on disk not to be changed, got %q", content)
+	}
+}
@@ -0,0 +1,42 @@
+package goreplace
+
+import (
+	"os"
+)
+
+// Reason why a file is skipped by the metadata filters (--newer-than, --min-size,
+// --max-size, --modified-after, --modified-before, --name-regex) or empty if it is used,
+// applied to files found below --path and to file arguments
+func (r *Replacer) fileFilterSkipReason(f os.FileInfo) string {
+	// --newer-than, same as --modified-after
+	if !r.opts.newerThan.IsZero() && !f.ModTime().After(r.opts.newerThan) {
+		return "not newer than --newer-than"
+	}
+
+	// --min-size
+	if r.opts.minSize > 0 && f.Size() < r.opts.minSize {
+		return "smaller than --min-size"
+	}
+
+	// --max-size
+	if r.opts.maxSize > 0 && f.Size() > r.opts.maxSize {
+		return "larger than --max-size"
+	}
+
+	// --modified-after
+	if !r.opts.modifiedAfter.IsZero() && !f.ModTime().After(r.opts.modifiedAfter) {
+		return "not modified after --modified-after"
+	}
+
+	// --modified-before
+	if !r.opts.modifiedBefore.IsZero() && !f.ModTime().Before(r.opts.modifiedBefore) {
+		return "not modified before --modified-before"
+	}
+
+	// --name-regex
+	if r.opts.nameRegex != nil && !r.opts.nameRegex.MatchString(f.Name()) {
+		return "doesn't match --name-regex"
+	}
+
+	return ""
+}
@@ -0,0 +1,100 @@
+package goreplace
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileFilterSkipReason(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	small := writeTestFile(t, dir, "small.txt", "foo\n")
+	large := writeTestFile(t, dir, "large.log", strings.Repeat("foo\n", 1024))
+
+	old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(small, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected map[string]string
+	}{
+		{"newer-than", Options{NewerThan: "2010-01-01T00:00:00Z"}, map[string]string{small: "not newer than --newer-than", large: ""}},
+		{"min-size", Options{MinSize: "1K"}, map[string]string{small: "smaller than --min-size", large: ""}},
+		{"max-size", Options{MaxSize: "4K"}, map[string]string{small: "", large: ""}},
+		{"max-size exceeded", Options{MaxSize: "100"}, map[string]string{small: "", large: "larger than --max-size"}},
+		{"modified-after", Options{ModifiedAfter: "2010-01-01T00:00:00Z"}, map[string]string{small: "not modified after --modified-after", large: ""}},
+		{"modified-before", Options{ModifiedBefore: "1h"}, map[string]string{small: "", large: "not modified before --modified-before"}},
+		{"name-regex", Options{NameRegex: `\.txt$`}, map[string]string{small: "", large: "doesn't match --name-regex"}},
+	}
+
+	for _, test := range tests {
+		r, err := NewReplacer(test.opts)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		for path, expected := range test.expected {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if reason := r.fileFilterSkipReason(info); reason != expected {
+				t.Errorf("%s: expected %q for %s, got %q", test.name, expected, filepath.Base(path), reason)
+			}
+		}
+	}
+
+	if _, err := NewReplacer(Options{MinSize: "2K", MaxSize: "1K"}); err == nil {
+		t.Error("expected error for --min-size larger than --max-size")
+	}
+}
+
+func TestBuildFileitemsFileFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	small := writeTestFile(t, dir, "small.txt", "foo\n")
+	large := writeTestFile(t, dir, "large.txt", strings.Repeat("foo\n", 1024))
+	missing := filepath.Join(dir, "missing.txt")
+
+	r, err := NewReplacer(Options{MaxSize: "1K"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// file arguments and files below --path are filtered the same way
+	fileitems, err := r.BuildFileitems(context.Background(), []string{small, large, missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileitems) != 2 || fileitems[0].Path != small || fileitems[1].Path != missing {
+		t.Errorf("expected %s and %s, got %v", small, missing, fileitems)
+	}
+
+	var found []string
+	err = r.SearchFilesInPath(context.Background(), dir, func(f os.FileInfo, path string) {
+		found = append(found, f.Name())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0] != "small.txt" {
+		t.Errorf("expected only small.txt, got %v", found)
+	}
+}
@@ -0,0 +1,534 @@
+package goreplace
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// check if string is contained in an array
+func contains(slice []string, item string) bool {
+	set := make(map[string]struct{}, len(slice))
+	for _, s := range slice {
+		set[s] = struct{}{}
+	}
+
+	_, ok := set[item]
+	return ok
+}
+
+// Split line into leading whitespace, content and trailing whitespace
+func splitSurroundingWhitespace(line string) (string, string, string) {
+	content := strings.TrimLeftFunc(line, unicode.IsSpace)
+	leading := line[:len(line)-len(content)]
+
+	trimmed := strings.TrimRightFunc(content, unicode.IsSpace)
+	trailing := content[len(trimmed):]
+
+	return leading, trimmed, trailing
+}
+
+// Checks if all backreferences ($1, ${1}, $name, ${name}) in the replace term
+// refer to existing groups of the search regex
+func validateBackrefs(search *regexp.Regexp, replace string) error {
+	groupNames := search.SubexpNames()
+
+	for i := 0; i < len(replace); i++ {
+		if replace[i] != '$' || i+1 >= len(replace) {
+			continue
+		}
+
+		// escaped dollar ($$)
+		if replace[i+1] == '$' {
+			i++
+			continue
+		}
+
+		var name, ref string
+		if replace[i+1] == '{' {
+			end := strings.IndexByte(replace[i+2:], '}')
+			if end < 0 {
+				continue
+			}
+			name = replace[i+2 : i+2+end]
+			ref = "${" + name + "}"
+		} else {
+			end := i + 1
+			for end < len(replace) && isBackrefNameChar(replace[end]) {
+				end++
+			}
+			name = replace[i+1 : end]
+			ref = "$" + name
+		}
+
+		// not a valid reference, will be kept literally
+		if !isBackrefName(name) {
+			continue
+		}
+
+		if num, err := strconv.Atoi(name); err == nil {
+			if num > search.NumSubexp() {
+				return fmt.Errorf("Replace term \"%s\" references %s, but search term \"%s\" has only %d group(s)", replace, ref, search.String(), search.NumSubexp())
+			}
+		} else if !contains(groupNames, name) {
+			// $name is greedy, $1st references group "1st" and not group 1
+			if group := backrefGroupPrefix(search, name); group != "" && ref[1] != '{' {
+				return fmt.Errorf("Replace term \"%s\" references %s, but search term \"%s\" has no group with this name (use ${%s} to reference group %s)", replace, ref, search.String(), group, group)
+			}
+
+			return fmt.Errorf("Replace term \"%s\" references %s, but search term \"%s\" has no group with this name", replace, ref, search.String())
+		}
+	}
+
+	return nil
+}
+
+// Escapes all dollars in the replace term which are no reference to a group of the
+// search regex as $$ (--replace-escape), references are kept like validateBackrefs reads them
+func escapeLiteralDollars(search *regexp.Regexp, replace string) string {
+	var ret strings.Builder
+
+	for i := 0; i < len(replace); i++ {
+		if replace[i] != '$' {
+			ret.WriteByte(replace[i])
+			continue
+		}
+
+		// already escaped dollar ($$)
+		if i+1 < len(replace) && replace[i+1] == '$' {
+			ret.WriteString("$$")
+			i++
+			continue
+		}
+
+		var name string
+		if i+1 < len(replace) && replace[i+1] == '{' {
+			if end := strings.IndexByte(replace[i+2:], '}'); end >= 0 {
+				name = replace[i+2 : i+2+end]
+			}
+		} else {
+			end := i + 1
+			for end < len(replace) && isBackrefNameChar(replace[end]) {
+				end++
+			}
+			name = replace[i+1 : end]
+		}
+
+		if isBackrefName(name) && isGroupReference(search, name) {
+			ret.WriteByte('$')
+		} else {
+			ret.WriteString("$$")
+		}
+	}
+
+	return ret.String()
+}
+
+// Checks if name is the number or name of a group of the search regex
+func isGroupReference(search *regexp.Regexp, name string) bool {
+	if num, err := strconv.Atoi(name); err == nil {
+		return num <= search.NumSubexp()
+	}
+
+	return contains(search.SubexpNames(), name)
+}
+
+// Find the longest group number or name which is a prefix of name
+func backrefGroupPrefix(search *regexp.Regexp, name string) string {
+	for i := len(name) - 1; i > 0; i-- {
+		prefix := name[:i]
+
+		if num, err := strconv.Atoi(prefix); err == nil {
+			if num <= search.NumSubexp() {
+				return prefix
+			}
+		} else if contains(search.SubexpNames(), prefix) {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+func isBackrefNameChar(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isBackrefName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		if !isBackrefNameChar(name[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Escape sequences of --interpret-escapes, other backslashes are kept
+var escapeSequences = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t", `\r`, "\r")
+
+// Replace \n, \t, \r and \\ with newline, tab, carriage return and backslash
+func interpretEscapes(value string) string {
+	return escapeSequences.Replace(value)
+}
+
+// Range of line numbers (1-based, inclusive)
+type lineRange struct {
+	From int
+	To   int
+}
+
+// Parse list of lines and ranges like 3,7,12-15
+func parseLineRanges(value string) ([]lineRange, error) {
+	var ret []lineRange
+
+	for _, item := range strings.Split(value, ",") {
+		from, to := strings.TrimSpace(item), ""
+		if i := strings.IndexByte(from, '-'); i >= 0 {
+			from, to = strings.TrimSpace(from[:i]), strings.TrimSpace(from[i+1:])
+		} else {
+			to = from
+		}
+
+		fromLine, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, err
+		}
+		toLine, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, err
+		}
+
+		if fromLine < 1 || toLine < fromLine {
+			return nil, fmt.Errorf("invalid range %s", item)
+		}
+		ret = append(ret, lineRange{fromLine, toLine})
+	}
+
+	return ret, nil
+}
+
+// Split command line into arguments like a POSIX shell without running one:
+// arguments are separated by whitespace, single quotes keep everything,
+// double quotes keep everything except \" \\ \$ and \` and a backslash
+// outside of quotes escapes the next character. Variables, globs and
+// redirections are not expanded.
+func splitCommandLine(value string) ([]string, error) {
+	var (
+		ret     []string
+		current strings.Builder
+		inArg   bool
+	)
+
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				ret = append(ret, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case c == '\\':
+			if i+1 >= len(value) {
+				return nil, errors.New("backslash at the end")
+			}
+			i++
+			current.WriteByte(value[i])
+			inArg = true
+		case c == '\'':
+			end := strings.IndexByte(value[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			current.WriteString(value[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '"':
+			for i++; ; i++ {
+				if i >= len(value) {
+					return nil, errors.New("unterminated double quote")
+				}
+				if value[i] == '"' {
+					break
+				}
+				if value[i] == '\\' && i+1 < len(value) && strings.IndexByte("\"\\$`", value[i+1]) >= 0 {
+					i++
+				}
+				current.WriteByte(value[i])
+			}
+			inArg = true
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		ret = append(ret, current.String())
+	}
+
+	return ret, nil
+}
+
+var whitespaceRun = regexp.MustCompile("[ \t]+")
+
+// Collapse runs of spaces and tabs into a single space, indentation is kept
+func squeezeWhitespace(line string) string {
+	indent := leadingIndent(line)
+
+	return indent + whitespaceRun.ReplaceAllLiteralString(line[len(indent):], " ")
+}
+
+// Leading spaces and tabs of line
+func leadingIndent(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// Width of indentation in columns, tabs advance to the next multiple
+// of tabWidth (without tab width a tab is one column)
+func indentWidth(indent string, tabWidth int) int {
+	width := 0
+	for _, c := range indent {
+		if c == '\t' && tabWidth > 0 {
+			width += tabWidth - width%tabWidth
+		} else {
+			width++
+		}
+	}
+
+	return width
+}
+
+// Checks if there is a match in content, based on search options
+func (r *Replacer) searchMatch(content string, changeset Changeset) bool {
+	matched := changeset.Search.MatchString(content)
+
+	// --token-chars, only complete tokens match
+	if matched && r.opts.tokenChars != nil {
+		matched = len(r.tokenMatches(content, changeset.Search.FindAllStringIndex(content, -1))) > 0
+	}
+
+	// --invert-match
+	if r.opts.InvertMatch {
+		return !matched
+	}
+
+	return matched
+}
+
+// Replace text in content, repeated until the content is stable with --repeat
+func (r *Replacer) replaceTextPasses(content string, changeset Changeset, skip int, max int, position linePosition) (string, int, int) {
+	content, replaceCount, matchCount := r.replaceText(content, changeset, skip, max, position)
+
+	// --repeat
+	// guard against replacements which never get stable (eg. a -> aa)
+	for pass := 1; r.opts.Repeat > 0 && replaceCount > 0; pass++ {
+		next, passReplaceCount, _ := r.replaceText(content, changeset, skip, max, position)
+		if next == content {
+			break
+		}
+
+		if pass >= r.opts.Repeat {
+			r.logWarning(fmt.Sprintf("%s:%d: replacement not stable after %d passes", position.File, position.Line, r.opts.Repeat))
+			break
+		}
+
+		content = next
+		replaceCount += passReplaceCount
+	}
+
+	return content, replaceCount, matchCount
+}
+
+// Checks if there is a match in line, only in the segments
+// selected by --in if the line was split (--lang)
+func (r *Replacer) lineMatch(line string, segments []codeSegment, changeset Changeset) bool {
+	if !lineConditionMatch(line, changeset) {
+		return false
+	}
+
+	if segments != nil {
+		return r.searchMatchInSegments(segments, changeset)
+	}
+
+	return r.searchMatch(line, changeset)
+}
+
+// Checks if line matches the condition of the changeset (--if-line-matches),
+// lines always match without condition
+func lineConditionMatch(line string, changeset Changeset) bool {
+	return changeset.lineCondition == nil || changeset.lineCondition.MatchString(line)
+}
+
+// Replace text in whole content based on search options
+// The first skip matches are kept, afterwards at most max matches are
+// replaced (all if max is negative). Returns the new content,
+// the number of replacements and the number of matches.
+func (r *Replacer) replaceText(content string, changeset Changeset, skip int, max int, position linePosition) (string, int, int) {
+	matches := r.tokenMatches(content, changeset.Search.FindAllStringSubmatchIndex(content, -1))
+	if len(matches) == 0 {
+		return content, 0, 0
+	}
+
+	var ret []byte
+	lastIndex := 0
+	replaceCount := 0
+	for i, match := range matches {
+		if i < skip || (max >= 0 && replaceCount >= max) {
+			continue
+		}
+
+		ret = append(ret, content[lastIndex:match[0]]...)
+
+		if changeset.replaceMap != nil {
+			// --map
+			ret = append(ret, r.mapReplacement(changeset, content[match[0]:match[1]])...)
+		} else if changeset.replaceTemplate != nil {
+			// --go-template
+			ret = r.renderReplaceTemplate(ret, changeset, content, match, position)
+		} else if r.opts.ReplaceCmd != "" {
+			// --replace-cmd
+			// text of --followed-by (the last group) isn't passed to the command and kept
+			end := match[1]
+			if r.opts.FollowedBy != "" {
+				end = match[len(match)-2]
+			}
+			ret = append(ret, r.commandReplacement(content[match[0]:end], position)...)
+			ret = append(ret, content[end:match[1]]...)
+		} else if r.opts.Compute {
+			// --compute
+			ret = append(ret, r.computeReplacement(changeset, content, match, position)...)
+		} else if r.opts.RegexBackref {
+			// --regex-backrefs
+			ret = changeset.Search.ExpandString(ret, r.expandLineContext(r.replaceTermAt(changeset, match[0]), position), content, match)
+		} else {
+			ret = append(ret, r.expandLineContext(r.replaceTermAt(changeset, match[0]), position)...)
+		}
+
+		lastIndex = match[1]
+		replaceCount++
+	}
+	ret = append(ret, content[lastIndex:]...)
+
+	return string(ret), replaceCount, len(matches)
+}
+
+// Lookup replacement of matched word in map (--map)
+func (r *Replacer) mapReplacement(changeset Changeset, word string) string {
+	// --ignore-case
+	if r.opts.CaseInsensitive {
+		word = strings.ToLower(word)
+	}
+
+	return changeset.replaceMap[word]
+}
+
+// Append line to buffer, a missing line ending of the
+// last line of the buffer is added first
+func appendLine(buffer *bytes.Buffer, line string, newline string) {
+	if buffer.Len() > 0 && !bytes.HasSuffix(buffer.Bytes(), []byte("\n")) {
+		buffer.WriteString(newline)
+	}
+	buffer.WriteString(line)
+}
+
+func (r *Replacer) handleLineInFile(changesets []Changeset, buffer bytes.Buffer, newline string) (*bytes.Buffer, bool) {
+	var (
+		line              string
+		writeBufferToFile bool
+	)
+
+	for _, changeset := range changesets {
+		mode := r.changesetMode(changeset)
+		if !changeset.MatchFound && (mode == "lineinfile" || mode == "keyvalue") {
+			// just add line to file
+			line = r.replaceTerm(changeset)
+
+			// --mode=keyvalue, add key with value
+			if mode == "keyvalue" {
+				line = keyValueLine(changeset.SearchPlain, r.opts.KVDelimiter, line)
+			}
+
+			// remove backrefs (no match)
+			if r.opts.RegexBackref {
+				line = regexp.MustCompile("\\$[0-9]+").ReplaceAllLiteralString(line, "")
+			}
+
+			// --go-template, render without match
+			if changeset.replaceTemplate != nil {
+				line = string(r.renderReplaceTemplate(nil, changeset, "", nil, linePosition{}))
+			}
+
+			// --trim-indent
+			line = r.opts.trimIndent("") + line + newline
+
+			// --insert-at
+			switch r.opts.InsertAt {
+			case "top":
+				content := buffer.String()
+				buffer.Reset()
+				buffer.WriteString(line + content)
+			case "before-pattern", "after-pattern":
+				// --lineinfile-before
+				// --lineinfile-after
+				var matchFinder *regexp.Regexp
+
+				if r.opts.InsertAt == "before-pattern" {
+					matchFinder = regexp.MustCompile(r.opts.LineinfileBefore)
+				} else {
+					matchFinder = regexp.MustCompile(r.opts.LineinfileAfter)
+				}
+
+				var bufferCopy bytes.Buffer
+				anchorFound := false
+
+				// lines keep their original line ending
+				reader := bufio.NewReader(&buffer)
+				for {
+					originalLine, lineEnding, err := readLineWithEnding(reader)
+					if err != nil {
+						break
+					}
+
+					if matchFinder.MatchString(originalLine) {
+						anchorFound = true
+
+						if r.opts.InsertAt == "before-pattern" {
+							bufferCopy.WriteString(line)
+						}
+
+						bufferCopy.WriteString(originalLine + lineEnding)
+
+						if r.opts.InsertAt == "after-pattern" {
+							appendLine(&bufferCopy, line, newline)
+						}
+					} else {
+						bufferCopy.WriteString(originalLine + lineEnding)
+					}
+				}
+
+				// anchor not found, append to the bottom
+				if !anchorFound {
+					appendLine(&bufferCopy, line, newline)
+				}
+
+				buffer.Reset()
+				buffer.WriteString(bufferCopy.String())
+			default:
+				appendLine(&buffer, line, newline)
+			}
+			writeBufferToFile = true
+		}
+	}
+
+	return &buffer, writeBufferToFile
+}
@@ -0,0 +1,168 @@
+package goreplace
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ${uuid}, ${random:N} and ${file:path} placeholders of the replace term (--generators)
+var generatorToken = regexp.MustCompile(`\$\{(?:uuid|random:([0-9]{1,4})|file:([^}]+))\}`)
+
+const generatorRandomChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Replace term of changeset, with --generators the placeholders are
+// expanded to new values on each call (once per match)
+// With --cycle-replace each call returns the next term of the list
+func (r *Replacer) replaceTerm(changeset Changeset) string {
+	replace := changeset.Replace
+
+	// --cycle-replace
+	if changeset.cycle != nil {
+		replace = changeset.cycle[*changeset.cycleIndex%len(changeset.cycle)]
+		*changeset.cycleIndex++
+	}
+
+	if !r.opts.Generators {
+		return replace
+	}
+
+	return r.expandGenerators(replace)
+}
+
+// Replace term of a match starting at offset of the line,
+// matches at the start of the line use --replace-at-start if set
+func (r *Replacer) replaceTermAt(changeset Changeset, offset int) string {
+	if offset > 0 || r.opts.ReplaceAtStart == "" {
+		return r.replaceTerm(changeset)
+	}
+
+	if !r.opts.Generators {
+		return r.opts.ReplaceAtStart
+	}
+
+	return r.expandGenerators(r.opts.ReplaceAtStart)
+}
+
+// Expand ${uuid}, ${random:N} and ${file:path} placeholders
+func (r *Replacer) expandGenerators(replace string) string {
+	return generatorToken.ReplaceAllStringFunc(replace, func(token string) string {
+		if token == "${uuid}" {
+			return generateUUID()
+		}
+
+		submatch := generatorToken.FindStringSubmatch(token)
+		if path := submatch[2]; path != "" {
+			content, err := r.snippets.read(path)
+			if err != nil {
+				// files are read when building the changesets already
+				return token
+			}
+
+			// --regex-backrefs, content is no reference
+			if r.opts.RegexBackref {
+				content = strings.Replace(content, "$", "$$", -1)
+			}
+			return content
+		}
+
+		length, _ := strconv.Atoi(submatch[1])
+		return generateRandomString(length)
+	})
+}
+
+// ${prevline} and ${nextline} placeholders of the replace term (--enable-line-context)
+var lineContextToken = regexp.MustCompile(`\$\{(?:prevline|nextline)\}`)
+
+// Expand ${prevline} and ${nextline} to the original lines around the processed line
+func (r *Replacer) expandLineContext(replace string, position linePosition) string {
+	if !r.opts.EnableLineContext {
+		return replace
+	}
+
+	return lineContextToken.ReplaceAllStringFunc(replace, func(token string) string {
+		line := position.Previous
+		if token == "${nextline}" {
+			line = position.Next
+		}
+
+		// --regex-backrefs, line is no reference
+		if r.opts.RegexBackref {
+			line = strings.Replace(line, "$", "$$", -1)
+		}
+		return line
+	})
+}
+
+// Read all files of ${file:path} placeholders in replace term,
+// so missing files are reported before any file is changed
+func (r *Replacer) readSnippets(replace string) error {
+	for _, submatch := range generatorToken.FindAllStringSubmatch(replace, -1) {
+		if path := submatch[2]; path != "" {
+			if _, err := r.snippets.read(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Contents of files inlined with ${file:path}, each file is read only once
+type snippetCache struct {
+	mutex    sync.Mutex
+	contents map[string]string
+}
+
+// Content of file without its last line ending
+func (c *snippetCache) read(path string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if content, ok := c.contents[path]; ok {
+		return content, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	ret := strings.TrimSuffix(strings.TrimSuffix(string(content), "\n"), "\r")
+	c.contents[path] = ret
+	return ret, nil
+}
+
+// Random UUID (version 4)
+func generateUUID() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		panic(err)
+	}
+
+	uuid[6] = (uuid[6] & 0x0f) | 0x40 // version 4
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // variant RFC 4122
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+// Random string of length alphanumeric characters
+func generateRandomString(length int) string {
+	ret := make([]byte, length)
+	max := big.NewInt(int64(len(generatorRandomChars)))
+
+	for i := range ret {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		ret[i] = generatorRandomChars[n.Int64()]
+	}
+
+	return string(ret)
+}
@@ -0,0 +1,189 @@
+package goreplace
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestApplyChangesetsToFileGenerators(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "id=ID token=ID\nid=ID\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:     []string{"ID"},
+		Replace:    []string{"${uuid}/${random:8}"},
+		Generators: true,
+	})
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	generated := regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}/[a-zA-Z0-9]{8}`)
+	values := generated.FindAllString(readTestFile(t, path), -1)
+	if len(values) != 3 {
+		t.Fatalf("expected 3 generated values, got %q", readTestFile(t, path))
+	}
+
+	seen := map[string]bool{}
+	for _, value := range values {
+		if seen[value] {
+			t.Errorf("expected distinct values for each match, got %s twice", value)
+		}
+		seen[value] = true
+	}
+}
+
+func TestBuildChangesetsGeneratorsBackrefs(t *testing.T) {
+	r, err := NewReplacer(Options{
+		Search:       []string{"(id)=[0-9]+"},
+		Replace:      []string{"$1=${random:4}"},
+		Regex:        true,
+		RegexBackref: true,
+		Generators:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.BuildChangesets(); err != nil {
+		t.Errorf("expected generators not to be validated as backrefs, got %s", err)
+	}
+}
+
+func TestApplyChangesetsToFileGeneratorsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	snippet := writeTestFile(t, dir, "snippet.txt", "log($msg)\n")
+	path := writeTestFile(t, dir, "test.txt", "a TODO(1)\nb TODO(2)\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:       []string{`TODO\(([0-9])\)`},
+		Replace:      []string{"${file:" + snippet + "} #$1"},
+		Regex:        true,
+		RegexBackref: true,
+		Generators:   true,
+	})
+
+	// content is cached, later changes of the file are not used
+	if err := ioutil.WriteFile(snippet, []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "a log($msg) #1\nb log($msg) #2\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+func TestBuildChangesetsGeneratorsMissingFile(t *testing.T) {
+	r, err := NewReplacer(Options{
+		Search:     []string{"foo"},
+		Replace:    []string{"${file:/nonexistent/snippet.txt}"},
+		Generators: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.BuildChangesets(); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestApplyChangesetsToFileLineContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(size int64) { streamMinSize = size }(streamMinSize)
+
+	tests := []struct {
+		opts     Options
+		content  string
+		expected string
+	}{
+		{Options{Search: []string{"X"}, Replace: []string{"[${prevline}|${nextline}]"}}, "X\nb\nX\n", "[|b]\nb\n[b|]\n"},
+		{Options{Search: []string{"X"}, Replace: []string{"${prevline}"}}, "a\r\nX\r\n", "a\r\na\r\n"},
+		{Options{Search: []string{"^key:"}, Replace: []string{"key: ${nextline}"}, Mode: "line", Regex: true}, "key: 1\nvalue\n", "key: value\nvalue\n"},
+		{Options{Search: []string{"(X)"}, Replace: []string{"$1${prevline}"}, Regex: true, RegexBackref: true}, "$1 a\nX\n", "$1 a\nX$1 a\n"},
+		{Options{Search: []string{"X"}, Replace: []string{"${nextline}"}}, "X\nX\nc\n", "X\nc\nc\n"},
+	}
+
+	for _, test := range tests {
+		// buffered and streamed
+		for _, size := range []int64{1 << 30, 0} {
+			streamMinSize = size
+			path := writeTestFile(t, dir, "test.txt", test.content)
+
+			opts := test.opts
+			opts.EnableLineContext = true
+			r, changesets := newTestReplacer(t, opts)
+
+			if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := readTestFile(t, path); actual != test.expected {
+				t.Errorf("%q with %q: expected %q, got %q", test.content, test.opts.Replace, test.expected, actual)
+			}
+		}
+	}
+}
+
+func TestApplyChangesetsToReaderLineContext(t *testing.T) {
+	r, changesets := newTestReplacer(t, Options{
+		Search:            []string{"X"},
+		Replace:           []string{"${prevline}-${nextline}"},
+		EnableLineContext: true,
+	})
+
+	var out strings.Builder
+	if err := r.ApplyChangesetsToReader(strings.NewReader("a\nX\nb\n"), &out, "stdin", changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "a\na-b\nb\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestApplyChangesetsToFileLineContextDisabled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "a\nX\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"X"},
+		Replace: []string{"${prevline}"},
+	})
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "a\n${prevline}\n"; readTestFile(t, path) != expected {
+		t.Errorf("expected %q, got %q", expected, readTestFile(t, path))
+	}
+}
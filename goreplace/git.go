@@ -0,0 +1,125 @@
+package goreplace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Runs git and returns its output, replaced in tests
+var runGit = func(args ...string) ([]byte, error) {
+	return exec.Command("git", args...).Output()
+}
+
+// Runs git in dir, the error contains the message of git
+func runGitCommand(dir string, args ...string) ([]byte, error) {
+	output, err := runGit(append([]string{"-C", dir}, args...)...)
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("Unable to get changed files from git for --since-git: %s", err)
+	}
+
+	return output, nil
+}
+
+// Top-level directory of the git repository containing dir, with resolved symlinks
+func gitTopLevel(dir string) (string, error) {
+	// outside of a repository git diff would compare paths instead of failing
+	output, err := runGitCommand(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+
+	return resolvePath(strings.TrimSpace(string(output)))
+}
+
+// Files with changes of tracked files in the git working tree or index of the
+// whole repository at toplevel, as absolute paths with resolved symlinks (--since-git)
+// Untracked files are not included, they have no changes to compare.
+func gitChangedFiles(toplevel string) (map[string]bool, error) {
+	ret := map[string]bool{}
+
+	// names are relative to the top-level directory of the repository
+	for _, args := range [][]string{
+		{"diff", "--name-only", "-z"},
+		{"diff", "--name-only", "-z", "--cached"},
+	} {
+		output, err := runGitCommand(toplevel, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range strings.Split(string(output), "\x00") {
+			if path != "" {
+				ret[filepath.Join(toplevel, filepath.FromSlash(path))] = true
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// Nearest existing directory of path, git can't be run in missing directories
+// (eg. of deleted files)
+func existingDir(path string) string {
+	dir := filepath.Dir(path)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// Remove files without changes in git from the file list (--since-git)
+// git is run in the directory of each file, files of different repositories
+// are compared to the repository they belong to
+func filterGitChangedFiles(fileitems []FileItem) ([]FileItem, error) {
+	toplevels := map[string]string{}             // directory => top-level directory
+	changedFiles := map[string]map[string]bool{} // top-level directory => changed files
+
+	var ret []FileItem
+	for _, file := range fileitems {
+		// missing directories can't be resolved
+		path, err := resolvePath(file.Path)
+		if err != nil {
+			path, err = filepath.Abs(file.Path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		dir := existingDir(path)
+		toplevel, ok := toplevels[dir]
+		if !ok {
+			if toplevel, err = gitTopLevel(dir); err != nil {
+				return nil, err
+			}
+			toplevels[dir] = toplevel
+		}
+
+		changed, ok := changedFiles[toplevel]
+		if !ok {
+			if changed, err = gitChangedFiles(toplevel); err != nil {
+				return nil, err
+			}
+			changedFiles[toplevel] = changed
+		}
+
+		if changed[path] {
+			ret = append(ret, file)
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,151 @@
+package goreplace
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func fakeGit(output map[string]string, err error) func() {
+	original := runGit
+	runGit = func(args ...string) ([]byte, error) {
+		return []byte(output[strings.Join(args, " ")]), err
+	}
+
+	return func() {
+		runGit = original
+	}
+}
+
+func TestBuildFileitemsSinceGit(t *testing.T) {
+	// names are relative to the top-level directory, the current directory is a subdirectory
+	cwd, err := resolvePath(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toplevel, subdir := filepath.Dir(cwd), filepath.Base(cwd)
+
+	// git runs in the nearest existing directory of the files
+	defer fakeGit(map[string]string{
+		"-C " + cwd + " rev-parse --show-toplevel":         toplevel + "\n",
+		"-C " + toplevel + " rev-parse --show-toplevel":    toplevel + "\n",
+		"-C " + toplevel + " diff --name-only -z":          subdir + "/a.txt\x00" + subdir + "/dir/d.txt\x00other/e.txt\x00",
+		"-C " + toplevel + " diff --name-only -z --cached": subdir + "/b.txt\x00",
+	}, nil)()
+
+	r, err := NewReplacer(Options{Search: []string{"foobar"}, Replace: []string{"barfoo"}, SinceGit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileitems, err := r.BuildFileitems(context.Background(), []string{"a.txt", "./b.txt", "c.txt", "dir/d.txt", "../other/e.txt", "../other/f.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, file := range fileitems {
+		paths = append(paths, file.Path)
+	}
+
+	if expected := []string{"a.txt", "./b.txt", "dir/d.txt", "../other/e.txt"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestBuildFileitemsSinceGitError(t *testing.T) {
+	defer fakeGit(nil, errors.New("exit status 128"))()
+
+	r, err := NewReplacer(Options{Search: []string{"foobar"}, Replace: []string{"barfoo"}, SinceGit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.BuildFileitems(context.Background(), []string{"a.txt"}); err == nil {
+		t.Error("expected error if git fails")
+	}
+
+	// --path without files outside of a repository
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err = NewReplacer(Options{Search: []string{"foobar"}, Replace: []string{"barfoo"}, SinceGit: true, Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.BuildFileitems(context.Background(), nil); err == nil {
+		t.Error("expected error if git fails for --path without files")
+	}
+}
+
+func TestBuildFileitemsSinceGitRepositories(t *testing.T) {
+	// files of --path and file arguments in different repositories,
+	// neither of them is the current directory
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = resolvePath(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	for _, repository := range []string{first, second} {
+		if err := os.MkdirAll(filepath.Join(repository, "sub"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, repository, "a.txt", "foobar\n")
+		writeTestFile(t, filepath.Join(repository, "sub"), "b.txt", "foobar\n")
+	}
+
+	var calls []string
+	output := map[string]string{
+		"-C " + first + " rev-parse --show-toplevel":                        first + "\n",
+		"-C " + filepath.Join(first, "sub") + " rev-parse --show-toplevel":  first + "\n",
+		"-C " + first + " diff --name-only -z":                              "sub/b.txt\x00",
+		"-C " + second + " rev-parse --show-toplevel":                       second + "\n",
+		"-C " + filepath.Join(second, "sub") + " rev-parse --show-toplevel": second + "\n",
+		"-C " + second + " diff --name-only -z --cached":                    "a.txt\x00",
+	}
+	defer func(original func(args ...string) ([]byte, error)) { runGit = original }(runGit)
+	runGit = func(args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return []byte(output[strings.Join(args, " ")]), nil
+	}
+
+	r, err := NewReplacer(Options{Search: []string{"foobar"}, Replace: []string{"barfoo"}, SinceGit: true, Path: first})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileitems, err := r.BuildFileitems(context.Background(), []string{filepath.Join(second, "a.txt"), filepath.Join(second, "sub", "b.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, file := range fileitems {
+		paths = append(paths, file.Path)
+	}
+	if expected := []string{filepath.Join(second, "a.txt"), filepath.Join(first, "sub", "b.txt")}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	for _, call := range calls {
+		if !strings.HasPrefix(call, "-C "+first+" ") && !strings.HasPrefix(call, "-C "+filepath.Join(first, "sub")+" ") &&
+			!strings.HasPrefix(call, "-C "+second+" ") && !strings.HasPrefix(call, "-C "+filepath.Join(second, "sub")+" ") {
+			t.Errorf("expected git to run in a repository, got %q", call)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package goreplace
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Translate glob (fnmatch) to regex, * matches any characters (as many as
+// possible), ? one character, [abc] and [!abc] are character classes and
+// \ escapes the next character, unterminated classes are matched literally
+func globToRegex(glob string) string {
+	var buffer strings.Builder
+	runes := []rune(glob)
+
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			buffer.WriteString(".*")
+		case '?':
+			buffer.WriteString(".")
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			buffer.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			end := globClassEnd(runes, i)
+			if end < 0 {
+				buffer.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+
+			buffer.WriteString(globClassToRegex(runes[i+1 : end]))
+			i = end
+		default:
+			buffer.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return buffer.String()
+}
+
+// Index of the ] closing the class starting at start, -1 if it isn't closed
+// A ] directly after [ or [! is part of the class
+func globClassEnd(runes []rune, start int) int {
+	i := start + 1
+	if i < len(runes) && runes[i] == '!' {
+		i++
+	}
+	if i < len(runes) && runes[i] == ']' {
+		i++
+	}
+
+	for ; i < len(runes); i++ {
+		if runes[i] == ']' {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Regex character class of the content of a glob class (without brackets)
+func globClassToRegex(class []rune) string {
+	var buffer strings.Builder
+	buffer.WriteString("[")
+
+	if len(class) > 0 && class[0] == '!' {
+		buffer.WriteString("^")
+		class = class[1:]
+	}
+
+	for _, c := range class {
+		// - is kept for ranges, everything else is literal
+		if c == '\\' || c == '[' || c == ']' || c == '^' {
+			buffer.WriteString("\\")
+		}
+		buffer.WriteRune(c)
+	}
+
+	buffer.WriteString("]")
+	return buffer.String()
+}
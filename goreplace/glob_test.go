@@ -0,0 +1,62 @@
+package goreplace
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlobToRegex(t *testing.T) {
+	tests := []struct {
+		glob    string
+		matches []string
+		misses  []string
+	}{
+		{"foo*bar", []string{"foobar", "foo_x_bar", "a foo-bar b"}, []string{"fobar", "foo"}},
+		{"foo?bar", []string{"foo-bar", "xfoo1barx"}, []string{"foobar", "foo--bar"}},
+		{"v[0-9].[!0-9]", []string{"v1.x", "v9.-"}, []string{"va.x", "v1.2"}},
+		{"a.b+c", []string{"a.b+c"}, []string{"axb+c", "a.bbc"}},
+		{`\*literal\?`, []string{"*literal?"}, []string{"xliteralx"}},
+		{"[]x]", []string{"]", "x"}, []string{"y"}},
+		{"[!]]", []string{"x"}, []string{"]"}},
+		{"[a^]", []string{"^", "a"}, []string{"b"}},
+		{"open[", []string{"open["}, []string{"open"}},
+		{"end\\", []string{"end\\"}, []string{"en"}},
+	}
+
+	for _, test := range tests {
+		regex, err := regexp.Compile(globToRegex(test.glob))
+		if err != nil {
+			t.Errorf("%s: invalid regex %s: %s", test.glob, globToRegex(test.glob), err)
+			continue
+		}
+
+		for _, value := range test.matches {
+			if !regex.MatchString(value) {
+				t.Errorf("%s (%s): expected %q to match", test.glob, regex, value)
+			}
+		}
+		for _, value := range test.misses {
+			if regex.MatchString(value) {
+				t.Errorf("%s (%s): expected %q not to match", test.glob, regex, value)
+			}
+		}
+	}
+}
+
+func TestApplyChangesetsToLineGlob(t *testing.T) {
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foo*bar"},
+		Replace: []string{"baz"},
+		Glob:    true,
+	})
+
+	line, changed, _ := r.ApplyChangesetsToLine("x foo-1-bar y", changesets)
+	if !changed || line != "x baz y" {
+		t.Errorf("expected %q, got %q", "x baz y", line)
+	}
+
+	line, changed, _ = r.ApplyChangesetsToLine("x foo*bar y", resetChangesets(changesets))
+	if !changed || line != "x baz y" {
+		t.Errorf("expected %q, got %q", "x baz y", line)
+	}
+}
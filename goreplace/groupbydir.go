@@ -0,0 +1,61 @@
+package goreplace
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// Changed files and replacements of the processed files in a directory (--group-by-dir)
+type directorySummary struct {
+	Dir          string
+	Files        int
+	FilesChanged int
+	Replacements int
+}
+
+// Summaries of the processed files grouped by their directory, sorted by directory
+func summarizeDirectories(results []ChangeResult) []directorySummary {
+	summaries := map[string]*directorySummary{}
+	for _, result := range results {
+		dir := filepath.Dir(result.File.Path)
+		summary, ok := summaries[dir]
+		if !ok {
+			summary = &directorySummary{Dir: dir}
+			summaries[dir] = summary
+		}
+
+		summary.Files++
+		if result.Changed {
+			summary.FilesChanged++
+		}
+		summary.Replacements += result.Replacements
+	}
+
+	list := make([]directorySummary, 0, len(summaries))
+	for _, summary := range summaries {
+		list = append(list, *summary)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Dir < list[j].Dir
+	})
+
+	return list
+}
+
+// WriteDirectoryReport writes the changed files and replacements of the
+// processed files grouped by their containing directory to w (--group-by-dir)
+func WriteDirectoryReport(w io.Writer, results []ChangeResult) {
+	total := directorySummary{}
+
+	fmt.Fprintln(w, "Directories:")
+	for _, summary := range summarizeDirectories(results) {
+		fmt.Fprintf(w, "  %s: %d of %d file(s) changed, %d replacement(s)\n", summary.Dir, summary.FilesChanged, summary.Files, summary.Replacements)
+
+		total.Files += summary.Files
+		total.FilesChanged += summary.FilesChanged
+		total.Replacements += summary.Replacements
+	}
+	fmt.Fprintf(w, "  total: %d of %d file(s) changed, %d replacement(s)\n", total.FilesChanged, total.Files, total.Replacements)
+}
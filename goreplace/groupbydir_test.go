@@ -0,0 +1,54 @@
+package goreplace
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDirectoryReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, sub := range []string{"a", "a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, dir, "a/one.txt", "foo foo\n")
+	writeTestFile(t, dir, "a/two.txt", "bar\n")
+	writeTestFile(t, dir, "a/b/three.txt", "foo\nfoo\nfoo\n")
+	writeTestFile(t, dir, "c/four.txt", "bar\n")
+
+	r, changesets := newTestReplacer(t, Options{Search: []string{"foo"}, Replace: []string{"bar"}, Path: dir})
+	fileitems, err := r.BuildFileitems(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report bytes.Buffer
+	WriteDirectoryReport(&report, results)
+
+	expected := strings.Join([]string{
+		"Directories:",
+		"  " + filepath.Join(dir, "a") + ": 1 of 2 file(s) changed, 2 replacement(s)",
+		"  " + filepath.Join(dir, "a/b") + ": 1 of 1 file(s) changed, 3 replacement(s)",
+		"  " + filepath.Join(dir, "c") + ": 0 of 1 file(s) changed, 0 replacement(s)",
+		"  total: 2 of 4 file(s) changed, 5 replacement(s)",
+		"",
+	}, "\n")
+	if report.String() != expected {
+		t.Errorf("expected %q, got %q", expected, report.String())
+	}
+}
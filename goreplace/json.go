@@ -0,0 +1,309 @@
+package goreplace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Element of --json-path, either a key of an object or an index of an array
+type jsonPathElement struct {
+	Key   string
+	Index int
+	IsKey bool
+}
+
+// Parse JSON path like .server.host, .servers[0].port or .["key.with.dots"]
+func parseJSONPath(path string) ([]jsonPathElement, error) {
+	if !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "[") {
+		return nil, errors.New("path must start with . or [")
+	}
+
+	var ret []jsonPathElement
+	for i := 0; i < len(path); {
+		switch {
+		case strings.HasPrefix(path[i:], ".["):
+			i++
+		case path[i] == '.':
+			end := i + 1
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			if end == i+1 {
+				return nil, fmt.Errorf("empty key at position %d", i+1)
+			}
+			ret = append(ret, jsonPathElement{Key: path[i+1 : end], IsKey: true})
+			i = end
+		case path[i] == '[':
+			end := strings.IndexByte(path[i:], ']')
+			if strings.HasPrefix(path[i:], `["`) {
+				// quoted key, may contain . and ]
+				end = strings.Index(path[i:], `"]`) + 1
+			}
+			if end <= 0 {
+				return nil, fmt.Errorf("missing ] at position %d", i+1)
+			}
+
+			element := path[i+1 : i+end]
+			if strings.HasPrefix(element, `"`) {
+				key, err := strconv.Unquote(element)
+				if err != nil {
+					return nil, fmt.Errorf("invalid key %s", element)
+				}
+				ret = append(ret, jsonPathElement{Key: key, IsKey: true})
+			} else {
+				index, err := strconv.Atoi(element)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid index %s", element)
+				}
+				ret = append(ret, jsonPathElement{Index: index})
+			}
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("unexpected %q at position %d", path[i], i+1)
+		}
+	}
+
+	return ret, nil
+}
+
+// JSON value of the replace term, terms which are no valid JSON are used as string
+func jsonReplaceValue(replace string) []byte {
+	if json.Valid([]byte(replace)) {
+		var buffer bytes.Buffer
+		if err := json.Compact(&buffer, []byte(replace)); err == nil {
+			return buffer.Bytes()
+		}
+	}
+
+	value, _ := json.Marshal(replace)
+	return value
+}
+
+// Minimal scanner of valid JSON, only used to find the position of values
+type jsonScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *jsonScanner) skipWhitespace() {
+	for s.pos < len(s.data) && strings.IndexByte(" \t\r\n", s.data[s.pos]) >= 0 {
+		s.pos++
+	}
+}
+
+// Skip value at the current position, returns start and end of the value
+func (s *jsonScanner) skipValue() (int, int) {
+	s.skipWhitespace()
+	start := s.pos
+
+	switch s.data[s.pos] {
+	case '{', '[':
+		// strings may contain brackets, everything else is counted
+		depth := 0
+		for ; s.pos < len(s.data); s.pos++ {
+			switch s.data[s.pos] {
+			case '"':
+				s.skipString()
+				s.pos--
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			if depth == 0 {
+				s.pos++
+				break
+			}
+		}
+	case '"':
+		s.skipString()
+	default:
+		// number, true, false or null
+		for s.pos < len(s.data) && strings.IndexByte(",]} \t\r\n", s.data[s.pos]) < 0 {
+			s.pos++
+		}
+	}
+
+	return start, s.pos
+}
+
+// Skip string at the current position including its quotes
+func (s *jsonScanner) skipString() {
+	for s.pos++; s.pos < len(s.data); s.pos++ {
+		if s.data[s.pos] == '\\' {
+			s.pos++
+		} else if s.data[s.pos] == '"' {
+			s.pos++
+			return
+		}
+	}
+}
+
+// Skip comma or expect end of object or array, returns false at the end
+func (s *jsonScanner) next() bool {
+	s.skipWhitespace()
+	if s.data[s.pos] == ',' {
+		s.pos++
+		return true
+	}
+
+	return false
+}
+
+// Find start and end of the value at path, ok is false if path doesn't exist
+// Of duplicate keys the last one is used like JSON decoders do.
+func (s *jsonScanner) find(path []jsonPathElement) (int, int, bool) {
+	if len(path) == 0 {
+		start, end := s.skipValue()
+		return start, end, true
+	}
+
+	s.skipWhitespace()
+	element := path[0]
+
+	switch s.data[s.pos] {
+	case '{':
+		if !element.IsKey {
+			return 0, 0, false
+		}
+
+		s.pos++
+		s.skipWhitespace()
+		if s.data[s.pos] == '}' {
+			return 0, 0, false
+		}
+
+		// position of the value of the last matching key
+		found := -1
+		for {
+			keyStart, keyEnd := s.skipValue()
+			var key string
+			if err := json.Unmarshal(s.data[keyStart:keyEnd], &key); err != nil {
+				return 0, 0, false
+			}
+
+			// colon
+			s.skipWhitespace()
+			s.pos++
+
+			if key == element.Key {
+				found = s.pos
+			}
+
+			s.skipValue()
+			if !s.next() {
+				break
+			}
+		}
+
+		if found < 0 {
+			return 0, 0, false
+		}
+		s.pos = found
+		return s.find(path[1:])
+	case '[':
+		if element.IsKey {
+			return 0, 0, false
+		}
+
+		s.pos++
+		s.skipWhitespace()
+		if s.data[s.pos] == ']' {
+			return 0, 0, false
+		}
+
+		for i := 0; ; i++ {
+			if i == element.Index {
+				return s.find(path[1:])
+			}
+
+			s.skipValue()
+			if !s.next() {
+				return 0, 0, false
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// Replace scalar value at --json-path in JSON content, formatting of the content is kept
+// Returns the new content and if the path was found, objects and arrays are an error
+func replaceJSONValue(content []byte, path []jsonPathElement, value []byte) ([]byte, bool, error) {
+	if !json.Valid(content) {
+		return nil, false, errors.New("invalid JSON")
+	}
+
+	scanner := &jsonScanner{data: content}
+	start, end, ok := scanner.find(path)
+	if !ok {
+		return content, false, nil
+	}
+
+	// objects and arrays are not replaced as a whole
+	if content[start] == '{' || content[start] == '[' {
+		return nil, false, errors.New("value at --json-path is no scalar")
+	}
+
+	ret := make([]byte, 0, len(content)-(end-start)+len(value))
+	ret = append(ret, content[:start]...)
+	ret = append(ret, value...)
+	ret = append(ret, content[end:]...)
+
+	return ret, true, nil
+}
+
+// Replace value at --json-path in file (--mode=json)
+func (r *Replacer) applyJSONToFile(fileitem FileItem, changesets []Changeset) ChangeResult {
+	content, err := r.readFile(fileitem.Path)
+	if err != nil {
+		return ChangeResult{File: fileitem, Error: err}
+	}
+
+	changeset := changesets[0]
+	replaced, found, err := replaceJSONValue(content, r.opts.jsonPath, jsonReplaceValue(changeset.Replace))
+	if err != nil {
+		return ChangeResult{File: fileitem, Error: fmt.Errorf("%s: %s", fileitem.Path, err)}
+	} else if !found {
+		return ChangeResult{File: fileitem, Output: fmt.Sprintf("%s no match", fileitem.Path)}
+	}
+
+	result := ChangeResult{File: fileitem, Matched: true, Searches: []string{changeset.SearchPlain}}
+	if bytes.Equal(replaced, content) && fileitem.Output == fileitem.Path && !r.opts.ForceWrite {
+		result.Output = fmt.Sprintf("%s not changed, replacements are identical", fileitem.Path)
+		return result
+	}
+
+	result.Replacements = 1
+	result.Changes = []ChangeCount{{changeset.SearchPlain, changeset.Replace, 1}}
+
+	var buffer bytes.Buffer
+	buffer.Write(replaced)
+	result.Output, result.Error = r.writeContentToFile(fileitem, buffer)
+	result.Changed = result.Error == nil
+
+	return result
+}
+
+// Replace value at --json-path in the JSON document read from in (--mode=json),
+// the document is written unchanged if the path doesn't exist
+func (r *Replacer) applyJSONToReader(in io.Reader, out io.Writer, name string, changesets []Changeset) error {
+	content, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	replaced, _, err := replaceJSONValue(content, r.opts.jsonPath, jsonReplaceValue(changesets[0].Replace))
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	_, err = out.Write(replaced)
+	return err
+}
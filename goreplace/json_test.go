@@ -0,0 +1,141 @@
+package goreplace
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []jsonPathElement
+	}{
+		{".server.host", []jsonPathElement{{Key: "server", IsKey: true}, {Key: "host", IsKey: true}}},
+		{".servers[1].port", []jsonPathElement{{Key: "servers", IsKey: true}, {Index: 1}, {Key: "port", IsKey: true}}},
+		{`.["a.b"].c`, []jsonPathElement{{Key: "a.b", IsKey: true}, {Key: "c", IsKey: true}}},
+		{"[0]", []jsonPathElement{{Index: 0}}},
+	}
+
+	for _, test := range tests {
+		path, err := parseJSONPath(test.path)
+		if err != nil {
+			t.Errorf("%s: %s", test.path, err)
+			continue
+		}
+
+		if len(path) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.path, test.expected, path)
+			continue
+		}
+		for i := range path {
+			if path[i] != test.expected[i] {
+				t.Errorf("%s: expected %v, got %v", test.path, test.expected, path)
+			}
+		}
+	}
+
+	for _, path := range []string{"", "server", ".", "..a", ".a[", ".a[x]", ".a[-1]", `.["a]`} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("%s: expected error", path)
+		}
+	}
+}
+
+func TestReplaceJSONValue(t *testing.T) {
+	content := `{
+  "name": "app",
+  "server": {
+    "host": "localhost",
+    "ports": [80, 443],
+    "tags": {"a]": "{[\"x"}
+  },
+  "debug": false
+}
+`
+
+	tests := []struct {
+		path     string
+		value    string
+		expected string
+		found    bool
+	}{
+		{".server.host", "example.com", strings.Replace(content, `"localhost"`, `"example.com"`, 1), true},
+		{".server.ports[1]", "8443", strings.Replace(content, `443]`, `8443]`, 1), true},
+		{".debug", "true", strings.Replace(content, `false`, `true`, 1), true},
+		{".name", `{"b": 1}`, strings.Replace(content, `"app"`, `{"b":1}`, 1), true},
+		{".server.missing", "x", content, false},
+		{".server.ports[2]", "x", content, false},
+		{".name.sub", "x", content, false},
+	}
+
+	for _, test := range tests {
+		path, err := parseJSONPath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		replaced, found, err := replaceJSONValue([]byte(content), path, jsonReplaceValue(test.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.found {
+			t.Errorf("%s: expected found=%v, got %v", test.path, test.found, found)
+		}
+		if string(replaced) != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.path, test.expected, replaced)
+		}
+	}
+
+	if _, _, err := replaceJSONValue([]byte(`{"a": `), nil, nil); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+
+	// objects and arrays are not replaced as a whole
+	for _, jsonPath := range []string{".server", ".server.ports", ".server.tags"} {
+		path, err := parseJSONPath(jsonPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := replaceJSONValue([]byte(content), path, jsonReplaceValue("x")); err == nil {
+			t.Errorf("%s: expected error for value which is no scalar", jsonPath)
+		}
+	}
+
+	// decoders use the last of duplicate keys
+	path, err := parseJSONPath(".a.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	duplicate := `{"a": {"b": 1}, "a": {"b": 2, "b": 3}}`
+	replaced, found, err := replaceJSONValue([]byte(duplicate), path, jsonReplaceValue("4"))
+	if expected := `{"a": {"b": 1}, "a": {"b": 2, "b": 4}}`; err != nil || !found || string(replaced) != expected {
+		t.Errorf("expected %s, got %s (%v)", expected, replaced, err)
+	}
+}
+
+func TestApplyJSONToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "config.json", "{\n    \"server\": {\"host\": \"localhost\", \"port\": 80}\n}\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Mode:     "json",
+		JSONPath: ".server.host",
+		Replace:  []string{"example.com"},
+	})
+
+	if result := r.processFile(FileItem{path, path}, changesets); result.Error != nil || !result.Changed {
+		t.Fatalf("expected file to be changed, got %v", result.Error)
+	}
+
+	expected := "{\n    \"server\": {\"host\": \"example.com\", \"port\": 80}\n}\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
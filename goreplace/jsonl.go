@@ -0,0 +1,78 @@
+package goreplace
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// One result line of --output-format=jsonl
+type jsonlResult struct {
+	Path         string `json:"path"`
+	Status       string `json:"status"`
+	Changed      bool   `json:"changed"`
+	Replacements int    `json:"replacements"`
+	Error        string `json:"error,omitempty"`
+}
+
+func newJSONLResult(result ChangeResult) jsonlResult {
+	ret := jsonlResult{
+		Path:         result.File.Path,
+		Status:       "unchanged",
+		Changed:      result.Changed,
+		Replacements: result.Replacements,
+	}
+
+	if result.Error != nil {
+		ret.Status = "error"
+		ret.Error = result.Error.Error()
+	} else if result.Changed {
+		ret.Status = "changed"
+	}
+
+	return ret
+}
+
+// JSONLWriter returns a result handler (see Replacer.OnResult) which
+// writes each result as one JSON object per line to w
+func JSONLWriter(w io.Writer) func(ChangeResult) {
+	encoder := json.NewEncoder(w)
+
+	return func(result ChangeResult) {
+		encoder.Encode(newJSONLResult(result))
+	}
+}
+
+// Aggregated results of a run (--summary-json)
+type jsonSummary struct {
+	FilesScanned int           `json:"files_scanned"`
+	FilesChanged int           `json:"files_changed"`
+	Replacements int           `json:"replacements"`
+	Errors       int           `json:"errors"`
+	Files        []jsonlResult `json:"files"`
+}
+
+// WriteSummaryJSON writes totals and a per file breakdown of the results
+// as JSON document to filename
+func WriteSummaryJSON(filename string, results []ChangeResult) error {
+	summary := jsonSummary{Files: []jsonlResult{}}
+
+	for _, result := range results {
+		summary.FilesScanned++
+		if result.Changed {
+			summary.FilesChanged++
+		}
+		if result.Error != nil {
+			summary.Errors++
+		}
+		summary.Replacements += result.Replacements
+
+		summary.Files = append(summary.Files, newJSONLResult(result))
+	}
+
+	content, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filename, append(content, '\n'), 0644)
+}
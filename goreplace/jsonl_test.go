@@ -0,0 +1,111 @@
+package goreplace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessFilesJSONL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	changed := writeTestFile(t, dir, "changed.txt", "foo foo\nbar\nfoo\n")
+	unchanged := writeTestFile(t, dir, "unchanged.txt", "bar\n")
+	missing := filepath.Join(dir, "missing.txt")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foo"},
+		Replace: []string{"baz"},
+	})
+
+	var stream bytes.Buffer
+	r.OnResult = JSONLWriter(&stream)
+
+	fileitems := []FileItem{{changed, changed}, {unchanged, unchanged}, {missing, missing}}
+	if _, err := r.ProcessFiles(context.Background(), changesets, fileitems); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]jsonlResult{
+		changed:   {Path: changed, Status: "changed", Changed: true, Replacements: 3},
+		unchanged: {Path: unchanged, Status: "unchanged"},
+		missing:   {Path: missing, Status: "error"},
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(&stream)
+	for scanner.Scan() {
+		lines++
+
+		var line jsonlResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %d is no valid JSON: %s (%q)", lines, err, scanner.Text())
+		}
+
+		if line.Status == "error" && line.Error == "" {
+			t.Errorf("%s: expected error message", line.Path)
+		}
+		line.Error = ""
+
+		if line != expected[line.Path] {
+			t.Errorf("expected %+v, got %+v", expected[line.Path], line)
+		}
+	}
+
+	if lines != len(fileitems) {
+		t.Errorf("expected %d lines, got %d", len(fileitems), lines)
+	}
+}
+
+func TestWriteSummaryJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	changed := writeTestFile(t, dir, "changed.txt", "foo foo\nfoo\n")
+	unchanged := writeTestFile(t, dir, "unchanged.txt", "bar\n")
+	missing := filepath.Join(dir, "missing.txt")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foo"},
+		Replace: []string{"baz"},
+	})
+
+	fileitems := []FileItem{{changed, changed}, {unchanged, unchanged}, {missing, missing}}
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summaryFile := filepath.Join(dir, "summary.json")
+	if err := WriteSummaryJSON(summaryFile, results); err != nil {
+		t.Fatal(err)
+	}
+
+	var summary jsonSummary
+	if err := json.Unmarshal([]byte(readTestFile(t, summaryFile)), &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.FilesScanned != 3 || summary.FilesChanged != 1 || summary.Replacements != 3 || summary.Errors != 1 {
+		t.Errorf("expected 3 files scanned, 1 changed, 3 replacements and 1 error, got %+v", summary)
+	}
+
+	if len(summary.Files) != 3 {
+		t.Fatalf("expected 3 files, got %d", len(summary.Files))
+	}
+	if file := summary.Files[0]; file.Path != changed || file.Replacements != 3 {
+		t.Errorf("expected %s with 3 replacements, got %+v", changed, file)
+	}
+}
@@ -0,0 +1,22 @@
+package goreplace
+
+import (
+	"regexp"
+)
+
+// Regex matching the start of a key=value line up to the value (--mode=keyvalue),
+// key is the regex of the search term. Indentation, "export" (.env files) and
+// spaces around the delimiter are part of the match and kept.
+func keyValuePrefixRegex(key string, delimiter string) string {
+	return "^[ \t]*(?:export[ \t]+)?(?:" + key + ")[ \t]*" + regexp.QuoteMeta(delimiter) + "[ \t]*"
+}
+
+// Line added for a missing key (--mode=keyvalue)
+func keyValueLine(key string, delimiter string, value string) string {
+	// --kv-delimiter=:, yaml like style
+	if delimiter == ":" {
+		return key + ": " + value
+	}
+
+	return key + delimiter + value
+}
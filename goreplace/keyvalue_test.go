@@ -0,0 +1,65 @@
+package goreplace
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestApplyChangesetsToFileKeyValue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		opts     Options
+		content  string
+		expected string
+	}{
+		// update existing keys, comments, blank lines and order are kept
+		{
+			Options{Search: []string{"DB_HOST", "DB_PORT"}, Replace: []string{"db.local", "5433"}},
+			"# database\nDB_HOST=localhost\n\n# DB_PORT=1\nexport DB_PORT = 5432\nDB_HOST_RO=replica\n",
+			"# database\nDB_HOST=db.local\n\n# DB_PORT=1\nexport DB_PORT = 5433\nDB_HOST_RO=replica\n",
+		},
+		// add missing key
+		{
+			Options{Search: []string{"DEBUG"}, Replace: []string{"false"}},
+			"# app\nAPP_ENV=prod\n",
+			"# app\nAPP_ENV=prod\nDEBUG=false\n",
+		},
+		// key: value style
+		{
+			Options{Search: []string{"server.port", "server.host"}, Replace: []string{"8080", "0.0.0.0"}, KVDelimiter: ":"},
+			"server.port:  80\n! comment\n",
+			"server.port:  8080\n! comment\nserver.host: 0.0.0.0\n",
+		},
+		// key names are case sensitive unless --ignore-case is used
+		{
+			Options{Search: []string{"debug"}, Replace: []string{"1"}, CaseInsensitive: true},
+			"DEBUG=0\n",
+			"DEBUG=1\n",
+		},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.env", test.content)
+
+		opts := test.opts
+		opts.Mode = "keyvalue"
+		if opts.KVDelimiter == "" {
+			opts.KVDelimiter = "="
+		}
+		r, changesets := newTestReplacer(t, opts)
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := readTestFile(t, path); actual != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.content, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package goreplace
+
+import (
+	"strings"
+)
+
+// Kinds of code segments (--in)
+const (
+	segmentCode    = "code"
+	segmentComment = "comment"
+	segmentString  = "string"
+)
+
+// Part of a line which is code, comment or string
+type codeSegment struct {
+	Kind string
+	Text string
+}
+
+// String literal delimiter of a language
+type codeQuote struct {
+	Delimiter string
+	Escape    bool // backslash escapes the next character
+	Multiline bool // literal can span multiple lines
+}
+
+// Tokenizer rules of a language (--lang)
+type codeLanguage struct {
+	LineComment          string
+	LineCommentWordStart bool // line comment only starts at the beginning of a word
+	BlockCommentStart    string
+	BlockCommentEnd      string
+	Quotes               []codeQuote
+	CodeEscape           bool // backslash escapes the next character in code
+}
+
+var codeLanguages = map[string]codeLanguage{
+	"go": {
+		LineComment:       "//",
+		BlockCommentStart: "/*",
+		BlockCommentEnd:   "*/",
+		Quotes: []codeQuote{
+			{Delimiter: `"`, Escape: true},
+			{Delimiter: "'", Escape: true},
+			{Delimiter: "`", Multiline: true},
+		},
+	},
+	"shell": {
+		LineComment:          "#",
+		LineCommentWordStart: true,
+		Quotes: []codeQuote{
+			{Delimiter: `"`, Escape: true, Multiline: true},
+			{Delimiter: "'", Multiline: true},
+		},
+		CodeEscape: true,
+	},
+}
+
+// Splits lines into code, comment and string segments,
+// keeps state of multiline comments and strings between lines
+type codeScanner struct {
+	lang           codeLanguage
+	quote          *codeQuote
+	inBlockComment bool
+	quotedOnly     bool // --skip-quoted, only balanced quotes on a line
+}
+
+// Create scanner for --lang or --skip-quoted, nil if not set
+func (r *Replacer) newCodeScanner() *codeScanner {
+	if r.opts.SkipQuoted {
+		return &codeScanner{quotedOnly: true}
+	} else if r.opts.Lang == "" {
+		return nil
+	}
+
+	return &codeScanner{lang: codeLanguages[r.opts.Lang]}
+}
+
+// Kind of segments which are searched and replaced (--in),
+// --skip-quoted only uses code outside of quotes
+func (r *Replacer) selectedSegment() string {
+	if r.opts.SkipQuoted {
+		return segmentCode
+	}
+
+	return r.opts.In
+}
+
+// Kind of segment at the current state
+func (s *codeScanner) kind() string {
+	if s.quote != nil {
+		return segmentString
+	} else if s.inBlockComment {
+		return segmentComment
+	}
+
+	return segmentCode
+}
+
+// Split line into segments, delimiters (quotes, comment markers)
+// are part of the string or comment segment
+func (s *codeScanner) scan(line string) []codeSegment {
+	if s.quotedOnly {
+		return scanQuoted(line)
+	}
+
+	segments := []codeSegment{}
+	start := 0
+	kind := s.kind()
+
+	// end current segment at position end, next segment is of kind next
+	split := func(end int, next string) {
+		if end > start {
+			segments = append(segments, codeSegment{kind, line[start:end]})
+		}
+		start = end
+		kind = next
+	}
+
+	for i := 0; i < len(line); {
+		switch {
+		case s.quote != nil:
+			if s.quote.Escape && line[i] == '\\' {
+				i += 2
+			} else if strings.HasPrefix(line[i:], s.quote.Delimiter) {
+				i += len(s.quote.Delimiter)
+				s.quote = nil
+				split(i, segmentCode)
+			} else {
+				i++
+			}
+
+		case s.inBlockComment:
+			if strings.HasPrefix(line[i:], s.lang.BlockCommentEnd) {
+				i += len(s.lang.BlockCommentEnd)
+				s.inBlockComment = false
+				split(i, segmentCode)
+			} else {
+				i++
+			}
+
+		default:
+			if s.lang.CodeEscape && line[i] == '\\' {
+				i += 2
+				continue
+			}
+
+			if s.isLineComment(line, i) {
+				// comment until end of line
+				split(i, segmentComment)
+				i = len(line)
+				continue
+			}
+
+			if s.lang.BlockCommentStart != "" && strings.HasPrefix(line[i:], s.lang.BlockCommentStart) {
+				split(i, segmentComment)
+				i += len(s.lang.BlockCommentStart)
+				s.inBlockComment = true
+				continue
+			}
+
+			if quote := s.quoteAt(line, i); quote != nil {
+				split(i, segmentString)
+				i += len(quote.Delimiter)
+				s.quote = quote
+				continue
+			}
+
+			i++
+		}
+	}
+	split(len(line), kind)
+
+	// unterminated single line string ends with the line
+	if s.quote != nil && !s.quote.Multiline {
+		s.quote = nil
+	}
+
+	return segments
+}
+
+// Split line into code and quoted string segments (--skip-quoted)
+// A quote only starts a string if it is closed on the same line, a single
+// quote inside of a word (eg. "don't") is an apostrophe and no quote.
+func scanQuoted(line string) []codeSegment {
+	segments := []codeSegment{}
+	start := 0
+
+	for i := 0; i < len(line); i++ {
+		if line[i] != '"' && line[i] != '\'' {
+			continue
+		}
+
+		if line[i] == '\'' && i > 0 && isWordByte(line[i-1]) {
+			continue
+		}
+
+		end := closingQuote(line, i)
+		if end < 0 {
+			continue
+		}
+
+		if i > start {
+			segments = append(segments, codeSegment{segmentCode, line[start:i]})
+		}
+		segments = append(segments, codeSegment{segmentString, line[i : end+1]})
+		start = end + 1
+		i = end
+	}
+
+	if start < len(line) {
+		segments = append(segments, codeSegment{segmentCode, line[start:]})
+	}
+
+	return segments
+}
+
+// Position of the quote closing the quote at position i, -1 if it isn't closed
+// Backslash escapes the next character.
+func closingQuote(line string, i int) int {
+	for n := i + 1; n < len(line); n++ {
+		if line[n] == '\\' {
+			n++
+		} else if line[n] == line[i] {
+			return n
+		}
+	}
+
+	return -1
+}
+
+// Checks if character is part of a word
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// Checks if a line comment starts at position i
+func (s *codeScanner) isLineComment(line string, i int) bool {
+	if s.lang.LineComment == "" || !strings.HasPrefix(line[i:], s.lang.LineComment) {
+		return false
+	}
+
+	// --lang=shell, # inside of a word is no comment
+	if s.lang.LineCommentWordStart && i > 0 {
+		return strings.IndexByte(" \t;&|()", line[i-1]) >= 0
+	}
+
+	return true
+}
+
+// Returns the quote starting at position i, nil if there is none
+func (s *codeScanner) quoteAt(line string, i int) *codeQuote {
+	for n := range s.lang.Quotes {
+		if strings.HasPrefix(line[i:], s.lang.Quotes[n].Delimiter) {
+			return &s.lang.Quotes[n]
+		}
+	}
+
+	return nil
+}
+
+// Join segments to line
+func joinSegments(segments []codeSegment) string {
+	var ret strings.Builder
+	for _, segment := range segments {
+		ret.WriteString(segment.Text)
+	}
+
+	return ret.String()
+}
+
+// Checks if there is a match in the segments selected by --in or --skip-quoted
+func (r *Replacer) searchMatchInSegments(segments []codeSegment, changeset Changeset) bool {
+	for _, segment := range segments {
+		if segment.Kind == r.selectedSegment() && r.searchMatch(segment.Text, changeset) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Replace text only in the segments selected by --in or --skip-quoted,
+// skip and max apply to the whole line like in replaceText
+func (r *Replacer) replaceTextInSegments(segments []codeSegment, changeset Changeset, skip int, max int, position linePosition) (int, int) {
+	replaceCount := 0
+	matchCount := 0
+
+	for n, segment := range segments {
+		if segment.Kind != r.selectedSegment() {
+			continue
+		}
+
+		segmentMax := max
+		if max >= 0 {
+			segmentMax = max - replaceCount
+		}
+
+		text, segmentReplaceCount, segmentMatchCount := r.replaceTextPasses(segment.Text, changeset, skip, segmentMax, position)
+		segments[n].Text = text
+
+		if skip -= segmentMatchCount; skip < 0 {
+			skip = 0
+		}
+		replaceCount += segmentReplaceCount
+		matchCount += segmentMatchCount
+	}
+
+	return replaceCount, matchCount
+}
@@ -0,0 +1,135 @@
+package goreplace
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCodeScannerScan(t *testing.T) {
+	tests := []struct {
+		lang     string
+		lines    []string
+		expected [][]codeSegment
+	}{
+		{
+			"go",
+			[]string{`x := "a // b" // comment`},
+			[][]codeSegment{{{"code", "x := "}, {"string", `"a // b"`}, {"code", " "}, {"comment", "// comment"}}},
+		},
+		{
+			"go",
+			[]string{`s := "a \" b" + /* c */ 'x'`},
+			[][]codeSegment{{{"code", "s := "}, {"string", `"a \" b"`}, {"code", " + "}, {"comment", "/* c */"}, {"code", " "}, {"string", "'x'"}}},
+		},
+		{
+			"go",
+			[]string{"/* start", "end */ x := `raw", "string`"},
+			[][]codeSegment{
+				{{"comment", "/* start"}},
+				{{"comment", "end */"}, {"code", " x := "}, {"string", "`raw"}},
+				{{"string", "string`"}},
+			},
+		},
+		{
+			"shell",
+			[]string{`echo "a # b" foo#bar # comment`, `echo 'multi`, `line' \# x`},
+			[][]codeSegment{
+				{{"code", "echo "}, {"string", `"a # b"`}, {"code", " foo#bar "}, {"comment", "# comment"}},
+				{{"code", "echo "}, {"string", "'multi"}},
+				{{"string", "line'"}, {"code", ` \# x`}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		scanner := &codeScanner{lang: codeLanguages[test.lang]}
+		for i, line := range test.lines {
+			if segments := scanner.scan(line); !reflect.DeepEqual(segments, test.expected[i]) {
+				t.Errorf("--lang=%s %q: expected %v, got %v", test.lang, line, test.expected[i], segments)
+			}
+		}
+	}
+}
+
+func TestApplyChangesetsToFileIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "// foobar\nx := \"foobar\" // foobar\nfoobar()\n"
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"code", "// foobar\nx := \"foobar\" // foobar\nbarfoo()\n"},
+		{"comment", "// barfoo\nx := \"foobar\" // barfoo\nfoobar()\n"},
+		{"string", "// foobar\nx := \"barfoo\" // foobar\nfoobar()\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.go", content)
+
+		r, changesets := newTestReplacer(t, Options{
+			Search:  []string{"foobar"},
+			Replace: []string{"barfoo"},
+			Lang:    "go",
+			In:      test.in,
+		})
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if content := readTestFile(t, path); content != test.expected {
+			t.Errorf("--in=%s: expected %q, got %q", test.in, test.expected, content)
+		}
+	}
+}
+
+func TestScanQuoted(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []codeSegment
+	}{
+		{`a = "foo" + 'foo' foo`, []codeSegment{{"code", "a = "}, {"string", `"foo"`}, {"code", " + "}, {"string", "'foo'"}, {"code", " foo"}}},
+		{`"a \" b" c`, []codeSegment{{"string", `"a \" b"`}, {"code", " c"}}},
+		{`don't 'quote' it's`, []codeSegment{{"code", "don't "}, {"string", "'quote'"}, {"code", " it's"}}},
+		{`unclosed "foo`, []codeSegment{{"code", `unclosed "foo`}}},
+		{"", []codeSegment{}},
+	}
+
+	for _, test := range tests {
+		if segments := scanQuoted(test.line); !reflect.DeepEqual(segments, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.line, test.expected, segments)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileSkipQuoted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.conf", "name = foo # \"foo\"\nlabel = 'foo' foo\nfoo \"foo\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:     []string{"foo"},
+		Replace:    []string{"bar"},
+		SkipQuoted: true,
+	})
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "name = bar # \"foo\"\nlabel = 'foo' bar\nbar \"bar\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
@@ -0,0 +1,149 @@
+package goreplace
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Line after applying the changesets and the line options
+type processedLine struct {
+	original       string // line as read
+	originalEnding string // line ending as read
+	text           string // new line
+	ending         string // new line ending (--line-ending)
+	changed        bool   // line was changed by changesets, --dedupe-adjacent or --strip-trailing-whitespace
+	skip           bool   // line is removed
+}
+
+// Reads lines and applies changesets and the line options (--dedupe-adjacent,
+// --strip-trailing-whitespace, --line-ending), used for buffered and streamed
+// files as well as readers so all of them process lines the same way
+type lineProcessor struct {
+	r          *Replacer
+	reader     *bufio.Reader
+	name       string
+	changesets []Changeset
+	scanner    *codeScanner
+
+	lineNumber   int
+	previousLine string
+
+	// one line lookahead for ${nextline} (--enable-line-context)
+	nextLine       string
+	nextLineEnding string
+	nextErr        error
+	hasNextLine    bool
+
+	// last written line for --dedupe-adjacent
+	lastLine        string
+	lastLineChanged bool
+	hasLastLine     bool
+}
+
+// Line processor for the lines of reader, name is used as file name for the line position
+func (r *Replacer) newLineProcessor(reader *bufio.Reader, name string, changesets []Changeset) *lineProcessor {
+	return &lineProcessor{r: r, reader: reader, name: name, changesets: changesets, scanner: r.newCodeScanner()}
+}
+
+// Reads and processes the next line, returns io.EOF after the last line
+func (p *lineProcessor) next() (processedLine, error) {
+	var (
+		line, lineEnding string
+		err              error
+	)
+
+	if p.hasNextLine {
+		line, lineEnding, err = p.nextLine, p.nextLineEnding, p.nextErr
+		p.hasNextLine = false
+	} else {
+		line, lineEnding, err = readLineWithEnding(p.reader)
+	}
+	if err != nil {
+		return processedLine{}, err
+	}
+
+	p.lineNumber++
+	position := linePosition{p.name, p.lineNumber, p.previousLine, ""}
+	p.previousLine = line
+
+	// --enable-line-context
+	// only read ahead if needed, so lines of a pipe are processed without waiting for the next one
+	if p.r.opts.EnableLineContext {
+		p.nextLine, p.nextLineEnding, p.nextErr = readLineWithEnding(p.reader)
+		p.hasNextLine = true
+		position.Next = p.nextLine
+	}
+
+	text, changed, skip := p.r.applyChangesetsToLine(line, p.changesets, position, p.scanner)
+
+	// --dedupe-adjacent
+	// remove line identical to the previous line if one of them was replaced
+	if p.r.opts.DedupeAdjacent && !skip && p.hasLastLine && text == p.lastLine && (changed || p.lastLineChanged) {
+		skip = true
+		changed = true
+	}
+
+	if !skip {
+		p.lastLine, p.lastLineChanged, p.hasLastLine = text, changed, true
+	}
+
+	// --strip-trailing-whitespace
+	// applied to all lines, also to lines without match
+	if p.r.opts.StripTrailingWS && !skip {
+		if stripped := strings.TrimRight(text, " \t"); stripped != text {
+			text = stripped
+			changed = true
+		}
+	}
+
+	return processedLine{line, lineEnding, text, p.r.lineEnding(lineEnding), changed, skip}, nil
+}
+
+// Result of a file whose lines were processed with changesets
+func newChangeResult(fileitem FileItem, changesets []Changeset) ChangeResult {
+	return ChangeResult{File: fileitem, Matched: changesetsMatched(changesets), Searches: matchedSearches(changesets), Replacements: countReplacements(changesets), Changes: changeCounts(changesets)}
+}
+
+// Output of a file without changes
+func (r *Replacer) unchangedOutput(result ChangeResult) string {
+	// --total-limit, matches are left because the limit was reached
+	if result.Matched && r.totalLimitRemaining(nil) == 0 {
+		return fmt.Sprintf("%s skipped, --total-limit reached", result.File.Path)
+	}
+
+	return fmt.Sprintf("%s no match", result.File.Path)
+}
+
+// Checks if the changes of a file are written, identical is true if the new content
+// equals the file. Otherwise result describes why the file is not changed.
+func (r *Replacer) writeChanges(result *ChangeResult, identical bool) bool {
+	// --force-write
+	// keep file (and its mtime) if replacing had no effect, eg. search term equals replace term
+	if !r.opts.ForceWrite && identical {
+		result.Output = fmt.Sprintf("%s not changed, replacements are identical", result.File.Path)
+		result.Replacements = 0
+		result.Changes = nil
+		return false
+	}
+
+	// --max-replacements-per-file
+	// safety valve for overly broad patterns, leave file untouched
+	if max := r.opts.MaxReplacements; max > 0 && result.Replacements > max {
+		r.logWarning(fmt.Sprintf("%s: %d replacements exceed --max-replacements-per-file=%d, file not changed", result.File.Path, result.Replacements, max))
+		result.Output = fmt.Sprintf("%s skipped, too many replacements", result.File.Path)
+		result.Replacements = 0
+		result.Changes = nil
+		return false
+	}
+
+	// --total-limit
+	if !r.reserveTotalLimit(result.Replacements) {
+		result.Output = fmt.Sprintf("%s skipped, --total-limit reached", result.File.Path)
+		result.Replacements = 0
+		result.Changes = nil
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,55 @@
+package goreplace
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLineProcessorReaderAndFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// files and stdin process lines the same way
+	tests := []struct {
+		opts    Options
+		content string
+	}{
+		{Options{}, "a\nfoo\nb\n"},
+		{Options{DedupeAdjacent: true}, "bar\nfoo\nb\n"},
+		{Options{StripTrailingWS: true}, "a \nfoo\t\r\nb"},
+		{Options{StripTrailingWS: true, DedupeAdjacent: true}, "bar \nfoo\n"},
+		{Options{LineEnding: "crlf"}, "a\nfoo"},
+		{Options{EnableLineContext: true}, "a\nfoo\nb\n"},
+	}
+
+	for _, test := range tests {
+		opts := test.opts
+		opts.Search = []string{"foo"}
+		opts.Replace = []string{"bar"}
+		if opts.EnableLineContext {
+			opts.Replace = []string{"${prevline}${nextline}"}
+		}
+
+		path := writeTestFile(t, dir, "test.txt", test.content)
+		r, changesets := newTestReplacer(t, opts)
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		r, changesets = newTestReplacer(t, opts)
+		var out bytes.Buffer
+		if err := r.ApplyChangesetsToReader(strings.NewReader(test.content), &out, "-", changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := readTestFile(t, path); out.String() != expected {
+			t.Errorf("%+v %q: expected %q like the file, got %q", test.opts, test.content, expected, out.String())
+		}
+	}
+}
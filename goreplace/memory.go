@@ -0,0 +1,86 @@
+package goreplace
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Weighted semaphore of the memory used by files processed at the same time
+// (--memory-limit), the memory of a file is estimated by its size
+type memoryLimiter struct {
+	mutex sync.Mutex
+	limit int64
+	used  int64
+
+	// closed (and replaced) whenever memory is released
+	released chan struct{}
+}
+
+func newMemoryLimiter(limit int64) *memoryLimiter {
+	return &memoryLimiter{limit: limit, released: make(chan struct{})}
+}
+
+// Wait until size fits into the limit and reserve it, a file larger
+// than the limit is processed when no other file is processed
+func (l *memoryLimiter) acquire(ctx context.Context, size int64) error {
+	for {
+		l.mutex.Lock()
+		if l.used == 0 || l.used+size <= l.limit {
+			l.used += size
+			l.mutex.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// Release memory reserved by acquire
+func (l *memoryLimiter) release(size int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.used -= size
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// Estimated memory of processing a file, the whole content is buffered
+func (r *Replacer) estimateFileMemory(fileitem FileItem) int64 {
+	info, err := r.FileSystem.Stat(fileitem.Path)
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// Parse a size in bytes with an optional unit K, M or G (1024 based), eg. 512M
+func parseByteSize(value string) (int64, error) {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+
+	value = strings.TrimSuffix(strings.ToUpper(value), "B")
+	multiplier := int64(1)
+	if len(value) > 0 {
+		if unit, found := units[value[len(value)-1:]]; found {
+			multiplier = unit
+			value = value[:len(value)-1]
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, errors.New("expected a positive number of bytes with optional unit K, M or G")
+	}
+
+	return size * multiplier, nil
+}
@@ -0,0 +1,123 @@
+package goreplace
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	limiter := newMemoryLimiter(100)
+	ctx := context.Background()
+
+	if err := limiter.acquire(ctx, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	// second file doesn't fit until the first one is released
+	acquired := make(chan error)
+	go func() {
+		acquired <- limiter.acquire(ctx, 60)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected second file to wait for memory")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	limiter.release(60)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	limiter.release(60)
+
+	// file larger than the limit is processed alone
+	if err := limiter.acquire(ctx, 500); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := limiter.acquire(cancelled, 1); err != context.Canceled {
+		t.Errorf("expected cancelled wait, got %v", err)
+	}
+}
+
+func TestProcessFilesMemoryLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fileitems []FileItem
+	for i := 0; i < 6; i++ {
+		path := writeTestFile(t, dir, fmt.Sprintf("test%d.txt", i), strings.Repeat("foo\n", 250))
+		fileitems = append(fileitems, FileItem{path, path})
+	}
+
+	// files have 1000 bytes, two of them fit into the limit
+	r, changesets := newTestReplacer(t, Options{
+		Search:      []string{"foo"},
+		Replace:     []string{"bar"},
+		ThreadCount: 6,
+		MemoryLimit: "2500",
+	})
+
+	var (
+		mutex   sync.Mutex
+		running int
+		maximum int
+	)
+	r.FileSystem = writeHookFS{osFS{}, func(filename string, content []byte, perm os.FileMode) error {
+		mutex.Lock()
+		running++
+		if running > maximum {
+			maximum = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		return writeFileAtomic(filename, content, perm)
+	}}
+
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if !result.Changed {
+			t.Errorf("expected %s to be changed, got %v", result.File.Path, result.Error)
+		}
+	}
+	if maximum > 2 {
+		t.Errorf("expected at most 2 files processed at the same time, got %d", maximum)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{"100": 100, "4k": 4096, "512M": 512 << 20, "1GB": 1 << 30}
+	for value, expected := range tests {
+		if size, err := parseByteSize(value); err != nil || size != expected {
+			t.Errorf("%s: expected %d, got %d (%v)", value, expected, size, err)
+		}
+	}
+
+	for _, value := range []string{"", "M", "-1", "0", "1T"} {
+		if _, err := parseByteSize(value); err == nil {
+			t.Errorf("%s: expected error", value)
+		}
+	}
+}
@@ -0,0 +1,1170 @@
+package goreplace
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options controls how changesets are built and applied to files
+type Options struct {
+	ThreadCount        int    `           long:"threads"                       description:"Set thread concurrency for replacing in multiple files at same time" default:"20"`
+	Mode               string `short:"m"  long:"mode"                          description:"replacement mode - replace: replace match with term; line: replace line with term; lineinfile: replace line with term or if not found append to term to file; prepend: add term to start of matching lines; append: add term to end of matching lines; template: parse content as golang template, search value have to start uppercase; json: replace value at --json-path with replace term; keyvalue: set value of the key (search term) in .env or .properties files, missing keys are appended; yaml: replace scalar value at --yaml-path with replace term, comments and formatting are kept" default:"replace" choice:"replace" choice:"line" choice:"lineinfile" choice:"prepend" choice:"append" choice:"template" choice:"json" choice:"keyvalue" choice:"yaml"`
+	ModeIsReplaceMatch bool
+	ModeIsReplaceLine  bool
+	ModeIsLineInFile   bool
+	ModeIsPrepend      bool
+	ModeIsAppend       bool
+	ModeIsTemplate     bool
+	ModeIsJSON         bool
+	ModeIsKeyValue     bool
+	ModeIsYAML         bool
+	Search             []string `short:"s"  long:"search"                        description:"search term"`
+	Replace            []string `short:"r"  long:"replace"                       description:"replacement term"`
+	ReplaceAtStart     string   `           long:"replace-at-start"              description:"replacement term for matches at the start of a line, --replace is used for other matches (only in replace mode)"`
+	CycleReplace       string   `           long:"cycle-replace"                 description:"replace successive matches of a search term in a file with these terms in turn (comma separated, eg. A,B,C), used instead of --replace"`
+	InterpretEscapes   bool     `           long:"interpret-escapes"             description:"interpret \\n, \\t, \\r and \\\\ in replace terms as newline, tab, carriage return and backslash, eg. to add multiple lines"`
+	JSONPath           string   `           long:"json-path"                     description:"path of the scalar value to replace in --mode=json, eg. .server.host or .servers[0].port"`
+	YAMLPath           string   `           long:"yaml-path"                     description:"path of the scalar value to replace in --mode=yaml, eg. .spec.replicas or .steps[0].image"`
+	KVDelimiter        string   `           long:"kv-delimiter"                  description:"delimiter of key and value in --mode=keyvalue (key=value or key: value)" default:"=" choice:"=" choice:":"`
+	SearchFile         string   `           long:"search-file"                   description:"read additional search terms from file (one per line), a single replace term is used for all of them"`
+	RulesJSON          string   `           long:"rules-json"                    description:"read rules from JSON file, an array of {search, replace, mode, regex, ignoreCase, once} objects (unset settings use the options)"`
+	DedupeChangesets   bool     `           long:"dedupe-changesets"             description:"check all search terms (including --search-file and --rules-json) before processing, duplicates are removed and search terms with different replace terms are reported as warning"`
+	StrictRules        bool     `           long:"strict-rules"                  description:"duplicate or conflicting search terms found by --dedupe-changesets are an error"`
+	Map                string   `           long:"map"                           description:"replace whole words with the values of a map file (one from=to per line) in a single pass (only in replace mode)"`
+	LineinfileBefore   string   `           long:"lineinfile-before"             description:"add line before this regex"`
+	LineinfileAfter    string   `           long:"lineinfile-after"              description:"add line after this regex"`
+	InsertAt           string   `           long:"insert-at"                     description:"where lines are added in lineinfile mode if not found, before-pattern and after-pattern use --lineinfile-before and --lineinfile-after and fall back to bottom (default: bottom)" choice:"top" choice:"bottom" choice:"before-pattern" choice:"after-pattern"`
+	CaseInsensitive    bool     `short:"i"  long:"case-insensitive"              description:"ignore case of pattern to match upper and lowercase characters"`
+	OnlyLines          string   `           long:"only-lines"                    description:"only replace in these lines (1-based, eg. 3,7,12-15)"`
+	EnsureHeader       string   `           long:"ensure-header"                 description:"prepend this header (file or text) to files which don't start with it already, search terms are optional (not available in --mode=template)"`
+	IfLineMatches      string   `           long:"if-line-matches"               description:"only replace in lines which also match this regex (not available in --mode=template)"`
+	MinIndent          int      `           long:"min-indent"                    description:"only replace in lines indented by at least N columns (tabs are expanded with --tab-width)"`
+	MaxIndent          *int     `           long:"max-indent"                    description:"only replace in lines indented by at most N columns, 0 for top-level lines (tabs are expanded with --tab-width)"`
+	FollowedBy         string   `           long:"followed-by"                   description:"only replace matches followed by this regex, the following text is kept (lookahead, only in replace mode)"`
+	InvertMatch        bool     `           long:"invert-match"                  description:"replace lines not matching the search term, an empty replace term removes them and keeps only matching lines like grep (only in line mode)"`
+	Trim               bool     `           long:"trim"                          description:"ignore leading and trailing whitespace of lines when matching (indentation is kept, replaced lines in line mode keep it unless --trim-indent is used)"`
+	TrimIndent         *string  `           long:"trim-indent"                   description:"indentation prepended to replaced and added lines in line and lineinfile mode when using --trim, replaced lines keep their own indentation without it"`
+	PreserveIndent     bool     `           long:"preserve-indent"               description:"prepend the indentation of the matched line to the replace term in line and lineinfile mode"`
+	Lang               string   `           long:"lang"                          description:"language of the files, used to find code, comments and strings for --in" choice:"go" choice:"shell"`
+	In                 string   `           long:"in"                            description:"only replace inside code, comments or strings (requires --lang, only in replace mode)" choice:"code" choice:"comment" choice:"string"`
+	TokenChars         string   `           long:"token-chars"                   description:"only replace complete tokens, matches must not be preceded or followed by these characters (character class, default: [A-Za-z0-9_])" optional:"true" optional-value:"[A-Za-z0-9_]"`
+	SkipQuoted         bool     `           long:"skip-quoted"                   description:"don't replace inside single or double quoted strings on a line, without --lang (only in replace mode)"`
+	Output             string   `short:"o"  long:"output"                        description:"write changes to this file (in one file mode)"`
+	OutputStripFileExt string   `           long:"output-strip-ext"              description:"strip file extension from written files (also available in multi file mode)"`
+	OutputDir          string   `           long:"output-dir"                    description:"write changed files to this directory instead of in place, keeping their path relative to --path (or the current directory for file arguments)"`
+	OutputTemplate     string   `           long:"output-template"               description:"write changed files to this path instead of in place, eg. {dir}/{name}.generated{ext} (variables: {dir}, {name}, {ext}, {base})"`
+	CopyUnchanged      bool     `           long:"copy-unchanged"                description:"also copy files without match to --output-dir or --output-template"`
+	SqueezeWhitespace  bool     `           long:"squeeze-whitespace"            description:"collapse runs of spaces and tabs into one space in replaced lines, indentation is kept (only in replace mode)"`
+	DropEmptyLines     bool     `           long:"drop-empty-lines"              description:"remove lines which are empty (or only whitespace) after replacing, eg. when deleting matches with an empty replace term (only in replace mode)"`
+	RemoveEmptyFiles   bool     `           long:"remove-empty-files"            description:"remove files instead of writing them if they are empty after replacing (eg. with --drop-empty-lines)"`
+	DedupeAdjacent     bool     `           long:"dedupe-adjacent"               description:"remove identical consecutive lines if one of them was replaced"`
+	LineEnding         string   `           long:"line-ending"                   description:"line ending of written lines - keep: keep line ending of each line; lf: convert to LF (dos2unix); crlf: convert to CRLF (unix2dos)" default:"keep" choice:"keep" choice:"lf" choice:"crlf"`
+	NoNewlineAtEOF     bool     `           long:"no-newline-at-eof"             description:"remove all line endings at the end of written files"`
+	EnsureNewlineAtEOF bool     `           long:"ensure-newline-at-eof"         description:"end written files with exactly one line ending (empty files are kept)"`
+	StripTrailingWS    bool     `           long:"strip-trailing-whitespace"     description:"remove trailing spaces and tabs from all lines of a file, not only from replaced lines, search terms are optional (not available in --mode=template)"`
+	PreserveBOM        string   `           long:"preserve-bom"                  description:"keep UTF-8 byte order mark at the start of files (yes) or remove it (no), it is never matched as part of the first line" optional:"true" optional-value:"yes" default:"yes" choice:"yes" choice:"no"`
+	Once               string   `           long:"once"                          description:"replace search term only one in a file, keep duplicaes (keep, default) or remove them (unique)" optional:"true" optional-value:"keep" choice:"keep" choice:"unique"`
+	OncePerLine        bool     `           long:"once-per-line"                 description:"replace only the first match of a search term in each line, other matches in the line are kept (only in replace mode)"`
+	Limit              int      `           long:"limit"                         description:"replace search term at most N times in a file (--once is the same as --limit=1)"`
+	Nth                int      `           long:"nth"                           description:"only replace the Nth occurrence of search term in a file (Nth matching line in line mode)"`
+	Repeat             int      `           long:"repeat"                        description:"repeat replacing in each line until it doesn't change anymore, at most N passes (only in replace mode)" optional:"true" optional-value:"100"`
+	MaxReplacements    int      `           long:"max-replacements-per-file"     description:"leave file untouched if more than N replacements would be made in it"`
+	TotalLimit         int      `           long:"total-limit"                   description:"replace at most N matches in all files together, the file reaching the limit is changed partially and the remaining files are left untouched (files are processed one after another)"`
+	Rename             string   `           long:"rename"                        description:"also rename files by replacing in their basename (content: also replace content, default; only: only rename files)" optional:"true" optional-value:"content" choice:"content" choice:"only"`
+	ParagraphMode      bool     `           long:"paragraph-mode"                description:"replace within paragraphs (lines separated by blank lines), search terms can match across lines but not across blank lines (only in replace mode)"`
+	Concat             bool     `           long:"concat"                        description:"process all files as one document, search terms can match across lines and files, replacements are written to the file where the match starts (only in replace mode)"`
+	Regex              bool     `           long:"regex"                         description:"treat pattern as regex"`
+	Glob               bool     `           long:"glob"                          description:"treat pattern as glob (* any characters, ? one character, [abc] and [!abc] character classes, \\ escapes), matched within lines"`
+	RegexBackref       bool     `           long:"regex-backrefs"                description:"enable backreferences in replace term"`
+	ReplaceEscape      bool     `           long:"replace-escape"                description:"keep dollars in the replace term which are no reference to a group of the search term literally (eg. $5 without 5 groups), requires --regex-backrefs"`
+	RegexPosix         bool     `           long:"regex-posix"                   description:"parse regex term as POSIX regex"`
+	RegexTimeout       string   `           long:"regex-timeout"                 description:"skip files with a warning if processing takes longer than this duration (eg. 5s), a line in progress can't be interrupted and keeps using CPU until it is done"`
+	Compute            bool     `           long:"compute"                       description:"replace term is an arithmetic expression (+, -, *, /, %, parentheses) of numbers and captured groups like ${1} * 2 + ${2} (only in replace mode, requires --regex)"`
+	ReplaceCmd         string   `           long:"replace-cmd"                   description:"replace each match with the output of this command, the match is passed on stdin or replaces {} in the command (arguments can be quoted like in a shell), identical matches run the command once, files are not changed if it fails (only in replace mode, instead of --replace)"`
+	GoTemplate         bool     `           long:"go-template"                   description:"parse replace term as golang template with .Match, .Groups, .File and .Line of each match"`
+	Generators         bool     `           long:"generators"                    description:"expand ${uuid}, ${random:N} (N random characters) and ${file:path} (content of file) in the replace term to new values for each match"`
+	EnableLineContext  bool     `           long:"enable-line-context"           description:"expand ${prevline} and ${nextline} in the replace term to the original line before and after the processed line (empty at the start and end of the file)"`
+	Path               string   `           long:"path"                          description:"use files in this path"`
+	Root               string   `           long:"root"                          description:"refuse to write files outside of this directory (symlinks are resolved), such files are reported as error"`
+	MaxDepth           string   `           long:"max-depth"                     description:"descend at most N directory levels below --path (0: only files directly in --path)"`
+	SkipHidden         bool     `           long:"skip-hidden"                   description:"skip hidden files and directories (name starting with a dot) in --path"`
+	PathPattern        string   `           long:"path-pattern"                  description:"file pattern (* for wildcard, only basename of file)"`
+	PathRegex          string   `           long:"path-regex"                    description:"file pattern (regex, full path)"`
+	PathRegexNot       string   `           long:"path-regex-not"                description:"exclude files matching this pattern (regex, full path), eg. /vendor/"`
+	ExplainSkips       bool     `           long:"explain-skips"                 description:"log why files and directories below --path are skipped on stderr (ignored directory, --path-pattern, ...)"`
+	Watch              bool     `           long:"watch"                         description:"keep running after processing and process files below --path again when they change (file system events, polled each second if unavailable, stop with Ctrl-C)"`
+	RequireContent     string   `           long:"require-content"               description:"only process files which contain this regex (eg. a license header), other files are skipped"`
+	NewerThan          string   `           long:"newer-than"                    description:"only use files modified after this time (RFC3339 timestamp or duration like 2h), also for file arguments (same as --modified-after)"`
+	MinSize            string   `           long:"min-size"                      description:"only use files of at least this size, eg. 10K (units K, M, G), also for file arguments"`
+	MaxSize            string   `           long:"max-size"                      description:"only use files of at most this size, eg. 1M (units K, M, G), also for file arguments"`
+	ModifiedAfter      string   `           long:"modified-after"                description:"only use files modified after this time (RFC3339 timestamp or duration like 2h), also for file arguments"`
+	ModifiedBefore     string   `           long:"modified-before"               description:"only use files modified before this time (RFC3339 timestamp or duration like 2h), also for file arguments"`
+	NameRegex          string   `           long:"name-regex"                    description:"only use files with a name (basename) matching this regex, also for file arguments"`
+	SinceGit           bool     `           long:"since-git"                     description:"only use files with changes in the git working tree or index of their repository (git diff), untracked files are not included"`
+	Check              bool     `           long:"check"                         description:"don't change files, only report matches of search terms as file:line: match (replace terms are optional)"`
+	Locations          bool     `           long:"locations"                     description:"don't change files, only report matches of search terms as file:line:column:offset: match (replace terms are optional)"`
+	FilesWithMatches   bool     `short:"l"  long:"files-with-matches"            description:"don't change files, only list paths of files with matches of search terms, one per line (replace terms are optional)"`
+	ScanTar            bool     `           long:"scan-tar"                      description:"also search files inside of .tar archives, reported as archive.tar/path (read-only, only with --check, --locations or --files-with-matches)"`
+	Context            int      `short:"C"  long:"context"                       description:"also report N lines before and after each match as file-line- text with --check or --locations, groups of lines are separated by --"`
+	TabWidth           int      `           long:"tab-width"                     description:"count tabs up to the next multiple of N columns in columns reported by --locations and in indentation of --min-indent and --max-indent (default: tabs are one column)"`
+	Distinct           bool     `           long:"distinct"                      description:"also report the number of matches and of distinct matched strings of each file as file: N matches, M distinct with --check or --locations"`
+	MemoryLimit        string   `           long:"memory-limit"                  description:"limit the estimated memory (file sizes) of files processed at the same time, eg. 512M, larger files are processed alone (units K, M, G)"`
+	Parallel           string   `           long:"parallel"                      description:"files: process multiple files at the same time (see --threads); none: process one file after another" default:"files" choice:"files" choice:"none"`
+	ForceWrite         bool     `           long:"force-write"                   description:"write files even if replacing didn't change the content (eg. search term equals replace term)"`
+	ValidateCmd        string   `           long:"validate-cmd"                  description:"run this command for each written file (path is appended or replaces {}, arguments can be quoted like in a shell), the original content is restored if it fails"`
+	Retry              int      `           long:"retry"                         description:"retry writing a file up to N times (after 100ms, 200ms, 400ms, ...) if it is locked by another process, eg. a virus scanner"`
+	Verbose            bool     `short:"v"  long:"verbose"                       description:"verbose mode"`
+	DryRun             bool     `           long:"dry-run"                       description:"dry run mode"`
+	Preview            bool     `           long:"preview"                       description:"show original and replaced lines side by side (requires --dry-run)"`
+	Sample             int      `           long:"sample"                        description:"show original and replaced lines of the first N changed lines of all files (in order) and stop (requires --dry-run)"`
+	Diff               bool     `           long:"diff"                          description:"show changes as unified diff of the original and the final content of each file after all search terms (requires --dry-run)"`
+	PatchFile          string   `           long:"patch-file"                    description:"write the changes of all files as one patch with a/ and b/ path prefixes to this file, it can be applied with git apply or patch -p1 (requires --dry-run)"`
+
+	// parsed option values
+	newerThan      time.Time
+	regexTimeout   time.Duration
+	root           string
+	requireContent *regexp.Regexp
+	maxDepth       int
+	onlyLines      []lineRange
+	header         string
+	cycleReplace   []string
+	jsonPath       []jsonPathElement
+	yamlPath       []jsonPathElement
+	tokenChars     *regexp.Regexp
+	memoryLimit    int64
+	minSize        int64
+	maxSize        int64
+	modifiedAfter  time.Time
+	modifiedBefore time.Time
+	nameRegex      *regexp.Regexp
+	validateCmd    []string
+	replaceCmd     []string
+
+	// --followed-by without --regex-backrefs, $ in replace terms is literal
+	followedByLiteral bool
+}
+
+// Set mode flags and validate option combinations
+func (opts *Options) init() error {
+	// --mode
+	switch mode := opts.Mode; mode {
+	case "", "replace":
+		opts.ModeIsReplaceMatch = true
+		opts.ModeIsReplaceLine = false
+		opts.ModeIsLineInFile = false
+		opts.ModeIsPrepend = false
+		opts.ModeIsAppend = false
+		opts.ModeIsTemplate = false
+		opts.ModeIsJSON = false
+		opts.ModeIsKeyValue = false
+		opts.ModeIsYAML = false
+	case "line":
+		opts.ModeIsReplaceMatch = false
+		opts.ModeIsReplaceLine = true
+		opts.ModeIsLineInFile = false
+		opts.ModeIsPrepend = false
+		opts.ModeIsAppend = false
+		opts.ModeIsTemplate = false
+		opts.ModeIsJSON = false
+		opts.ModeIsKeyValue = false
+		opts.ModeIsYAML = false
+	case "lineinfile":
+		opts.ModeIsReplaceMatch = false
+		opts.ModeIsReplaceLine = false
+		opts.ModeIsLineInFile = true
+		opts.ModeIsPrepend = false
+		opts.ModeIsAppend = false
+		opts.ModeIsTemplate = false
+		opts.ModeIsJSON = false
+		opts.ModeIsKeyValue = false
+		opts.ModeIsYAML = false
+	case "prepend":
+		opts.ModeIsReplaceMatch = false
+		opts.ModeIsReplaceLine = false
+		opts.ModeIsLineInFile = false
+		opts.ModeIsPrepend = true
+		opts.ModeIsAppend = false
+		opts.ModeIsTemplate = false
+		opts.ModeIsJSON = false
+		opts.ModeIsKeyValue = false
+		opts.ModeIsYAML = false
+	case "append":
+		opts.ModeIsReplaceMatch = false
+		opts.ModeIsReplaceLine = false
+		opts.ModeIsLineInFile = false
+		opts.ModeIsPrepend = false
+		opts.ModeIsAppend = true
+		opts.ModeIsTemplate = false
+		opts.ModeIsJSON = false
+		opts.ModeIsKeyValue = false
+		opts.ModeIsYAML = false
+	case "template":
+		opts.ModeIsReplaceMatch = false
+		opts.ModeIsReplaceLine = false
+		opts.ModeIsLineInFile = false
+		opts.ModeIsPrepend = false
+		opts.ModeIsAppend = false
+		opts.ModeIsTemplate = true
+		opts.ModeIsJSON = false
+		opts.ModeIsKeyValue = false
+		opts.ModeIsYAML = false
+	case "json":
+		opts.ModeIsReplaceMatch = false
+		opts.ModeIsReplaceLine = false
+		opts.ModeIsLineInFile = false
+		opts.ModeIsPrepend = false
+		opts.ModeIsAppend = false
+		opts.ModeIsTemplate = false
+		opts.ModeIsJSON = true
+		opts.ModeIsKeyValue = false
+		opts.ModeIsYAML = false
+	case "keyvalue":
+		opts.ModeIsReplaceMatch = false
+		opts.ModeIsReplaceLine = false
+		opts.ModeIsLineInFile = false
+		opts.ModeIsPrepend = false
+		opts.ModeIsAppend = false
+		opts.ModeIsTemplate = false
+		opts.ModeIsJSON = false
+		opts.ModeIsKeyValue = true
+		opts.ModeIsYAML = false
+	case "yaml":
+		opts.ModeIsReplaceMatch = false
+		opts.ModeIsReplaceLine = false
+		opts.ModeIsLineInFile = false
+		opts.ModeIsPrepend = false
+		opts.ModeIsAppend = false
+		opts.ModeIsTemplate = false
+		opts.ModeIsJSON = false
+		opts.ModeIsKeyValue = false
+		opts.ModeIsYAML = true
+	default:
+		return errors.New("Invalid mode " + mode)
+	}
+
+	if opts.LineinfileBefore != "" || opts.LineinfileAfter != "" {
+		if !opts.ModeIsLineInFile {
+			return errors.New("--lineinfile-after and --lineinfile-before only valid in --mode=lineinfile")
+		}
+
+		if opts.LineinfileBefore != "" && opts.LineinfileAfter != "" {
+			return errors.New("Only --lineinfile-after or --lineinfile-before is allowed in --mode=lineinfile")
+		}
+	}
+
+	// --json-path
+	if opts.ModeIsJSON {
+		if opts.JSONPath == "" {
+			return errors.New("--mode=json requires --json-path")
+		}
+
+		if len(opts.Search) > 0 || opts.SearchFile != "" || opts.RulesJSON != "" || opts.Map != "" || opts.CycleReplace != "" {
+			return errors.New("--mode=json uses --json-path instead of --search, --search-file, --rules-json, --map or --cycle-replace")
+		}
+
+		if len(opts.Replace) != 1 {
+			return errors.New("--mode=json requires exactly one --replace")
+		}
+
+		if opts.Check || opts.Locations || opts.Concat || opts.Rename != "" || opts.Preview || opts.Sample > 0 || opts.GoTemplate || opts.Generators {
+			return errors.New("--mode=json can't be used together with --check, --locations, --concat, --rename, --preview, --sample, --go-template or --generators")
+		}
+
+		jsonPath, err := parseJSONPath(opts.JSONPath)
+		if err != nil {
+			return fmt.Errorf("Invalid --json-path \"%s\": %s", opts.JSONPath, err)
+		}
+		opts.jsonPath = jsonPath
+	} else if opts.JSONPath != "" {
+		return errors.New("--json-path is only valid in --mode=json")
+	}
+
+	// --yaml-path
+	if opts.ModeIsYAML {
+		if opts.YAMLPath == "" {
+			return errors.New("--mode=yaml requires --yaml-path")
+		}
+
+		if len(opts.Search) > 0 || opts.SearchFile != "" || opts.RulesJSON != "" || opts.Map != "" || opts.CycleReplace != "" {
+			return errors.New("--mode=yaml uses --yaml-path instead of --search, --search-file, --rules-json, --map or --cycle-replace")
+		}
+
+		if len(opts.Replace) != 1 {
+			return errors.New("--mode=yaml requires exactly one --replace")
+		}
+
+		if opts.Check || opts.Locations || opts.Concat || opts.Rename != "" || opts.Preview || opts.Sample > 0 || opts.GoTemplate || opts.Generators {
+			return errors.New("--mode=yaml can't be used together with --check, --locations, --concat, --rename, --preview, --sample, --go-template or --generators")
+		}
+
+		yamlPath, err := parseJSONPath(opts.YAMLPath)
+		if err != nil {
+			return fmt.Errorf("Invalid --yaml-path \"%s\": %s", opts.YAMLPath, err)
+		}
+		opts.yamlPath = yamlPath
+	} else if opts.YAMLPath != "" {
+		return errors.New("--yaml-path is only valid in --mode=yaml")
+	}
+
+	// --mode=keyvalue
+	if opts.ModeIsKeyValue {
+		if opts.RegexBackref || opts.Compute || opts.Map != "" || opts.CycleReplace != "" || opts.RulesJSON != "" || opts.Concat {
+			return errors.New("--mode=keyvalue can't be used together with --regex-backrefs, --compute, --map, --cycle-replace, --rules-json or --concat")
+		}
+	}
+
+	// --insert-at
+	if opts.InsertAt != "" && !opts.ModeIsLineInFile {
+		return errors.New("--insert-at is only valid in --mode=lineinfile")
+	}
+	switch opts.InsertAt {
+	case "":
+		// position defined by --lineinfile-before or --lineinfile-after
+		if opts.LineinfileBefore != "" {
+			opts.InsertAt = "before-pattern"
+		} else if opts.LineinfileAfter != "" {
+			opts.InsertAt = "after-pattern"
+		} else {
+			opts.InsertAt = "bottom"
+		}
+	case "top", "bottom":
+		if opts.LineinfileBefore != "" || opts.LineinfileAfter != "" {
+			return fmt.Errorf("--insert-at=%s can't be used together with --lineinfile-before or --lineinfile-after", opts.InsertAt)
+		}
+	case "before-pattern":
+		if opts.LineinfileBefore == "" {
+			return errors.New("--insert-at=before-pattern requires --lineinfile-before")
+		}
+	case "after-pattern":
+		if opts.LineinfileAfter == "" {
+			return errors.New("--insert-at=after-pattern requires --lineinfile-after")
+		}
+	default:
+		return fmt.Errorf("Invalid --insert-at \"%s\"", opts.InsertAt)
+	}
+
+	// --path-regex
+	// --path-regex-not
+	// --lineinfile-before
+	// --lineinfile-after
+	// --if-line-matches
+	for _, regex := range []string{opts.PathRegex, opts.PathRegexNot, opts.LineinfileBefore, opts.LineinfileAfter, opts.IfLineMatches} {
+		if _, err := regexp.Compile(regex); err != nil {
+			return fmt.Errorf("Invalid regular expression \"%s\": %s", regex, err)
+		}
+	}
+
+	// --invert-match
+	if opts.InvertMatch {
+		if !opts.ModeIsReplaceLine {
+			return errors.New("--invert-match is only valid in --mode=line")
+		}
+
+		if opts.RegexBackref {
+			return errors.New("--invert-match can't be used together with --regex-backrefs")
+		}
+	}
+
+	// --map
+	if opts.Map != "" {
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--map is only valid in --mode=replace")
+		}
+
+		if len(opts.Search) > 0 || len(opts.Replace) > 0 || opts.SearchFile != "" || opts.RulesJSON != "" {
+			return errors.New("--map can't be used together with --search, --replace, --search-file or --rules-json")
+		}
+
+		if opts.Regex || opts.Glob || opts.RegexBackref || opts.GoTemplate {
+			return errors.New("--map can't be used together with --regex, --glob, --regex-backrefs or --go-template")
+		}
+	}
+
+	// --cycle-replace
+	if opts.CycleReplace != "" {
+		if len(opts.Replace) > 0 {
+			return errors.New("--cycle-replace can't be used together with --replace")
+		}
+
+		if opts.ModeIsTemplate || opts.GoTemplate || opts.Compute || opts.Map != "" || opts.RulesJSON != "" || opts.Rename != "" {
+			return errors.New("--cycle-replace can't be used together with --mode=template, --go-template, --compute, --map, --rules-json or --rename")
+		}
+		opts.cycleReplace = strings.Split(opts.CycleReplace, ",")
+	}
+
+	// --replace-at-start
+	if opts.ReplaceAtStart != "" {
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--replace-at-start is only valid in --mode=replace")
+		}
+
+		if opts.GoTemplate || opts.Compute || opts.Map != "" || opts.RulesJSON != "" || opts.CycleReplace != "" || opts.Lang != "" || opts.SkipQuoted || opts.Concat {
+			return errors.New("--replace-at-start can't be used together with --go-template, --compute, --map, --rules-json, --cycle-replace, --lang, --skip-quoted or --concat")
+		}
+	}
+
+	// --glob
+	if opts.Glob && opts.Regex {
+		return errors.New("--glob can't be used together with --regex")
+	}
+
+	// --lang
+	// --in
+	if opts.Lang != "" || opts.In != "" {
+		if opts.Lang == "" || opts.In == "" {
+			return errors.New("--lang and --in must be used together")
+		}
+
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--lang and --in are only valid in --mode=replace")
+		}
+
+		if _, ok := codeLanguages[opts.Lang]; !ok {
+			return fmt.Errorf("Invalid --lang \"%s\"", opts.Lang)
+		}
+
+		if !contains([]string{segmentCode, segmentComment, segmentString}, opts.In) {
+			return fmt.Errorf("Invalid --in \"%s\"", opts.In)
+		}
+	}
+
+	// --token-chars
+	if opts.TokenChars != "" {
+		if opts.Concat {
+			return errors.New("--token-chars can't be used together with --concat")
+		}
+
+		tokenChars, err := parseTokenChars(opts.TokenChars)
+		if err != nil {
+			return fmt.Errorf("Invalid --token-chars \"%s\": %s", opts.TokenChars, err)
+		}
+		opts.tokenChars = tokenChars
+	}
+
+	// --skip-quoted
+	if opts.SkipQuoted {
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--skip-quoted is only valid in --mode=replace")
+		}
+
+		if opts.Lang != "" {
+			return errors.New("--skip-quoted can't be used together with --lang and --in")
+		}
+	}
+
+	// --rename
+	if opts.Rename != "" {
+		if opts.Rename != "content" && opts.Rename != "only" {
+			return fmt.Errorf("Invalid --rename \"%s\"", opts.Rename)
+		}
+
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--rename is only valid in --mode=replace")
+		}
+
+		if opts.Output != "" || opts.OutputStripFileExt != "" {
+			return errors.New("--rename can't be used together with --output or --output-strip-ext")
+		}
+	}
+
+	// --squeeze-whitespace
+	if opts.SqueezeWhitespace && !opts.ModeIsReplaceMatch {
+		return errors.New("--squeeze-whitespace is only valid in --mode=replace")
+	}
+
+	// --concat
+	if opts.Concat {
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--concat is only valid in --mode=replace")
+		}
+
+		if opts.GoTemplate || opts.Compute || opts.Map != "" || opts.RulesJSON != "" || opts.Lang != "" || opts.SkipQuoted || opts.Rename != "" || opts.ReplaceCmd != "" {
+			return errors.New("--concat can't be used together with --go-template, --compute, --map, --rules-json, --lang, --skip-quoted, --rename or --replace-cmd")
+		}
+
+		if opts.Once != "" || opts.Limit > 0 || opts.Nth > 0 || opts.Repeat > 0 || opts.MaxReplacements > 0 || opts.RegexTimeout != "" || opts.RequireContent != "" {
+			return errors.New("--concat can't be used together with --once, --limit, --nth, --repeat, --max-replacements-per-file, --regex-timeout or --require-content")
+		}
+
+		// line based options
+		if opts.Trim || opts.SqueezeWhitespace || opts.DedupeAdjacent || opts.DropEmptyLines || opts.IfLineMatches != "" || (opts.LineEnding != "" && opts.LineEnding != "keep") {
+			return errors.New("--concat can't be used together with --trim, --squeeze-whitespace, --dedupe-adjacent, --drop-empty-lines, --if-line-matches or --line-ending")
+		}
+
+		if opts.Check || opts.Locations || opts.Preview {
+			return errors.New("--concat can't be used together with --check, --locations or --preview")
+		}
+	}
+
+	// --paragraph-mode
+	if opts.ParagraphMode {
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--paragraph-mode is only valid in --mode=replace")
+		}
+
+		if opts.Concat || opts.GoTemplate || opts.Compute || opts.Map != "" || opts.RulesJSON != "" || opts.Lang != "" || opts.SkipQuoted || opts.ReplaceCmd != "" {
+			return errors.New("--paragraph-mode can't be used together with --concat, --go-template, --compute, --map, --rules-json, --lang, --skip-quoted or --replace-cmd")
+		}
+
+		if opts.Once != "" || opts.OncePerLine || opts.Limit > 0 || opts.Nth > 0 || opts.Repeat > 0 || opts.MaxReplacements > 0 || opts.TotalLimit > 0 || opts.RegexTimeout != "" {
+			return errors.New("--paragraph-mode can't be used together with --once, --once-per-line, --limit, --nth, --repeat, --max-replacements-per-file, --total-limit or --regex-timeout")
+		}
+
+		// line based options
+		if opts.Trim || opts.SqueezeWhitespace || opts.DedupeAdjacent || opts.DropEmptyLines || opts.IfLineMatches != "" || (opts.LineEnding != "" && opts.LineEnding != "keep") {
+			return errors.New("--paragraph-mode can't be used together with --trim, --squeeze-whitespace, --dedupe-adjacent, --drop-empty-lines, --if-line-matches or --line-ending")
+		}
+
+		if opts.OnlyLines != "" || opts.MinIndent > 0 || opts.MaxIndent != nil || opts.TokenChars != "" || opts.ReplaceAtStart != "" || opts.EnableLineContext {
+			return errors.New("--paragraph-mode can't be used together with --only-lines, --min-indent, --max-indent, --token-chars, --replace-at-start or --enable-line-context")
+		}
+
+		if opts.Check || opts.Locations || opts.Preview || opts.NoNewlineAtEOF || opts.EnsureNewlineAtEOF || opts.StripTrailingWS || opts.EnsureHeader != "" {
+			return errors.New("--paragraph-mode can't be used together with --check, --locations, --preview, --no-newline-at-eof, --ensure-newline-at-eof, --strip-trailing-whitespace or --ensure-header")
+		}
+	}
+
+	// --no-newline-at-eof
+	// --ensure-newline-at-eof
+	if opts.NoNewlineAtEOF || opts.EnsureNewlineAtEOF {
+		if opts.NoNewlineAtEOF && opts.EnsureNewlineAtEOF {
+			return errors.New("Only --no-newline-at-eof or --ensure-newline-at-eof is allowed")
+		}
+
+		if opts.Concat {
+			return errors.New("--no-newline-at-eof and --ensure-newline-at-eof can't be used together with --concat")
+		}
+	}
+
+	// --strip-trailing-whitespace
+	if opts.StripTrailingWS {
+		if opts.ModeIsTemplate || opts.ModeIsJSON || opts.ModeIsYAML {
+			return errors.New("--strip-trailing-whitespace is not available in --mode=template, --mode=json or --mode=yaml")
+		}
+
+		if opts.Check || opts.Locations || opts.FilesWithMatches || opts.Concat || opts.Rename == "only" {
+			return errors.New("--strip-trailing-whitespace can't be used together with --check, --locations, --files-with-matches, --concat or --rename=only")
+		}
+	}
+
+	// --context
+	if opts.Context < 0 {
+		return errors.New("--context must not be negative")
+	} else if opts.Context > 0 && !opts.Check && !opts.Locations {
+		return errors.New("--context is only valid with --check or --locations")
+	}
+
+	// --tab-width
+	if opts.TabWidth < 0 {
+		return errors.New("--tab-width must not be negative")
+	} else if opts.TabWidth > 0 && !opts.Locations && opts.MinIndent == 0 && opts.MaxIndent == nil {
+		return errors.New("--tab-width is only valid with --locations, --min-indent or --max-indent")
+	}
+
+	// --min-indent
+	// --max-indent
+	if opts.MinIndent < 0 || (opts.MaxIndent != nil && *opts.MaxIndent < 0) {
+		return errors.New("--min-indent and --max-indent must not be negative")
+	} else if opts.MaxIndent != nil && *opts.MaxIndent < opts.MinIndent {
+		return errors.New("--max-indent must not be less than --min-indent")
+	} else if (opts.MinIndent > 0 || opts.MaxIndent != nil) && (opts.ModeIsTemplate || opts.ModeIsJSON || opts.ModeIsYAML || opts.Concat) {
+		return errors.New("--min-indent and --max-indent are not available in --mode=template, --mode=json, --mode=yaml or with --concat")
+	}
+
+	// --distinct
+	if opts.Distinct && !opts.Check && !opts.Locations {
+		return errors.New("--distinct is only valid with --check or --locations")
+	}
+
+	// --preserve-bom
+	switch opts.PreserveBOM {
+	case "", "yes", "no":
+	default:
+		return fmt.Errorf("Invalid --preserve-bom \"%s\"", opts.PreserveBOM)
+	}
+
+	// --drop-empty-lines
+	if opts.DropEmptyLines && !opts.ModeIsReplaceMatch {
+		return errors.New("--drop-empty-lines is only valid in --mode=replace")
+	}
+
+	// --dedupe-adjacent
+	if opts.DedupeAdjacent && opts.ModeIsTemplate {
+		return errors.New("--dedupe-adjacent is not available in --mode=template")
+	}
+
+	// --check
+	// --locations
+	if opts.Check || opts.Locations {
+		if opts.ModeIsTemplate {
+			return errors.New("--check and --locations are not available in --mode=template")
+		}
+
+		if opts.Rename != "" {
+			return errors.New("--check and --locations can't be used together with --rename")
+		}
+	}
+
+	// --files-with-matches
+	if opts.FilesWithMatches {
+		if opts.ModeIsTemplate || opts.ModeIsJSON || opts.ModeIsYAML {
+			return errors.New("--files-with-matches is not available in --mode=template, --mode=json or --mode=yaml")
+		}
+
+		if opts.Check || opts.Locations || opts.Concat || opts.Rename != "" || opts.Preview || opts.Diff || opts.Sample > 0 || opts.EnsureHeader != "" {
+			return errors.New("--files-with-matches can't be used together with --check, --locations, --concat, --rename, --preview, --diff, --sample or --ensure-header")
+		}
+	}
+
+	// --scan-tar
+	if opts.ScanTar && !opts.Check && !opts.Locations && !opts.FilesWithMatches {
+		return errors.New("--scan-tar is only valid with --check, --locations or --files-with-matches")
+	}
+
+	// --line-ending
+	if opts.LineEnding != "" && opts.LineEnding != "keep" && opts.ModeIsTemplate {
+		return errors.New("--line-ending is not available in --mode=template")
+	}
+
+	// --go-template
+	if opts.GoTemplate {
+		if opts.RegexBackref {
+			return errors.New("--go-template can't be used together with --regex-backrefs")
+		}
+
+		if opts.ModeIsTemplate {
+			return errors.New("--go-template is not available in --mode=template")
+		}
+	}
+
+	// --compute
+	if opts.Compute {
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--compute is only valid in --mode=replace")
+		}
+
+		if !opts.Regex {
+			return errors.New("--compute requires --regex")
+		}
+
+		if opts.GoTemplate || opts.RegexBackref || opts.Map != "" || opts.Generators {
+			return errors.New("--compute can't be used together with --go-template, --regex-backrefs, --map or --generators")
+		}
+	}
+
+	// --replace-cmd
+	if opts.ReplaceCmd != "" {
+		args, err := splitCommandLine(opts.ReplaceCmd)
+		if err != nil {
+			return fmt.Errorf("Invalid --replace-cmd \"%s\": %s", opts.ReplaceCmd, err)
+		} else if len(args) == 0 {
+			return errors.New("Invalid --replace-cmd, expected a command")
+		}
+		opts.replaceCmd = args
+
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--replace-cmd is only valid in --mode=replace")
+		}
+
+		if opts.GoTemplate || opts.Compute || opts.RegexBackref || opts.Map != "" || opts.Generators || opts.CycleReplace != "" {
+			return errors.New("--replace-cmd can't be used together with --go-template, --compute, --regex-backrefs, --map, --generators or --cycle-replace")
+		}
+
+		// replacements are the output of the command
+		if len(opts.Replace) > 0 {
+			return errors.New("--replace-cmd can't be used together with --replace")
+		}
+	}
+
+	// --generators
+	if opts.Generators {
+		if opts.GoTemplate || opts.Map != "" {
+			return errors.New("--generators can't be used together with --go-template or --map")
+		}
+
+		if opts.ModeIsTemplate {
+			return errors.New("--generators is not available in --mode=template")
+		}
+	}
+
+	// --enable-line-context
+	if opts.EnableLineContext {
+		if opts.GoTemplate || opts.Compute || opts.Map != "" || opts.Concat {
+			return errors.New("--enable-line-context can't be used together with --go-template, --compute, --map or --concat")
+		}
+
+		if opts.ModeIsTemplate || opts.ModeIsJSON || opts.ModeIsYAML {
+			return errors.New("--enable-line-context is not available in --mode=template, --mode=json or --mode=yaml")
+		}
+	}
+
+	// --limit
+	if opts.Limit < 0 {
+		return errors.New("--limit must not be negative")
+	}
+	if opts.Limit > 0 && opts.Once != "" {
+		return errors.New("Only --once or --limit is allowed")
+	}
+
+	// --nth
+	if opts.Nth < 0 {
+		return errors.New("--nth must not be negative")
+	}
+	if opts.Nth > 0 && (opts.Limit > 0 || opts.Once != "") {
+		return errors.New("--nth can't be used together with --once or --limit")
+	}
+
+	// --once-per-line
+	if opts.OncePerLine {
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--once-per-line is only valid in --mode=replace")
+		}
+
+		if opts.Repeat > 0 || opts.Concat {
+			return errors.New("--once-per-line can't be used together with --repeat or --concat")
+		}
+	}
+
+	// --repeat
+	if opts.Repeat < 0 {
+		return errors.New("--repeat must not be negative")
+	}
+	if opts.Repeat > 0 {
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--repeat is only valid in --mode=replace")
+		}
+
+		if opts.Limit > 0 || opts.Once != "" || opts.Nth > 0 {
+			return errors.New("--repeat can't be used together with --once, --limit or --nth")
+		}
+	}
+
+	// --preview
+	if opts.Preview {
+		if !opts.DryRun {
+			return errors.New("--preview is only valid with --dry-run")
+		}
+
+		if opts.ModeIsTemplate {
+			return errors.New("--preview is not available in --mode=template")
+		}
+	}
+
+	// --diff
+	if opts.Diff {
+		if !opts.DryRun {
+			return errors.New("--diff is only valid with --dry-run")
+		}
+
+		if opts.Preview || opts.Check || opts.Locations {
+			return errors.New("--diff can't be used together with --preview, --check or --locations")
+		}
+	}
+
+	// --patch-file
+	if opts.PatchFile != "" {
+		if !opts.DryRun {
+			return errors.New("--patch-file is only valid with --dry-run")
+		}
+
+		if opts.Preview || opts.Check || opts.Locations || opts.Sample > 0 {
+			return errors.New("--patch-file can't be used together with --preview, --check, --locations or --sample")
+		}
+	}
+
+	// --sample
+	if opts.Sample < 0 {
+		return errors.New("--sample must not be negative")
+	} else if opts.Sample > 0 {
+		if !opts.DryRun {
+			return errors.New("--sample is only valid with --dry-run")
+		}
+
+		if opts.ModeIsTemplate {
+			return errors.New("--sample is not available in --mode=template")
+		}
+
+		if opts.Preview || opts.Diff || opts.Check || opts.Locations || opts.Concat {
+			return errors.New("--sample can't be used together with --preview, --diff, --check, --locations or --concat")
+		}
+	}
+
+	// --validate-cmd
+	if opts.ValidateCmd != "" {
+		args, err := splitCommandLine(opts.ValidateCmd)
+		if err != nil {
+			return fmt.Errorf("Invalid --validate-cmd \"%s\": %s", opts.ValidateCmd, err)
+		} else if len(args) == 0 {
+			return errors.New("--validate-cmd must not be empty")
+		}
+		opts.validateCmd = args
+
+		if opts.DryRun {
+			return errors.New("--validate-cmd can't be used together with --dry-run")
+		}
+	}
+
+	// --retry
+	if opts.Retry < 0 {
+		return errors.New("--retry must not be negative")
+	}
+
+	// --max-replacements-per-file
+	if opts.MaxReplacements < 0 {
+		return errors.New("--max-replacements-per-file must not be negative")
+	}
+
+	// --total-limit
+	if opts.TotalLimit < 0 {
+		return errors.New("--total-limit must not be negative")
+	} else if opts.TotalLimit > 0 {
+		if opts.ModeIsTemplate || opts.ModeIsJSON || opts.ModeIsYAML {
+			return errors.New("--total-limit is not available in --mode=template, --mode=json or --mode=yaml")
+		}
+
+		if opts.Check || opts.Locations || opts.FilesWithMatches || opts.Concat {
+			return errors.New("--total-limit can't be used together with --check, --locations, --files-with-matches or --concat")
+		}
+	}
+
+	// --newer-than
+	if opts.NewerThan != "" {
+		newerThan, err := parseTimestamp(opts.NewerThan)
+		if err != nil {
+			return fmt.Errorf("Invalid --newer-than \"%s\", expected RFC3339 timestamp or duration", opts.NewerThan)
+		}
+		opts.newerThan = newerThan
+	}
+
+	// --min-size
+	if opts.MinSize != "" {
+		minSize, err := parseByteSize(opts.MinSize)
+		if err != nil {
+			return fmt.Errorf("Invalid --min-size \"%s\": %s", opts.MinSize, err)
+		}
+		opts.minSize = minSize
+	}
+
+	// --max-size
+	if opts.MaxSize != "" {
+		maxSize, err := parseByteSize(opts.MaxSize)
+		if err != nil {
+			return fmt.Errorf("Invalid --max-size \"%s\": %s", opts.MaxSize, err)
+		}
+		opts.maxSize = maxSize
+
+		if opts.minSize > maxSize {
+			return errors.New("--min-size must not be larger than --max-size")
+		}
+	}
+
+	// --modified-after
+	if opts.ModifiedAfter != "" {
+		modifiedAfter, err := parseTimestamp(opts.ModifiedAfter)
+		if err != nil {
+			return fmt.Errorf("Invalid --modified-after \"%s\", expected RFC3339 timestamp or duration", opts.ModifiedAfter)
+		}
+		opts.modifiedAfter = modifiedAfter
+	}
+
+	// --modified-before
+	if opts.ModifiedBefore != "" {
+		modifiedBefore, err := parseTimestamp(opts.ModifiedBefore)
+		if err != nil {
+			return fmt.Errorf("Invalid --modified-before \"%s\", expected RFC3339 timestamp or duration", opts.ModifiedBefore)
+		}
+		opts.modifiedBefore = modifiedBefore
+	}
+
+	// --name-regex
+	if opts.NameRegex != "" {
+		nameRegex, err := regexp.Compile(opts.NameRegex)
+		if err != nil {
+			return fmt.Errorf("Invalid regular expression \"%s\": %s", opts.NameRegex, err)
+		}
+		opts.nameRegex = nameRegex
+	}
+
+	// --regex-timeout
+	if opts.RegexTimeout != "" {
+		regexTimeout, err := time.ParseDuration(opts.RegexTimeout)
+		if err != nil || regexTimeout <= 0 {
+			return fmt.Errorf("Invalid --regex-timeout \"%s\", expected positive duration like 5s", opts.RegexTimeout)
+		}
+
+		if opts.ModeIsTemplate {
+			return errors.New("--regex-timeout is not available in --mode=template")
+		}
+		opts.regexTimeout = regexTimeout
+	}
+
+	// --parallel
+	switch opts.Parallel {
+	case "", "files", "none":
+	default:
+		return fmt.Errorf("Invalid --parallel \"%s\"", opts.Parallel)
+	}
+
+	// --memory-limit
+	if opts.MemoryLimit != "" {
+		memoryLimit, err := parseByteSize(opts.MemoryLimit)
+		if err != nil {
+			return fmt.Errorf("Invalid --memory-limit \"%s\": %s", opts.MemoryLimit, err)
+		}
+		opts.memoryLimit = memoryLimit
+
+		if opts.Concat {
+			return errors.New("--memory-limit can't be used together with --concat")
+		}
+	}
+
+	// --require-content
+	if opts.RequireContent != "" {
+		requireContent, err := regexp.Compile(opts.RequireContent)
+		if err != nil {
+			return fmt.Errorf("Invalid regular expression \"%s\": %s", opts.RequireContent, err)
+		}
+		opts.requireContent = requireContent
+	}
+
+	// --rules-json
+	if opts.RulesJSON != "" && opts.ModeIsTemplate {
+		return errors.New("--rules-json is not available in --mode=template")
+	}
+
+	// --strict-rules
+	if opts.StrictRules && !opts.DedupeChangesets {
+		return errors.New("--strict-rules is only valid with --dedupe-changesets")
+	}
+
+	// --only-lines
+	if opts.OnlyLines != "" {
+		onlyLines, err := parseLineRanges(opts.OnlyLines)
+		if err != nil {
+			return fmt.Errorf("Invalid --only-lines \"%s\", expected lines and ranges like 3,7,12-15", opts.OnlyLines)
+		}
+
+		if opts.ModeIsTemplate {
+			return errors.New("--only-lines is not available in --mode=template")
+		}
+		opts.onlyLines = onlyLines
+	}
+
+	// --ensure-header
+	if opts.EnsureHeader != "" {
+		if opts.ModeIsTemplate {
+			return errors.New("--ensure-header is not available in --mode=template")
+		}
+
+		if opts.Check || opts.Locations || opts.Concat || opts.Rename == "only" {
+			return errors.New("--ensure-header can't be used together with --check, --locations, --concat or --rename=only")
+		}
+
+		header, err := readHeader(opts.EnsureHeader)
+		if err != nil {
+			return fmt.Errorf("Invalid --ensure-header \"%s\": %s", opts.EnsureHeader, err)
+		}
+		opts.header = header
+	}
+
+	// --if-line-matches
+	if opts.IfLineMatches != "" && opts.ModeIsTemplate {
+		return errors.New("--if-line-matches is not available in --mode=template")
+	}
+
+	// --explain-skips
+	if opts.ExplainSkips && opts.Path == "" {
+		return errors.New("--explain-skips is only valid with --path")
+	}
+
+	// --watch
+	if opts.Watch {
+		if opts.Path == "" {
+			return errors.New("--watch is only valid with --path")
+		}
+
+		if opts.Concat || opts.Rename != "" || opts.Sample > 0 {
+			return errors.New("--watch can't be used together with --concat, --rename or --sample")
+		}
+	}
+
+	// --max-depth
+	opts.maxDepth = -1
+	if opts.MaxDepth != "" {
+		maxDepth, err := strconv.Atoi(opts.MaxDepth)
+		if err != nil || maxDepth < 0 {
+			return fmt.Errorf("Invalid --max-depth \"%s\", expected number of directory levels", opts.MaxDepth)
+		}
+		opts.maxDepth = maxDepth
+	}
+
+	// --root
+	if opts.Root != "" {
+		root, err := filepath.EvalSymlinks(opts.Root)
+		if err == nil {
+			root, err = filepath.Abs(root)
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid --root \"%s\": %s", opts.Root, err)
+		}
+		opts.root = root
+	}
+
+	// --output-dir
+	if opts.OutputDir != "" {
+		if opts.Output != "" {
+			return errors.New("--output-dir can't be used together with --output")
+		}
+
+		if opts.Rename != "" {
+			return errors.New("--output-dir can't be used together with --rename")
+		}
+	}
+
+	// --output-template
+	if opts.OutputTemplate != "" {
+		if opts.Output != "" || opts.OutputStripFileExt != "" || opts.OutputDir != "" {
+			return errors.New("--output-template can't be used together with --output, --output-strip-ext or --output-dir")
+		}
+
+		if opts.Rename != "" {
+			return errors.New("--output-template can't be used together with --rename")
+		}
+
+		if err := validateOutputTemplate(opts.OutputTemplate); err != nil {
+			return fmt.Errorf("Invalid --output-template \"%s\": %s", opts.OutputTemplate, err)
+		}
+	}
+
+	// --copy-unchanged
+	if opts.CopyUnchanged && opts.OutputDir == "" && opts.OutputTemplate == "" {
+		return errors.New("--copy-unchanged is only valid with --output-dir or --output-template")
+	}
+
+	// --trim-indent
+	if opts.TrimIndent != nil && !opts.Trim {
+		return errors.New("--trim-indent is only valid with --trim")
+	}
+
+	// --replace-escape
+	if opts.ReplaceEscape {
+		if !opts.RegexBackref {
+			return errors.New("--replace-escape is only valid with --regex-backrefs")
+		}
+
+		if opts.ReplaceAtStart != "" || opts.Generators || opts.EnableLineContext {
+			return errors.New("--replace-escape can't be used together with --replace-at-start, --generators or --enable-line-context")
+		}
+	}
+
+	// --followed-by
+	if opts.FollowedBy != "" {
+		if _, err := regexp.Compile(opts.FollowedBy); err != nil {
+			return fmt.Errorf("Invalid --followed-by \"%s\": %s", opts.FollowedBy, err)
+		}
+
+		if !opts.ModeIsReplaceMatch {
+			return errors.New("--followed-by is only valid in --mode=replace")
+		}
+
+		if opts.GoTemplate || opts.Compute || opts.Map != "" || opts.CycleReplace != "" || opts.ReplaceAtStart != "" || opts.RulesJSON != "" || opts.Concat || opts.Rename != "" {
+			return errors.New("--followed-by can't be used together with --go-template, --compute, --map, --cycle-replace, --replace-at-start, --rules-json, --concat or --rename")
+		}
+
+		if opts.Generators || opts.EnableLineContext || opts.Check || opts.Locations || opts.FilesWithMatches {
+			return errors.New("--followed-by can't be used together with --generators, --enable-line-context, --check, --locations or --files-with-matches")
+		}
+
+		// following text is captured and added to the replace term as backref
+		opts.followedByLiteral = !opts.RegexBackref
+		opts.RegexBackref = true
+	}
+
+	// --interpret-escapes
+	if opts.InterpretEscapes {
+		if opts.Map != "" {
+			return errors.New("--interpret-escapes can't be used together with --map")
+		}
+
+		// terms of --replace are unescaped when building the changesets
+		opts.ReplaceAtStart = interpretEscapes(opts.ReplaceAtStart)
+		for i := range opts.cycleReplace {
+			opts.cycleReplace[i] = interpretEscapes(opts.cycleReplace[i])
+		}
+	}
+
+	// --preserve-indent
+	if opts.PreserveIndent {
+		if !opts.ModeIsReplaceLine && !opts.ModeIsLineInFile {
+			return errors.New("--preserve-indent is only valid in --mode=line or --mode=lineinfile")
+		}
+
+		if opts.TrimIndent != nil {
+			return errors.New("--preserve-indent can't be used together with --trim-indent")
+		}
+	}
+
+	return nil
+}
+
+// Maximum number of replacements per search term in a file, 0 for unlimited
+func (opts *Options) matchLimit() int {
+	// --once
+	if opts.Once != "" {
+		return 1
+	}
+
+	// --limit
+	return opts.Limit
+}
+
+// Checks if line (1-based) is selected by --only-lines,
+// all lines are selected without --only-lines
+func (opts *Options) lineSelected(line int) bool {
+	if opts.onlyLines == nil {
+		return true
+	}
+
+	for _, lines := range opts.onlyLines {
+		if lines.From <= line && line <= lines.To {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks if the indentation of line is within --min-indent and --max-indent
+func (opts *Options) indentSelected(line string) bool {
+	if opts.MinIndent == 0 && opts.MaxIndent == nil {
+		return true
+	}
+
+	width := indentWidth(leadingIndent(line), opts.TabWidth)
+
+	return width >= opts.MinIndent && (opts.MaxIndent == nil || width <= *opts.MaxIndent)
+}
+
+// Indentation of --trim-indent, indent is used if it isn't set
+func (opts *Options) trimIndent(indent string) string {
+	if opts.TrimIndent == nil {
+		return indent
+	}
+
+	return *opts.TrimIndent
+}
+
+// Parse RFC3339 timestamp or duration relative to now (eg. 2h for two hours ago)
+func parseTimestamp(value string) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
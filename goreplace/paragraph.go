@@ -0,0 +1,113 @@
+package goreplace
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Blank lines (empty or only whitespace) between paragraphs with the line ending
+// before them, at the start of the content only the blank lines (--paragraph-mode)
+var paragraphSeparator = regexp.MustCompile(`(?:\A|\r?\n)(?:[ \t]*\r?\n)+`)
+
+// Apply changesets to each paragraph of content on its own, so search terms can
+// match across lines but never across blank lines. Separators are kept unchanged.
+func (r *Replacer) applyChangesetsToParagraphs(content string, changesets []Changeset) string {
+	var ret strings.Builder
+
+	lastIndex := 0
+	for _, separator := range paragraphSeparator.FindAllStringIndex(content, -1) {
+		ret.WriteString(r.applyChangesetsToParagraph(content[lastIndex:separator[0]], changesets))
+		ret.WriteString(content[separator[0]:separator[1]])
+		lastIndex = separator[1]
+	}
+	ret.WriteString(r.applyChangesetsToParagraph(content[lastIndex:], changesets))
+
+	return ret.String()
+}
+
+// Apply changesets one after another to the whole paragraph, matches are counted in the changesets
+func (r *Replacer) applyChangesetsToParagraph(paragraph string, changesets []Changeset) string {
+	if paragraph == "" {
+		return paragraph
+	}
+
+	for i := range changesets {
+		changeset := &changesets[i]
+
+		var ret strings.Builder
+		lastIndex := 0
+		for _, match := range changeset.Search.FindAllStringSubmatchIndex(paragraph, -1) {
+			ret.WriteString(paragraph[lastIndex:match[0]])
+
+			if r.opts.RegexBackref {
+				// --regex-backrefs
+				ret.Write(changeset.Search.ExpandString(nil, r.replaceTerm(*changeset), paragraph, match))
+			} else {
+				ret.WriteString(r.replaceTerm(*changeset))
+			}
+
+			changeset.MatchFound = true
+			changeset.MatchCount++
+			changeset.ReplaceCount++
+			lastIndex = match[1]
+		}
+		ret.WriteString(paragraph[lastIndex:])
+
+		paragraph = ret.String()
+	}
+
+	return paragraph
+}
+
+// Replace within each paragraph of file (--paragraph-mode)
+func (r *Replacer) applyParagraphsToFile(fileitem FileItem, changesets []Changeset) ChangeResult {
+	content, err := r.readFile(fileitem.Path)
+	if err != nil {
+		return ChangeResult{File: fileitem, Error: err}
+	}
+
+	// track matches per file
+	changesets = resetChangesets(changesets)
+	replaced := r.applyChangesetsToParagraphs(string(content), changesets)
+
+	result := ChangeResult{File: fileitem, Matched: changesetsMatched(changesets), Searches: matchedSearches(changesets), Replacements: countReplacements(changesets), Changes: changeCounts(changesets)}
+	if !result.Matched && r.opts.Output == "" && r.opts.OutputStripFileExt == "" {
+		result.Output = fmt.Sprintf("%s no match", fileitem.Path)
+
+		// --copy-unchanged
+		if r.opts.CopyUnchanged {
+			result.Output, result.Error = r.copyUnchangedFile(fileitem)
+		}
+		return result
+	}
+
+	// --force-write
+	if replaced == string(content) && fileitem.Output == fileitem.Path && !r.opts.ForceWrite {
+		result.Output = fmt.Sprintf("%s not changed, replacements are identical", fileitem.Path)
+		result.Replacements = 0
+		result.Changes = nil
+		return result
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(replaced)
+	result.Output, result.Error = r.writeContentToFile(fileitem, buffer)
+	result.Changed = result.Error == nil
+
+	return result
+}
+
+// Replace within each paragraph of the content read from in (--paragraph-mode)
+func (r *Replacer) applyParagraphsToReader(in io.Reader, out io.Writer, changesets []Changeset) error {
+	content, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(out, r.applyChangesetsToParagraphs(string(content), resetChangesets(changesets)))
+	return err
+}
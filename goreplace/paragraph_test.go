@@ -0,0 +1,76 @@
+package goreplace
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestApplyChangesetsToFileParagraphMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// second stanza starts with "host" and ends with "port", but across the blank line
+	path := writeTestFile(t, dir, "test.txt", "\n[a]\nhost\nport\n\n[b]\nhost\n  \t\nport\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:        []string{`host\nport`},
+		Replace:       []string{"host:port"},
+		Regex:         true,
+		ParagraphMode: true,
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{path, path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Changed || results[0].Replacements != 1 {
+		t.Fatalf("expected file to be changed with 1 replacement, got %+v", results[0])
+	}
+
+	expected := "\n[a]\nhost:port\n\n[b]\nhost\n  \t\nport\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+
+	// (?s) can't reach into the next paragraph either
+	var out bytes.Buffer
+	r, changesets = newTestReplacer(t, Options{
+		Search:        []string{`(?s)\[a\].*`},
+		Replace:       []string{"[c]"},
+		Regex:         true,
+		ParagraphMode: true,
+	})
+	if err := r.ApplyChangesetsToReader(strings.NewReader("[a]\nx\r\n\r\n[b]\n"), &out, "<stdin>", changesets); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "[c]\r\n\r\n[b]\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestNewReplacerParagraphModeInvalid(t *testing.T) {
+	for _, opts := range []Options{
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, Mode: "line"},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, Concat: true},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, Trim: true},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, OnlyLines: "3"},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, MinIndent: 2},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, MaxIndent: new(int)},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, OncePerLine: true},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, TotalLimit: 1},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, TokenChars: "[a-z]"},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, ReplaceAtStart: "baz"},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, ParagraphMode: true, EnableLineContext: true},
+	} {
+		if _, err := NewReplacer(opts); err == nil || !strings.Contains(err.Error(), "--paragraph-mode") {
+			t.Errorf("expected --paragraph-mode error for %+v, got %v", opts, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package goreplace
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+type previewLine struct {
+	Number   int
+	Original string
+	Replaced string
+	Removed  bool
+}
+
+// Format changed lines of a file as side by side preview
+// (line number, original line and replaced line)
+func formatPreview(fileitem FileItem, lines []previewLine) string {
+	var buffer bytes.Buffer
+
+	numberWidth := 0
+	originalWidth := 0
+	for _, line := range lines {
+		if width := len(strconv.Itoa(line.Number)); width > numberWidth {
+			numberWidth = width
+		}
+
+		if width := len([]rune(line.Original)); width > originalWidth {
+			originalWidth = width
+		}
+	}
+
+	buffer.WriteString(fmt.Sprintf("%s:\n", fileitem.Path))
+	for _, line := range lines {
+		replaced := line.Replaced
+		if line.Removed {
+			replaced = "<removed>"
+		}
+
+		buffer.WriteString(fmt.Sprintf("%*d: %-*s | %s\n", numberWidth, line.Number, originalWidth, line.Original, replaced))
+	}
+
+	return buffer.String()
+}
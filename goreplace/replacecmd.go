@@ -0,0 +1,107 @@
+package goreplace
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Runs the --replace-cmd command line with input on stdin and returns its output, replaced in tests
+var runReplaceCmd = func(args []string, input string) ([]byte, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(input)
+	return cmd.Output()
+}
+
+// Outputs of --replace-cmd by matched text, the command runs only once for each
+// text, also if workers process the same text at the same time. Failures of the
+// command are collected by file, so the file isn't written.
+type commandCache struct {
+	mutex    sync.Mutex
+	outputs  map[string]*commandOutput
+	failures map[string]error
+}
+
+type commandOutput struct {
+	once   sync.Once
+	output string
+	err    error
+}
+
+// Output of the command for the matched text, run is only called
+// for the first match of the text
+func (c *commandCache) get(match string, run func() (string, error)) (string, error) {
+	c.mutex.Lock()
+	cached, found := c.outputs[match]
+	if !found {
+		cached = &commandOutput{}
+		c.outputs[match] = cached
+	}
+	c.mutex.Unlock()
+
+	cached.once.Do(func() {
+		cached.output, cached.err = run()
+	})
+
+	return cached.output, cached.err
+}
+
+// Record the first failure of the command in file
+func (c *commandCache) fail(file string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, found := c.failures[file]; !found {
+		c.failures[file] = err
+	}
+}
+
+// Command line of --replace-cmd for a match, {} is replaced with the
+// matched text, otherwise the matched text is passed on stdin
+// The command is split into arguments like a shell does (see splitCommandLine),
+// but it is not run by a shell.
+func (r *Replacer) replaceCommand(match string) ([]string, string) {
+	args := append([]string{}, r.opts.replaceCmd...)
+
+	placeholder := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{}") {
+			args[i] = strings.Replace(arg, "{}", match, -1)
+			placeholder = true
+		}
+	}
+
+	if placeholder {
+		return args, ""
+	}
+
+	return args, match
+}
+
+// Output of --replace-cmd for the matched text without the trailing line ending,
+// the match is kept if the command fails and the failure is an error of the file
+// (see commandFailure)
+func (r *Replacer) commandReplacement(match string, position linePosition) string {
+	output, err := r.commands.get(match, func() (string, error) {
+		output, err := runReplaceCmd(r.replaceCommand(match))
+		return strings.TrimSuffix(strings.TrimSuffix(string(output), "\n"), "\r"), err
+	})
+
+	if err != nil {
+		r.commands.fail(position.File, fmt.Errorf("%s:%d: --replace-cmd failed for \"%s\": %s", position.File, position.Line, match, err))
+		return match
+	}
+
+	return output
+}
+
+// First failure of --replace-cmd in file, the failure is removed afterwards
+func (r *Replacer) commandFailure(file string) error {
+	r.commands.mutex.Lock()
+	defer r.commands.mutex.Unlock()
+
+	err := r.commands.failures[file]
+	delete(r.commands.failures, file)
+	return err
+}
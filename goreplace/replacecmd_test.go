@@ -0,0 +1,203 @@
+package goreplace
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApplyChangesetsToFileReplaceCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "name: foo\nother: bar, foo\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:     []string{"foo|bar"},
+		Regex:      true,
+		ReplaceCmd: "tr a-z A-Z",
+	})
+
+	if _, changed, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil || !changed {
+		t.Fatalf("expected file to be changed, got %v", err)
+	}
+
+	expected := "name: FOO\nother: BAR, FOO\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+func TestApplyChangesetsToFileReplaceCmdFollowedBy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "foo1 foo2\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:     []string{"foo"},
+		FollowedBy: "1",
+		ReplaceCmd: "tr a-z A-Z",
+	})
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	// the following text is kept and not passed to the command
+	expected := "FOO1 foo2\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+func TestNewReplacerReplaceCmdWithReplace(t *testing.T) {
+	if _, err := NewReplacer(Options{Search: []string{"foo"}, Replace: []string{"bar"}, ReplaceCmd: "tr a-z A-Z"}); err == nil {
+		t.Error("expected error for --replace-cmd together with --replace")
+	}
+}
+
+func TestCommandReplacementCache(t *testing.T) {
+	var calls []string
+	defer func(run func([]string, string) ([]byte, error)) { runReplaceCmd = run }(runReplaceCmd)
+	runReplaceCmd = func(args []string, input string) ([]byte, error) {
+		calls = append(calls, strings.Join(args, " ")+"|"+input)
+		if input == "fail" {
+			return nil, errors.New("exit status 1")
+		}
+		return []byte(strings.ToUpper(input) + "\n"), nil
+	}
+
+	r, err := NewReplacer(Options{Search: []string{"x"}, ReplaceCmd: "upper --stdin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Logger = ioutil.Discard
+
+	position := linePosition{File: "test.txt", Line: 1}
+	for _, match := range []string{"foo", "bar", "foo", "fail", "fail"} {
+		expected := strings.ToUpper(match)
+		if match == "fail" {
+			expected = match
+		}
+
+		if replacement := r.commandReplacement(match, position); replacement != expected {
+			t.Errorf("%s: expected %q, got %q", match, expected, replacement)
+		}
+	}
+
+	// identical matches run the command once
+	expected := []string{"upper --stdin|foo", "upper --stdin|bar", "upper --stdin|fail"}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+
+	// failure is reported once for the file
+	if err := r.commandFailure("test.txt"); err == nil || !strings.Contains(err.Error(), "exit status 1") {
+		t.Errorf("expected failure of the command, got %v", err)
+	}
+	if err := r.commandFailure("test.txt"); err != nil {
+		t.Errorf("expected failure to be reported once, got %v", err)
+	}
+
+	// {} is replaced with the match instead of passing it on stdin,
+	// quoted arguments are kept together
+	r, err = NewReplacer(Options{Search: []string{"x"}, ReplaceCmd: `printf '%s {}' "-{}"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args, input := r.replaceCommand("foo"); !reflect.DeepEqual(args, []string{"printf", "%s foo", "-foo"}) || input != "" {
+		t.Errorf("expected placeholder to be replaced, got %q and %q", args, input)
+	}
+}
+
+func TestCommandReplacementConcurrent(t *testing.T) {
+	var calls int32
+	defer func(run func([]string, string) ([]byte, error)) { runReplaceCmd = run }(runReplaceCmd)
+	runReplaceCmd = func(args []string, input string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return []byte(strings.ToUpper(input)), nil
+	}
+
+	r, err := NewReplacer(Options{Search: []string{"x"}, ReplaceCmd: "upper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// identical matches of concurrent workers wait for the first command
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if replacement := r.commandReplacement("foo", linePosition{File: "test.txt", Line: 1}); replacement != "FOO" {
+				t.Errorf("expected %q, got %q", "FOO", replacement)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("expected command to run once, got %d", calls)
+	}
+}
+
+func TestProcessFilesReplaceCmdFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(run func([]string, string) ([]byte, error)) { runReplaceCmd = run }(runReplaceCmd)
+	runReplaceCmd = func(args []string, input string) ([]byte, error) {
+		if input == "bar" {
+			return nil, errors.New("exit status 1")
+		}
+		return []byte(strings.ToUpper(input)), nil
+	}
+
+	failed := writeTestFile(t, dir, "failed.txt", "foo\nbar\n")
+	replaced := writeTestFile(t, dir, "replaced.txt", "foo\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:     []string{"foo|bar"},
+		Regex:      true,
+		ReplaceCmd: "upper",
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{failed, failed}, {replaced, replaced}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.File.Path == failed {
+			if result.Error == nil || result.Changed {
+				t.Errorf("expected error for failed command, got %+v", result)
+			}
+		} else if result.Error != nil || !result.Changed {
+			t.Errorf("expected %s to be changed, got %v", result.File.Path, result.Error)
+		}
+	}
+
+	if content := readTestFile(t, failed); content != "foo\nbar\n" {
+		t.Errorf("expected file with failed command not to be changed, got %q", content)
+	}
+	if content := readTestFile(t, replaced); content != "FOO\n" {
+		t.Errorf("expected %q, got %q", "FOO\n", content)
+	}
+}
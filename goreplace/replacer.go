@@ -0,0 +1,1588 @@
+package goreplace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/remeh/sizedwaitgroup"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Changeset is a single search and replace term
+type Changeset struct {
+	SearchPlain  string
+	Search       *regexp.Regexp
+	Replace      string
+	MatchFound   bool
+	MatchCount   int
+	ReplaceCount int
+
+	// --go-template
+	replaceTemplate *template.Template
+
+	// --map
+	replaceMap map[string]string
+
+	// --if-line-matches
+	lineCondition *regexp.Regexp
+
+	// --rules-json, settings of a single rule
+	mode string
+	once bool
+
+	// --cycle-replace, replace terms used in turn and the
+	// index of the next one (counted for each file)
+	cycle      []string
+	cycleIndex *int
+}
+
+// ChangeResult is the result of processing one file
+type ChangeResult struct {
+	File         FileItem
+	Output       string
+	Changed      bool
+	Matched      bool
+	Replacements int
+	Changes      []ChangeCount // replacements per search term
+	Searches     []string      // search terms which matched in the file
+	Renamed      string        // new path of the file (--rename)
+	Matches      []Match       // matches of the search terms (--check, --locations)
+	Duration     time.Duration // processing time of the file
+	Error        error
+}
+
+// ChangeCount is the number of replacements of one search term in a file
+type ChangeCount struct {
+	Search  string
+	Replace string
+	Count   int
+}
+
+// FileItem is a file to process and the destination its content is written to
+type FileItem struct {
+	Path   string
+	Output string
+}
+
+// Replacer applies changesets to files and content
+type Replacer struct {
+	opts Options
+
+	// Logger receives verbose messages, defaults to stderr
+	Logger io.Writer
+
+	// OnResult is called for each file as soon as it was processed (optional)
+	OnResult func(ChangeResult)
+
+	// AuditLog records each changed file (optional)
+	AuditLog *AuditLog
+
+	// --generators, files of ${file:path}
+	snippets *snippetCache
+
+	// --replace-cmd, outputs of the command by matched text
+	commands *commandCache
+
+	// FileSystem of the processed files, defaults to the file system of the OS
+	FileSystem FileSystem
+
+	// --total-limit, replacements of all files and if the limit was reached
+	totalReplacements int64
+	totalLimitReached int32
+
+	// --patch-file, diff of each file by output path
+	patches      map[string]string
+	patchesMutex sync.Mutex
+
+	// files are processed concurrently, messages are written one at a time
+	loggerMutex sync.Mutex
+}
+
+var pathFilterDirectories = []string{"autom4te.cache", "blib", "_build", ".bzr", ".cdv", "cover_db", "CVS", "_darcs", "~.dep", "~.dot", ".git", ".hg", "~.nib", ".pc", "~.plst", "RCS", "SCCS", "_sgbak", ".svn", "_obj", ".idea"}
+
+// NewReplacer validates the options and creates a replacer
+func NewReplacer(opts Options) (*Replacer, error) {
+	if err := opts.init(); err != nil {
+		return nil, err
+	}
+
+	return &Replacer{opts: opts, Logger: os.Stderr, snippets: &snippetCache{contents: map[string]string{}}, commands: &commandCache{outputs: map[string]*commandOutput{}, failures: map[string]error{}}, FileSystem: osFS{}}, nil
+}
+
+// Options returns the (validated) options of the replacer
+func (r *Replacer) Options() Options {
+	return r.opts
+}
+
+// Log message
+func (r *Replacer) logMessage(message string) {
+	if r.opts.Verbose {
+		r.logf("%s\n", message)
+	}
+}
+
+// Log warning, also shown without verbose mode
+func (r *Replacer) logWarning(message string) {
+	r.logf("Warning: %s\n", message)
+}
+
+// Write formatted message to the logger, safe for concurrent use
+func (r *Replacer) logf(format string, args ...interface{}) {
+	r.loggerMutex.Lock()
+	defer r.loggerMutex.Unlock()
+
+	fmt.Fprintf(r.Logger, format, args...)
+}
+
+// ApplyChangesetsToFile applies changesets to file
+// and returns the output message and if the file was changed (written)
+func (r *Replacer) ApplyChangesetsToFile(fileitem FileItem, changesets []Changeset) (string, bool, error) {
+	result := r.applyChangesetsToFile(fileitem, changesets, nil)
+	return result.Output, result.Changed, result.Error
+}
+
+// Applies changesets to file and returns the full result
+// Processing is stopped and the file is not written if timeout (--regex-timeout) expired
+func (r *Replacer) applyChangesetsToFile(fileitem FileItem, changesets []Changeset, timeout *fileTimeout) ChangeResult {
+	// try open file
+	file, err := r.FileSystem.Open(fileitem.Path)
+	if err != nil {
+		return ChangeResult{File: fileitem, Error: err}
+	}
+
+	// large files are written while reading instead of buffering the content,
+	// only on disk as the temporary file is written next to the file
+	if osFile, ok := file.(*os.File); ok && r.isOSFileSystem() {
+		if info, err := osFile.Stat(); err == nil && info.Size() >= streamMinSize && r.canStreamFile(changesets, timeout) {
+			return r.streamChangesetsToFile(fileitem, osFile, changesets)
+		}
+	}
+
+	// track matches per file
+	changesets = resetChangesets(changesets)
+
+	writeBufferToFile := false
+	var buffer bytes.Buffer
+	var previewLines []previewLine
+
+	// line ending of the first line is used for added lines
+	newline := ""
+
+	reader := bufio.NewReader(file)
+
+	// --preserve-bom
+	// byte order mark is not part of the first line
+	bom := readByteOrderMark(reader)
+
+	// original content to detect replacements without effect
+	var original strings.Builder
+	original.WriteString(bom)
+
+	if bom != "" && r.opts.PreserveBOM == "no" {
+		bom = ""
+		writeBufferToFile = true
+	}
+
+	lines := r.newLineProcessor(reader, fileitem.Path, changesets)
+	for {
+		// --regex-timeout, file is skipped
+		if timeout.expired() {
+			file.Close()
+			return ChangeResult{File: fileitem, Error: errTimeout}
+		}
+
+		line, err := lines.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			file.Close()
+			return ChangeResult{File: fileitem, Error: err}
+		}
+
+		if newline == "" {
+			newline = line.ending
+		}
+		original.WriteString(line.original + line.originalEnding)
+
+		if line.changed || line.skip {
+			writeBufferToFile = true
+
+			// --preview
+			if r.opts.Preview {
+				previewLines = append(previewLines, previewLine{lines.lineNumber, line.original, line.text, line.skip})
+			}
+		}
+
+		// --line-ending
+		if line.ending != line.originalEnding {
+			writeBufferToFile = true
+		}
+
+		if !line.skip {
+			buffer.WriteString(line.text + line.ending)
+		}
+	}
+	file.Close()
+
+	// --replace-cmd, file isn't written if the command failed
+	if err := r.commandFailure(fileitem.Path); err != nil {
+		return ChangeResult{File: fileitem, Error: err}
+	}
+
+	result := newChangeResult(fileitem, changesets)
+
+	if newline == "" {
+		newline = r.defaultLineEnding()
+	}
+
+	// --mode=lineinfile
+	if r.hasLineInFileChangesets(changesets) {
+		lifBuffer, lifStatus := r.handleLineInFile(changesets, buffer, newline)
+		if lifStatus {
+			buffer.Reset()
+			buffer.WriteString(lifBuffer.String())
+			writeBufferToFile = lifStatus
+		}
+	}
+
+	// --ensure-header
+	// header uses the line ending of the file
+	if header := strings.Replace(r.opts.header, "\n", newline, -1); header != "" && !strings.HasPrefix(buffer.String(), header) {
+		content := buffer.String()
+		buffer.Reset()
+		buffer.WriteString(header + content)
+		writeBufferToFile = true
+	}
+
+	// --no-newline-at-eof
+	// --ensure-newline-at-eof
+	if content := r.newlineAtEOF(buffer.String(), newline); content != buffer.String() {
+		buffer.Reset()
+		buffer.WriteString(content)
+		writeBufferToFile = true
+	}
+
+	// --output
+	// --output-strip-ext
+	// enforcing writing of file (creating new file)
+	if r.opts.Output != "" || r.opts.OutputStripFileExt != "" {
+		writeBufferToFile = true
+	}
+
+	if !writeBufferToFile {
+		result.Output = r.unchangedOutput(result)
+
+		// --copy-unchanged
+		if r.opts.CopyUnchanged {
+			result.Output, result.Error = r.copyUnchangedFile(fileitem)
+		}
+		return result
+	}
+
+	// --force-write, --max-replacements-per-file, --total-limit
+	if !r.writeChanges(&result, fileitem.Output == fileitem.Path && bom+buffer.String() == original.String()) {
+		return result
+	}
+
+	// --preview
+	if r.opts.Preview {
+		result.Output = formatPreview(fileitem, previewLines)
+		result.Changed = true
+		return result
+	}
+
+	// --regex-timeout, file is skipped if timeout expired already
+	if !timeout.startWrite() {
+		result.Error = errTimeout
+		return result
+	}
+
+	// --preserve-bom
+	if bom != "" {
+		content := buffer.String()
+		buffer.Reset()
+		buffer.WriteString(bom + content)
+	}
+
+	result.Output, result.Error = r.writeContentToFile(fileitem, buffer)
+	result.Changed = result.Error == nil
+
+	return result
+}
+
+// ApplyTemplateToFile parses file as template and writes the result
+func (r *Replacer) ApplyTemplateToFile(fileitem FileItem, changesets []Changeset) (string, bool, error) {
+	var (
+		err    error  = nil
+		output string = ""
+	)
+
+	// try open file
+	buffer, err := r.readFile(fileitem.Path)
+	if err != nil {
+		return output, false, err
+	}
+
+	content, err := r.ParseContentAsTemplate(string(buffer), changesets)
+	if err != nil {
+		return output, false, err
+	}
+
+	// --no-newline-at-eof
+	// --ensure-newline-at-eof
+	if eof := r.newlineAtEOF(content.String(), r.defaultLineEnding()); eof != content.String() {
+		content.Reset()
+		content.WriteString(eof)
+	}
+
+	output, err = r.writeContentToFile(fileitem, content)
+	if err != nil {
+		return output, false, err
+	}
+
+	return output, true, nil
+}
+
+// Position of the processed line
+type linePosition struct {
+	File string
+	Line int
+
+	// original lines around the processed line (--enable-line-context)
+	Previous string
+	Next     string
+}
+
+// ApplyChangesetsToLine applies changesets to one line
+// and returns the new line, if the line was changed and if the line should be skipped
+func (r *Replacer) ApplyChangesetsToLine(line string, changesets []Changeset) (string, bool, bool) {
+	newLine, lineChanged, skipLine := r.applyChangesetsToLine(line, changesets, linePosition{}, r.newCodeScanner())
+
+	// --replace-cmd, there is no file to report the failure for
+	if err := r.commandFailure(""); err != nil {
+		r.logWarning(fmt.Sprintf("%s, match not changed", err))
+	}
+
+	return newLine, lineChanged, skipLine
+}
+
+// ApplyChangesetsToReader applies changesets to all lines read from in and writes them to out,
+// name is used as file name for the line position
+func (r *Replacer) ApplyChangesetsToReader(in io.Reader, out io.Writer, name string, changesets []Changeset) error {
+	// --mode=json, whole document is needed
+	if r.opts.ModeIsJSON {
+		return r.applyJSONToReader(in, out, name, changesets)
+	}
+
+	// --mode=yaml, whole document is needed
+	if r.opts.ModeIsYAML {
+		return r.applyYAMLToReader(in, out, name, changesets)
+	}
+
+	// --paragraph-mode, whole paragraphs are needed
+	if r.opts.ParagraphMode {
+		return r.applyParagraphsToReader(in, out, changesets)
+	}
+
+	// --ensure-header, the start of the content is compared with the header
+	reader := bufio.NewReaderSize(in, maxInt(4096, 2*len(r.opts.header)+2))
+
+	// --preserve-bom
+	if bom := readByteOrderMark(reader); bom != "" && r.opts.PreserveBOM != "no" {
+		if _, err := io.WriteString(out, bom); err != nil {
+			return err
+		}
+	}
+
+	// --ensure-header
+	if r.opts.header != "" {
+		if err := r.ensureHeaderOnReader(reader, out); err != nil {
+			return err
+		}
+	}
+
+	// --no-newline-at-eof
+	// --ensure-newline-at-eof
+	writer := &eofLineWriter{out: out, noNewline: r.opts.NoNewlineAtEOF, ensureNewline: r.opts.EnsureNewlineAtEOF}
+
+	lines := r.newLineProcessor(reader, name, changesets)
+	for {
+		line, err := lines.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if !line.skip {
+			if err := writer.writeLine(line.text, line.ending); err != nil {
+				return err
+			}
+		}
+	}
+
+	// --replace-cmd
+	if err := r.commandFailure(name); err != nil {
+		return err
+	}
+
+	return writer.close(r.defaultLineEnding())
+}
+
+// Writes lines to out, with --no-newline-at-eof or --ensure-newline-at-eof line endings
+// and empty lines are held back until more content follows, so the end can still be changed
+type eofLineWriter struct {
+	out           io.Writer
+	noNewline     bool
+	ensureNewline bool
+
+	pending string // held back line endings and empty lines
+	written bool   // content was written
+	newline string // first line ending, used for an added line ending
+}
+
+func (w *eofLineWriter) writeLine(line string, lineEnding string) error {
+	if !w.noNewline && !w.ensureNewline {
+		_, err := io.WriteString(w.out, line+lineEnding)
+		return err
+	}
+
+	if w.newline == "" {
+		w.newline = lineEnding
+	}
+
+	if line == "" {
+		w.pending += lineEnding
+		return nil
+	}
+
+	_, err := io.WriteString(w.out, w.pending+line)
+	w.pending = lineEnding
+	w.written = true
+	return err
+}
+
+// Write the end of the content like newlineAtEOF, newline is used if there was no line ending
+func (w *eofLineWriter) close(newline string) error {
+	if !w.ensureNewline || (!w.written && w.pending == "") {
+		return nil
+	}
+
+	// keep existing line ending of last line
+	if strings.HasPrefix(w.pending, "\r\n") {
+		newline = "\r\n"
+	} else if strings.HasPrefix(w.pending, "\n") {
+		newline = "\n"
+	} else if w.newline != "" {
+		newline = w.newline
+	}
+
+	_, err := io.WriteString(w.out, newline)
+	return err
+}
+
+// Write --ensure-header to out unless the content of reader starts with it already,
+// the header uses the line ending of the first line like in files
+func (r *Replacer) ensureHeaderOnReader(reader *bufio.Reader, out io.Writer) error {
+	// header with CRLF line endings is at most twice as long
+	prefix, _ := reader.Peek(2*len(r.opts.header) + 2)
+
+	newline := r.defaultLineEnding()
+	if i := bytes.IndexByte(prefix, '\n'); i >= 0 {
+		newline = r.lineEnding("\n")
+		if i > 0 && prefix[i-1] == '\r' {
+			newline = r.lineEnding("\r\n")
+		}
+	}
+
+	header := strings.Replace(r.opts.header, "\n", newline, -1)
+	if bytes.HasPrefix(prefix, []byte(header)) {
+		return nil
+	}
+
+	_, err := io.WriteString(out, header)
+	return err
+}
+
+// Content with line endings at the end changed by --no-newline-at-eof
+// or --ensure-newline-at-eof, newline is used for an added line ending
+func (r *Replacer) newlineAtEOF(content string, newline string) string {
+	if !r.opts.NoNewlineAtEOF && !r.opts.EnsureNewlineAtEOF {
+		return content
+	}
+
+	trimmed := strings.TrimRight(content, "\r\n")
+	if r.opts.EnsureNewlineAtEOF && content != "" {
+		// keep existing line ending of last line
+		if strings.HasPrefix(content[len(trimmed):], "\r\n") {
+			newline = "\r\n"
+		} else if strings.HasPrefix(content[len(trimmed):], "\n") {
+			newline = "\n"
+		}
+
+		return trimmed + newline
+	}
+
+	return trimmed
+}
+
+// Line ending for a line based on its original line ending and --line-ending,
+// only existing line endings are converted like dos2unix and unix2dos do
+// (a last line without line ending is kept, see --ensure-newline-at-eof)
+func (r *Replacer) lineEnding(original string) string {
+	if original == "" {
+		return original
+	}
+
+	switch r.opts.LineEnding {
+	case "lf":
+		return "\n"
+	case "crlf":
+		return "\r\n"
+	}
+
+	// keep
+	return original
+}
+
+// Line ending of added lines if the file has none (--line-ending), newline in keep mode
+func (r *Replacer) defaultLineEnding() string {
+	if r.opts.LineEnding == "crlf" {
+		return "\r\n"
+	}
+
+	return "\n"
+}
+
+// Applies changesets to one line, scanner is used for --lang (nil if not set)
+func (r *Replacer) applyChangesetsToLine(line string, changesets []Changeset, position linePosition, scanner *codeScanner) (string, bool, bool) {
+	changed := false
+	skipLine := false
+	lineReplaced := false
+	originalLine := line
+
+	// --trim
+	// match against line without surrounding whitespace
+	var leadingSpace, trailingSpace string
+	if r.opts.Trim {
+		leadingSpace, line, trailingSpace = splitSurroundingWhitespace(line)
+	}
+
+	// --lang, --in
+	// split line into code, comments and strings
+	var segments []codeSegment
+	if scanner != nil {
+		segments = scanner.scan(line)
+	}
+
+	// --only-lines, --min-indent, --max-indent
+	// line is still scanned to keep state of multiline comments and strings
+	if !r.opts.lineSelected(position.Line) || !r.opts.indentSelected(originalLine) {
+		return originalLine, false, false
+	}
+
+	for i, changeset := range changesets {
+		mode := r.changesetMode(changeset)
+		limit := r.changesetLimit(changeset)
+
+		// --total-limit, replacements left in the run
+		remaining := r.totalLimitRemaining(changesets)
+
+		// --limit, --once
+		// only apply changeset until limit is reached in file
+		if limit > 0 && changeset.MatchCount >= limit {
+			// --once=unique, skip matching lines
+			if r.opts.Once == "unique" && r.searchMatch(line, changeset) {
+				// matching line, not writing to buffer as requsted
+				skipLine = true
+				changed = true
+				break
+			}
+		} else {
+			// search and replace
+			if r.lineMatch(line, segments, changeset) {
+				// --mode=line, --mode=lineinfile, --mode=prepend or --mode=append
+				if mode != "replace" {
+					// --nth, only replace the nth matching line
+					if (r.opts.Nth == 0 || changeset.MatchCount+1 == r.opts.Nth) && remaining != 0 {
+						var replacement string
+						if changeset.replaceTemplate != nil {
+							// --go-template, render template with first match
+							match := changeset.Search.FindStringSubmatchIndex(line)
+							replacement = string(r.renderReplaceTemplate(nil, changeset, line, match, position))
+						} else if r.opts.RegexBackref {
+							// get match
+							replacement = string(changeset.Search.Find([]byte(line)))
+
+							// replace regex backrefs in match
+							replacement = changeset.Search.ReplaceAllString(replacement, r.expandLineContext(r.replaceTerm(changeset), position))
+						} else {
+							replacement = r.expandLineContext(r.replaceTerm(changeset), position)
+						}
+
+						if mode == "prepend" {
+							// add replace term to start of line
+							line = replacement + line
+						} else if mode == "append" {
+							// add replace term to end of line
+							line = line + replacement
+						} else if mode == "keyvalue" {
+							// --mode=keyvalue
+							// replace value, keeping key, delimiter and their spacing
+							line = changeset.Search.FindString(line) + replacement
+						} else if r.opts.InvertMatch && replacement == "" {
+							// --invert-match, empty replace term removes non-matching lines,
+							// only matching lines are kept like with grep
+							skipLine = true
+						} else if r.opts.PreserveIndent {
+							// --preserve-indent
+							// replace whole line with replace term, keeping indentation
+							line = leadingIndent(originalLine) + replacement
+							lineReplaced = true
+						} else {
+							// replace whole line with replace term
+							line = replacement
+							lineReplaced = true
+						}
+
+						changed = true
+						changesets[i].ReplaceCount++
+					}
+
+					changesets[i].MatchCount++
+				} else {
+					// replace only term inside line, respecting --limit and --nth
+					skip, max := r.replaceRange(changeset.MatchCount, limit)
+
+					// --once-per-line
+					if r.opts.OncePerLine && max != 0 {
+						max = 1
+					}
+
+					// --total-limit
+					if remaining >= 0 && (max < 0 || max > remaining) {
+						max = remaining
+					}
+
+					var replaceCount, matchCount int
+					if segments != nil {
+						// --in, only replace in selected segments
+						replaceCount, matchCount = r.replaceTextInSegments(segments, changeset, skip, max, position)
+						line = joinSegments(segments)
+					} else {
+						line, replaceCount, matchCount = r.replaceTextPasses(line, changeset, skip, max, position)
+					}
+
+					changesets[i].MatchCount += matchCount
+					changesets[i].ReplaceCount += replaceCount
+					if replaceCount > 0 {
+						changed = true
+					}
+				}
+
+				changesets[i].MatchFound = true
+
+				// removed line isn't changed by further changesets
+				if skipLine {
+					break
+				}
+			}
+		}
+	}
+
+	// --squeeze-whitespace
+	if r.opts.SqueezeWhitespace && changed && !skipLine {
+		line = squeezeWhitespace(line)
+	}
+
+	// --drop-empty-lines
+	// remove lines which only consisted of deleted matches
+	if r.opts.DropEmptyLines && changed && strings.TrimSpace(line) == "" {
+		skipLine = true
+	}
+
+	// --trim
+	// restore original whitespace, replaced lines keep their indentation
+	// unless --trim-indent is used
+	if r.opts.Trim {
+		if !lineReplaced {
+			line = leadingSpace + line + trailingSpace
+		} else if !r.opts.PreserveIndent {
+			// --preserve-indent indented the line already
+			line = r.opts.trimIndent(leadingSpace) + line
+		}
+	}
+
+	return line, changed, skipLine
+}
+
+// Mode of changeset, rules of --rules-json can use a different mode than --mode
+func (r *Replacer) changesetMode(changeset Changeset) string {
+	if changeset.mode != "" {
+		return changeset.mode
+	}
+
+	switch {
+	case r.opts.ModeIsReplaceLine:
+		return "line"
+	case r.opts.ModeIsLineInFile:
+		return "lineinfile"
+	case r.opts.ModeIsPrepend:
+		return "prepend"
+	case r.opts.ModeIsAppend:
+		return "append"
+	case r.opts.ModeIsKeyValue:
+		return "keyvalue"
+	}
+
+	return "replace"
+}
+
+// Checks if lines of any changeset are added if not found (lineinfile, keyvalue)
+func (r *Replacer) hasLineInFileChangesets(changesets []Changeset) bool {
+	for _, changeset := range changesets {
+		if mode := r.changesetMode(changeset); mode == "lineinfile" || mode == "keyvalue" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Maximum number of matches of changeset in a file (0 for unlimited)
+func (r *Replacer) changesetLimit(changeset Changeset) int {
+	// --rules-json, once of the rule
+	if changeset.once {
+		return 1
+	}
+
+	return r.opts.matchLimit()
+}
+
+// Range of matches to replace based on the matches already found in the file
+// Returns the number of matches to skip and the maximum number of replacements (negative for unlimited)
+func (r *Replacer) replaceRange(matchCount int, limit int) (int, int) {
+	// --nth
+	if r.opts.Nth > 0 {
+		if matchCount >= r.opts.Nth {
+			return 0, 0
+		}
+
+		return r.opts.Nth - 1 - matchCount, 1
+	}
+
+	// --limit, --once
+	if limit > 0 {
+		return 0, limit - matchCount
+	}
+
+	return 0, -1
+}
+
+// Count replacements of all changesets
+func countReplacements(changesets []Changeset) int {
+	count := 0
+	for _, changeset := range changesets {
+		count += changeset.ReplaceCount
+	}
+
+	return count
+}
+
+// Replacements of each changeset with at least one replacement
+func changeCounts(changesets []Changeset) []ChangeCount {
+	var ret []ChangeCount
+	for _, changeset := range changesets {
+		if changeset.ReplaceCount > 0 {
+			ret = append(ret, ChangeCount{changeset.SearchPlain, changeset.Replace, changeset.ReplaceCount})
+		}
+	}
+
+	return ret
+}
+
+// Checks if any search term of the changesets matched
+func changesetsMatched(changesets []Changeset) bool {
+	for _, changeset := range changesets {
+		if changeset.MatchFound {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Search terms of the changesets which matched
+func matchedSearches(changesets []Changeset) []string {
+	var ret []string
+	for _, changeset := range changesets {
+		if changeset.MatchFound {
+			ret = append(ret, changeset.SearchPlain)
+		}
+	}
+
+	return ret
+}
+
+// UnmatchedSearches returns the search terms of the changesets which didn't
+// match in any of the results (--require-match), matches of --check and
+// --locations are included
+func UnmatchedSearches(changesets []Changeset, results []ChangeResult) []string {
+	matched := map[string]bool{}
+	for _, result := range results {
+		for _, search := range result.Searches {
+			matched[search] = true
+		}
+		for _, match := range result.Matches {
+			matched[match.Search] = true
+		}
+	}
+
+	var ret []string
+	for _, changeset := range changesets {
+		if !matched[changeset.SearchPlain] && !contains(ret, changeset.SearchPlain) {
+			ret = append(ret, changeset.SearchPlain)
+		}
+	}
+
+	return ret
+}
+
+// Copy changesets with reset match state, so each file is tracked on its own
+func resetChangesets(changesets []Changeset) []Changeset {
+	ret := make([]Changeset, len(changesets))
+	for i, changeset := range changesets {
+		changeset.MatchFound = false
+		changeset.MatchCount = 0
+		changeset.ReplaceCount = 0
+		if changeset.cycle != nil {
+			changeset.cycleIndex = new(int)
+		}
+		ret[i] = changeset
+	}
+
+	return ret
+}
+
+// BuildSearchTerm builds the search term
+// Compiles regexp if regexp is used
+func (r *Replacer) BuildSearchTerm(term string) (*regexp.Regexp, error) {
+	return r.buildSearchRegex(term, r.opts.Regex, r.opts.CaseInsensitive)
+}
+
+// Builds the search term with the regex and case settings of a rule
+func (r *Replacer) buildSearchRegex(term string, useRegex bool, caseInsensitive bool) (*regexp.Regexp, error) {
+	var ret *regexp.Regexp
+	var regex string
+	var err error
+
+	// --regex
+	if useRegex {
+		// use search term as regex
+		regex = term
+	} else if r.opts.Glob {
+		// --glob
+		regex = globToRegex(term)
+	} else {
+		// use search term as normal string, escape it for regex usage
+		regex = regexp.QuoteMeta(term)
+	}
+
+	// --ignore-case
+	if caseInsensitive {
+		regex = "(?i:" + regex + ")"
+
+		// (?i) only uses simple case folding, eg. "ß" should also match "SS"
+		// invalid regex are reported when compiling them
+		if !r.opts.RegexPosix {
+			if folded, err := fullCaseFoldRegex(regex); err == nil {
+				regex = folded
+			}
+		}
+	}
+
+	// --mode=keyvalue
+	// search term is the key, the match is everything up to the value
+	if r.opts.ModeIsKeyValue {
+		regex = keyValuePrefixRegex(regex, r.opts.KVDelimiter)
+	}
+
+	// --followed-by
+	// RE2 has no lookahead, the following text is captured as last group
+	// and added to the replace term again (see buildChangeset)
+	if r.opts.FollowedBy != "" {
+		regex = "(?:" + regex + ")(" + r.opts.FollowedBy + ")"
+	}
+
+	// --verbose
+	r.logMessage(fmt.Sprintf("Using regular expression: %s", regex))
+
+	// --regex-posix
+	if r.opts.RegexPosix {
+		ret, err = regexp.CompilePOSIX(regex)
+	} else {
+		ret, err = regexp.Compile(regex)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid search term \"%s\": %s", term, err)
+	}
+
+	return ret, nil
+}
+
+// ProcessFiles applies the changesets to all files concurrently
+// Results are sorted by file path, independent of processing order
+// On cancellation no further files are processed and the results of
+// the already processed files are returned together with the context error
+// OnResult is called for every result as soon as the file was processed
+func (r *Replacer) ProcessFiles(ctx context.Context, changesets []Changeset, fileitems []FileItem) ([]ChangeResult, error) {
+	// --concat, files depend on each other
+	if r.opts.Concat {
+		return r.processConcat(ctx, changesets, fileitems)
+	}
+
+	swg := sizedwaitgroup.New(r.workerCount())
+	results := make(chan ChangeResult, len(fileitems))
+
+	// --memory-limit, large files are not processed all at the same time
+	var memory *memoryLimiter
+	if r.opts.memoryLimit > 0 {
+		memory = newMemoryLimiter(r.opts.memoryLimit)
+	}
+
+	// --rename
+	// new names are planned one after another to detect collisions,
+	// before the content of any file is written
+	var renames map[string]renamePlan
+	if r.opts.Rename != "" {
+		renames = map[string]renamePlan{}
+		renamed := map[string]bool{}
+		for _, file := range fileitems {
+			renames[file.Path] = r.planRename(file, changesets, renamed)
+		}
+	}
+
+	// collect results while files are processed
+	collected := make(chan []ChangeResult)
+	go func() {
+		var ret []ChangeResult
+
+		for result := range results {
+			// --rename
+			if plan, ok := renames[result.File.Path]; ok && result.Error == nil {
+				r.renameFile(&result, plan)
+			}
+
+			if r.OnResult != nil {
+				r.OnResult(result)
+			}
+
+			ret = append(ret, result)
+		}
+
+		collected <- ret
+	}()
+
+	// process file list
+	for _, file := range fileitems {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var size int64
+		if memory != nil {
+			size = r.estimateFileMemory(file)
+			if err := memory.acquire(ctx, size); err != nil {
+				break
+			}
+		}
+
+		if err := swg.AddWithContext(ctx); err != nil {
+			if memory != nil {
+				memory.release(size)
+			}
+			break
+		}
+
+		go func(file FileItem, changesets []Changeset, size int64) {
+			defer swg.Done()
+			if memory != nil {
+				defer memory.release(size)
+			}
+
+			// skip file if cancelled while waiting for a worker
+			if ctx.Err() != nil {
+				return
+			}
+
+			// --rename, file which can't be renamed is left untouched
+			if plan, ok := renames[file.Path]; ok && plan.err != nil {
+				results <- ChangeResult{File: file, Error: plan.err}
+				return
+			}
+
+			start := time.Now()
+			result := r.processFile(file, changesets)
+			result.Duration = time.Since(start)
+			r.recordAudit(&result)
+
+			results <- result
+		}(file, changesets, size)
+	}
+
+	// wait for all changes to be processed
+	swg.Wait()
+	close(results)
+	ret := <-collected
+
+	// deterministic output order
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].File.Path < ret[j].File.Path
+	})
+
+	return ret, ctx.Err()
+}
+
+// Process one file depending on mode and options
+func (r *Replacer) processFile(file FileItem, changesets []Changeset) ChangeResult {
+	// --require-content
+	// skip files without marker before applying any changeset
+	if r.opts.requireContent != nil {
+		found, err := r.containsRequiredContent(file)
+		if err != nil {
+			return ChangeResult{File: file, Error: err}
+		} else if !found {
+			return ChangeResult{File: file, Output: fmt.Sprintf("%s skipped, required content not found", file.Path)}
+		}
+	}
+
+	if r.isScannedTar(file.Path) {
+		// --scan-tar, files inside of the archive are only searched
+		return r.scanTarFile(file, changesets)
+	} else if r.opts.Check || r.opts.Locations {
+		// --check, --locations, content is only searched
+		output, matches, err := r.checkFile(file, changesets)
+		return ChangeResult{File: file, Output: output, Matched: len(matches) > 0, Matches: matches, Error: err}
+	} else if r.opts.FilesWithMatches {
+		// --files-with-matches, only path of matching files is reported
+		matched, err := r.fileMatches(file, changesets)
+		return ChangeResult{File: file, Output: file.Path, Matched: matched, Error: err}
+	} else if r.opts.Rename == "only" {
+		// --rename=only, content is kept
+		return ChangeResult{File: file, Output: fmt.Sprintf("%s content not changed", file.Path)}
+	} else if r.opts.ModeIsJSON {
+		// --mode=json, value at --json-path is replaced
+		return r.applyJSONToFile(file, changesets)
+	} else if r.opts.ModeIsYAML {
+		// --mode=yaml, scalar value at --yaml-path is replaced
+		return r.applyYAMLToFile(file, changesets)
+	} else if r.opts.ModeIsTemplate {
+		// templates have no search terms to match
+		output, changed, err := r.ApplyTemplateToFile(file, changesets)
+		return ChangeResult{File: file, Output: output, Changed: changed, Matched: true, Error: err}
+	} else if r.opts.ParagraphMode {
+		// --paragraph-mode, search terms can match across lines of a paragraph
+		return r.applyParagraphsToFile(file, changesets)
+	} else if r.opts.regexTimeout > 0 {
+		// --regex-timeout
+		return r.applyChangesetsToFileWithTimeout(file, changesets)
+	}
+
+	return r.applyChangesetsToFile(file, changesets, nil)
+}
+
+// Record changed file in audit log, failing to do so is an error of the file
+func (r *Replacer) recordAudit(result *ChangeResult) {
+	// --dry-run, nothing was changed
+	if r.AuditLog == nil || r.opts.DryRun {
+		return
+	}
+
+	if err := r.AuditLog.Record(*result); err != nil {
+		result.Error = err
+	}
+}
+
+// Number of files processed at the same time
+func (r *Replacer) workerCount() int {
+	// --parallel=none
+	// --total-limit, files are changed in a deterministic order
+	if r.opts.Parallel == "none" || r.opts.TotalLimit > 0 {
+		return 1
+	}
+
+	// --threads
+	if r.opts.ThreadCount > 0 {
+		return r.opts.ThreadCount
+	}
+
+	return 8
+}
+
+// Replacements left in --total-limit, replacements of the current file (changesets)
+// are already taken into account. Negative without limit.
+func (r *Replacer) totalLimitRemaining(changesets []Changeset) int {
+	if r.opts.TotalLimit == 0 {
+		return -1
+	}
+
+	remaining := r.opts.TotalLimit - int(atomic.LoadInt64(&r.totalReplacements)) - countReplacements(changesets)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// Reserve the replacements of a file in --total-limit, returns false if they
+// exceed the remaining limit (eg. with --repeat). Files are limited to the remaining
+// replacements while processing (see totalLimitRemaining), so this is a safety net.
+func (r *Replacer) reserveTotalLimit(replacements int) bool {
+	if r.opts.TotalLimit == 0 || replacements == 0 {
+		return true
+	}
+
+	for atomic.LoadInt32(&r.totalLimitReached) == 0 {
+		total := atomic.LoadInt64(&r.totalReplacements)
+		if total+int64(replacements) > int64(r.opts.TotalLimit) {
+			atomic.StoreInt32(&r.totalLimitReached, 1)
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&r.totalReplacements, total, total+int64(replacements)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BuildChangesets builds the changesets from the search and replace options
+func (r *Replacer) BuildChangesets() ([]Changeset, error) {
+	var changesets []Changeset
+
+	// --if-line-matches
+	var lineCondition *regexp.Regexp
+	if r.opts.IfLineMatches != "" {
+		lineCondition = regexp.MustCompile(r.opts.IfLineMatches)
+	}
+
+	// --mode=json, the only changeset replaces the value at --json-path
+	if r.opts.ModeIsJSON {
+		return []Changeset{{SearchPlain: r.opts.JSONPath, Replace: r.replaceValue(r.opts.Replace[0])}}, nil
+	}
+
+	// --mode=yaml, the only changeset replaces the value at --yaml-path
+	if r.opts.ModeIsYAML {
+		return []Changeset{{SearchPlain: r.opts.YAMLPath, Replace: r.replaceValue(r.opts.Replace[0])}}, nil
+	}
+
+	// --map
+	if r.opts.Map != "" {
+		changeset, err := r.buildMapChangeset()
+		if err != nil {
+			return nil, err
+		}
+		changeset.lineCondition = lineCondition
+		return []Changeset{changeset}, nil
+	}
+
+	searchList := r.opts.Search
+	replaceList := r.opts.Replace
+
+	// --search-file
+	if r.opts.SearchFile != "" {
+		terms, err := readSearchFile(r.opts.SearchFile)
+		if err != nil {
+			return nil, err
+		}
+		searchList = append(append([]string{}, searchList...), terms...)
+
+		// single replace term is used for all search terms
+		if len(replaceList) == 1 && len(searchList) > 1 {
+			replaceList = make([]string, len(searchList))
+			for i := range replaceList {
+				replaceList[i] = r.opts.Replace[0]
+			}
+		}
+	}
+
+	// --cycle-replace, list is used as replace term of all search terms
+	if r.opts.cycleReplace != nil {
+		replaceList = make([]string, len(searchList))
+		for i := range replaceList {
+			replaceList[i] = r.opts.CycleReplace
+		}
+	}
+
+	// --check, --locations, --files-with-matches, replace terms are not needed
+	if (r.opts.Check || r.opts.Locations || r.opts.FilesWithMatches) && len(replaceList) == 0 {
+		replaceList = make([]string, len(searchList))
+	}
+
+	// --replace-cmd, replacements are the output of the command
+	if r.opts.ReplaceCmd != "" {
+		replaceList = make([]string, len(searchList))
+	}
+
+	// --rules-json
+	var rules []replaceRule
+	if r.opts.RulesJSON != "" {
+		var err error
+		if rules, err = readRulesFile(r.opts.RulesJSON); err != nil {
+			return nil, err
+		}
+	}
+
+	// --ensure-header, --strip-trailing-whitespace, search terms are optional
+	cleanupOnly := (r.opts.header != "" || r.opts.StripTrailingWS) && len(searchList) == 0 && len(replaceList) == 0
+
+	if !r.opts.ModeIsTemplate && len(rules) == 0 && !cleanupOnly {
+		if len(searchList) == 0 || len(replaceList) == 0 {
+			// error: unequal numbers of search and replace options
+			return nil, errors.New("Missing either --search or --replace for this mode")
+		}
+	}
+
+	// check if search and replace options have equal lenght (equal number of options)
+	if len(searchList) != len(replaceList) {
+		// error: unequal numbers of search and replace options
+		return nil, errors.New("Unequal numbers of search or replace options")
+	}
+
+	// build changesets
+	for i := range searchList {
+		searchTerm, err := r.BuildSearchTerm(searchList[i])
+		if err != nil {
+			return nil, err
+		}
+
+		changeset, err := r.buildChangeset(searchList[i], searchTerm, replaceList[i], lineCondition)
+		if err != nil {
+			return nil, err
+		}
+
+		changesets = append(changesets, changeset)
+	}
+
+	// --rules-json, rules can use their own settings
+	for _, rule := range rules {
+		regex, caseInsensitive := r.opts.Regex, r.opts.CaseInsensitive
+		if rule.Regex != nil {
+			regex = *rule.Regex
+		}
+		if rule.IgnoreCase != nil {
+			caseInsensitive = *rule.IgnoreCase
+		}
+
+		searchTerm, err := r.buildSearchRegex(rule.Search, regex, caseInsensitive)
+		if err != nil {
+			return nil, err
+		}
+
+		changeset, err := r.buildChangeset(rule.Search, searchTerm, rule.Replace, lineCondition)
+		if err != nil {
+			return nil, err
+		}
+		changeset.mode = rule.Mode
+		changeset.once = rule.Once
+
+		changesets = append(changesets, changeset)
+	}
+
+	// --dedupe-changesets
+	if r.opts.DedupeChangesets {
+		return r.dedupeChangesets(changesets)
+	}
+
+	return changesets, nil
+}
+
+// Replace term as given by the options, --interpret-escapes is applied
+func (r *Replacer) replaceValue(replace string) string {
+	if r.opts.InterpretEscapes {
+		return interpretEscapes(replace)
+	}
+
+	return replace
+}
+
+// Builds changeset of search and replace term, the replace term is checked
+// (--go-template, --compute, --regex-backrefs) before any file is touched
+func (r *Replacer) buildChangeset(search string, searchTerm *regexp.Regexp, replace string, lineCondition *regexp.Regexp) (Changeset, error) {
+	replace = r.replaceValue(replace)
+
+	// --followed-by
+	// keep the captured following text, it is the last group of the search term
+	if r.opts.FollowedBy != "" {
+		if r.opts.followedByLiteral {
+			replace = strings.Replace(replace, "$", "$$", -1)
+		}
+		replace += fmt.Sprintf("${%d}", searchTerm.NumSubexp())
+	}
+
+	// --replace-escape
+	// dollars which are no reference to a group of the search term are literal
+	if r.opts.ReplaceEscape {
+		replace = escapeLiteralDollars(searchTerm, replace)
+	}
+
+	changeset := Changeset{SearchPlain: search, Search: searchTerm, Replace: replace, lineCondition: lineCondition}
+
+	// --cycle-replace
+	if r.opts.cycleReplace != nil {
+		changeset.cycle = r.opts.cycleReplace
+		changeset.cycleIndex = new(int)
+
+		// --replace-escape, terms are escaped for each search term
+		if r.opts.ReplaceEscape {
+			changeset.cycle = make([]string, len(r.opts.cycleReplace))
+			for i, term := range r.opts.cycleReplace {
+				changeset.cycle[i] = escapeLiteralDollars(searchTerm, term)
+			}
+		}
+	}
+
+	// --go-template
+	if r.opts.GoTemplate {
+		var err error
+		changeset.replaceTemplate, err = createTemplate().Parse(replace)
+		if err != nil {
+			return changeset, fmt.Errorf("Invalid replace template \"%s\": %s", replace, err)
+		}
+	}
+
+	// --generators
+	if r.opts.Generators {
+		if err := r.readSnippets(changeset.Replace); err != nil {
+			return changeset, fmt.Errorf("Invalid replace term \"%s\": %s", changeset.Replace, err)
+		}
+	}
+
+	// --compute
+	if r.opts.Compute {
+		if err := validateCompute(changeset.Search, changeset.Replace); err != nil {
+			return changeset, err
+		}
+	}
+
+	// --regex-backrefs
+	// check references before touching any file
+	if r.opts.RegexBackref {
+		// --replace-at-start is also expanded with the match
+		replaceTerms := []string{replace}
+		if r.opts.ReplaceAtStart != "" {
+			replaceTerms = append(replaceTerms, r.opts.ReplaceAtStart)
+		}
+
+		for _, replace := range replaceTerms {
+			// --generators, placeholders are no backrefs
+			if r.opts.Generators {
+				replace = generatorToken.ReplaceAllLiteralString(replace, "")
+			}
+			// --enable-line-context, ${prevline} and ${nextline} are no backrefs
+			if r.opts.EnableLineContext {
+				replace = lineContextToken.ReplaceAllLiteralString(replace, "")
+			}
+
+			if err := validateBackrefs(changeset.Search, replace); err != nil {
+				return changeset, err
+			}
+		}
+	}
+
+	return changeset, nil
+}
+
+// Checks if character is a word character as matched by \b
+func isASCIIWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Builds one changeset matching all words of the map file (--map),
+// longer words are preferred if they overlap
+func (r *Replacer) buildMapChangeset() (Changeset, error) {
+	replaceMap, err := readMapFile(r.opts.Map)
+	if err != nil {
+		return Changeset{}, err
+	}
+
+	if len(replaceMap) == 0 {
+		return Changeset{}, fmt.Errorf("No entries found in map file %s", r.opts.Map)
+	}
+
+	var words []string
+	for word := range replaceMap {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+
+	// match whole words only, \b is only added on a side ending with a word
+	// character, otherwise keys like c++ or .env would never match
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+		if isASCIIWordByte(word[0]) {
+			words[i] = "\\b" + words[i]
+		}
+		if isASCIIWordByte(word[len(word)-1]) {
+			words[i] += "\\b"
+		}
+	}
+	regex := "(?:" + strings.Join(words, "|") + ")"
+
+	// --ignore-case
+	if r.opts.CaseInsensitive {
+		regex = "(?i)" + regex
+
+		lowerMap := make(map[string]string, len(replaceMap))
+		for word, replace := range replaceMap {
+			lowerMap[strings.ToLower(word)] = replace
+		}
+		replaceMap = lowerMap
+	}
+
+	// --verbose
+	r.logMessage(fmt.Sprintf("Using regular expression: %s", regex))
+
+	search, err := regexp.Compile(regex)
+	if err != nil {
+		return Changeset{}, fmt.Errorf("Invalid map file %s: %s", r.opts.Map, err)
+	}
+
+	return Changeset{SearchPlain: r.opts.Map, Search: search, replaceMap: replaceMap}, nil
+}
+
+// BuildFileitems builds the file list from arguments and --path
+func (r *Replacer) BuildFileitems(ctx context.Context, args []string) ([]FileItem, error) {
+	var (
+		fileitems []FileItem
+		file      FileItem
+	)
+
+	// --output
+	if r.opts.Output != "" && len(args) > 1 {
+		return nil, errors.New("Only one file is allowed when using --output")
+	}
+
+	// Build filelist from arguments
+	for _, filepath := range args {
+		file = FileItem{filepath, filepath}
+
+		if r.opts.Output != "" {
+			// use specific output
+			file.Output = r.opts.Output
+		} else if r.opts.OutputStripFileExt != "" {
+			// remove file ext from saving destination
+			file.Output = strings.TrimSuffix(file.Output, r.opts.OutputStripFileExt)
+		} else if r.opts.OutputTemplate != "" {
+			// --output-template
+			file.Output = r.outputTemplatePath(file.Path)
+		} else if strings.Contains(filepath, ":") && r.opts.OutputDir == "" {
+			// argument like "source:destination"
+			split := strings.SplitN(filepath, ":", 2)
+
+			file.Path = split[0]
+			file.Output = split[1]
+		}
+
+		// --newer-than, --min-size, --max-size, --modified-after, --modified-before, --name-regex
+		// missing files are kept, they are reported as error when processed
+		if info, err := r.FileSystem.Stat(file.Path); err == nil && !info.IsDir() {
+			if reason := r.fileFilterSkipReason(info); reason != "" {
+				r.explainSkip(file.Path, reason)
+				continue
+			}
+		}
+
+		// --output-dir
+		// file arguments are mirrored relative to the current directory
+		if r.opts.OutputDir != "" {
+			output, err := r.outputDirPath(".", file.Output)
+			if err != nil {
+				return nil, err
+			}
+			file.Output = output
+		}
+
+		fileitems = append(fileitems, file)
+	}
+
+	// --path parsing
+	if r.opts.Path != "" {
+		// --since-git, a --path outside of a git repository is reported even if it contains no files
+		if r.opts.SinceGit {
+			if _, err := gitTopLevel(r.opts.Path); err != nil {
+				return nil, err
+			}
+		}
+
+		var outputErr error
+		err := r.SearchFilesInPath(ctx, r.opts.Path, func(f os.FileInfo, filepath string) {
+			file, err := r.pathFileItem(filepath)
+			if err != nil {
+				if outputErr == nil {
+					outputErr = err
+				}
+				return
+			}
+
+			fileitems = append(fileitems, file)
+		})
+		if err == nil {
+			err = outputErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// --since-git
+	if r.opts.SinceGit {
+		return filterGitChangedFiles(fileitems)
+	}
+
+	return fileitems, nil
+}
+
+// File item of a file found below --path
+func (r *Replacer) pathFileItem(path string) (FileItem, error) {
+	file := FileItem{path, path}
+
+	if r.opts.OutputStripFileExt != "" {
+		// remove file ext from saving destination
+		file.Output = strings.TrimSuffix(file.Output, r.opts.OutputStripFileExt)
+	} else if r.opts.OutputTemplate != "" {
+		// --output-template
+		file.Output = r.outputTemplatePath(file.Path)
+	}
+
+	// no colon parsing here
+
+	// --output-dir
+	if r.opts.OutputDir != "" {
+		// files are always below --path
+		output, err := r.outputDirPath(r.opts.Path, file.Output)
+		if err != nil {
+			return file, err
+		}
+		file.Output = output
+	}
+
+	return file, nil
+}
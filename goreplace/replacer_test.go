@@ -0,0 +1,1462 @@
+package goreplace
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cancelAfterContext cancels itself after its error was checked a number of times
+type cancelAfterContext struct {
+	context.Context
+	cancel context.CancelFunc
+	checks int32
+	limit  int32
+}
+
+func newCancelAfterContext(limit int32) *cancelAfterContext {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &cancelAfterContext{Context: ctx, cancel: cancel, limit: limit}
+}
+
+func (ctx *cancelAfterContext) Err() error {
+	if atomic.AddInt32(&ctx.checks, 1) >= ctx.limit {
+		ctx.cancel()
+	}
+
+	return ctx.Context.Err()
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func readTestFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func newTestReplacer(t *testing.T, opts Options) (*Replacer, []Changeset) {
+	r, err := NewReplacer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changesets, err := r.BuildChangesets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r, changesets
+}
+
+func TestApplyChangesetsToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "this is a testline\nthis is the third foobar line\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foobar"},
+		Replace: []string{"barfoo"},
+	})
+
+	_, changed, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("expected file to be changed")
+	}
+
+	expected := "this is a testline\nthis is the third barfoo line\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+func TestProcessFilesInPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	txtFile := writeTestFile(t, dir, "test.txt", "foobar line\n")
+	mdFile := writeTestFile(t, dir, "test.md", "foobar line\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Mode:        "line",
+		Search:      []string{"foobar"},
+		Replace:     []string{"replaced"},
+		Path:        dir,
+		PathPattern: "*.txt",
+	})
+
+	fileitems, err := r.BuildFileitems(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileitems) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(fileitems))
+	}
+
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.Error != nil {
+			t.Error(result.Error)
+		}
+	}
+
+	if content := readTestFile(t, txtFile); content != "replaced\n" {
+		t.Errorf("expected %q, got %q", "replaced\n", content)
+	}
+	if content := readTestFile(t, mdFile); content != "foobar line\n" {
+		t.Errorf("expected %q, got %q", "foobar line\n", content)
+	}
+}
+
+func TestBuildChangesetsMissingReplace(t *testing.T) {
+	r, err := NewReplacer(Options{Search: []string{"foobar"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.BuildChangesets(); err == nil {
+		t.Error("expected error for missing replace term")
+	}
+}
+
+func TestProcessFilesCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fileitems []FileItem
+	for i := 0; i < 50; i++ {
+		path := writeTestFile(t, dir, fmt.Sprintf("test%d.txt", i), "foobar\n")
+		fileitems = append(fileitems, FileItem{path, path})
+	}
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foobar"},
+		Replace: []string{"barfoo"},
+	})
+
+	results, err := r.ProcessFiles(newCancelAfterContext(10), changesets, fileitems)
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if len(results) >= len(fileitems) {
+		t.Errorf("expected less than %d processed files, got %d", len(fileitems), len(results))
+	}
+
+	changed := 0
+	for _, file := range fileitems {
+		if readTestFile(t, file.Path) == "barfoo\n" {
+			changed++
+		}
+	}
+	if changed != len(results) {
+		t.Errorf("expected %d changed files, got %d", len(results), changed)
+	}
+}
+
+func TestProcessFilesCancelWritesNoPartialFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	original := strings.Repeat("this is the foobar line\n", 10000)
+	replaced := strings.Repeat("this is the barfoo line\n", 10000)
+
+	var fileitems []FileItem
+	for i := 0; i < 30; i++ {
+		path := writeTestFile(t, dir, fmt.Sprintf("test%d.txt", i), original)
+		fileitems = append(fileitems, FileItem{path, path})
+	}
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foobar"},
+		Replace: []string{"barfoo"},
+	})
+
+	if _, err := r.ProcessFiles(newCancelAfterContext(10), changesets, fileitems); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	for _, file := range fileitems {
+		if content := readTestFile(t, file.Path); content != original && content != replaced {
+			t.Errorf("file %s was partially written", file.Path)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(fileitems) {
+		t.Errorf("expected %d files, found %d (temporary files left)", len(fileitems), len(entries))
+	}
+}
+
+func TestApplyChangesetsToFileLineEnding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		lineEnding string
+		content    string
+		expected   string
+	}{
+		{"keep", "foobar line\r\nsecond line\n", "barfoo line\r\nsecond line\n"},
+		{"lf", "foobar line\r\nsecond line\r\n", "barfoo line\nsecond line\n"},
+		{"crlf", "foobar line\nsecond line\n", "barfoo line\r\nsecond line\r\n"},
+		{"crlf", "no match\nsecond line", "no match\r\nsecond line"},
+		{"lf", "a\r\nb", "a\nb"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", test.content)
+
+		r, changesets := newTestReplacer(t, Options{
+			Search:     []string{"foobar"},
+			Replace:    []string{"barfoo"},
+			LineEnding: test.lineEnding,
+		})
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if content := readTestFile(t, path); content != test.expected {
+			t.Errorf("--line-ending=%s: expected %q, got %q", test.lineEnding, test.expected, content)
+		}
+	}
+}
+
+func TestProcessFilesMatched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	matchFile := writeTestFile(t, dir, "match.txt", "foobar line\n")
+	noMatchFile := writeTestFile(t, dir, "nomatch.txt", "barfoo line\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foobar"},
+		Replace: []string{"barfoo"},
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{matchFile, matchFile}, {noMatchFile, noMatchFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+
+		if expected := result.File.Path == matchFile; result.Matched != expected {
+			t.Errorf("%s: expected matched %v, got %v", result.File.Path, expected, result.Matched)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mapFile := writeTestFile(t, dir, "map.txt", "foo=bar\nfoobar=baz\nbar=foo\n")
+	path := writeTestFile(t, dir, "test.txt", "foo bar foobar\nfoofoo barfoo (foo)\n")
+
+	r, changesets := newTestReplacer(t, Options{Map: mapFile})
+	if len(changesets) != 1 {
+		t.Fatalf("expected 1 changeset, got %d", len(changesets))
+	}
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "bar foo baz\nfoofoo barfoo (bar)\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+func TestApplyChangesetsToFileMapNonWordKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mapFile := writeTestFile(t, dir, "map.txt", "c++=cpp\n.env=.envrc\n@foo=@bar\nenv=ENV\n")
+	path := writeTestFile(t, dir, "test.txt", "c++ .env @foo\nsrc/.env x@foo env environment\n")
+
+	r, changesets := newTestReplacer(t, Options{Map: mapFile})
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "cpp .envrc @bar\nsrc/.envrc x@bar ENV environment\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+func TestProcessFilesOrdered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fileitems []FileItem
+	for i := 30; i > 0; i-- {
+		path := writeTestFile(t, dir, fmt.Sprintf("test%02d.txt", i), "foobar\n")
+		fileitems = append(fileitems, FileItem{path, path})
+	}
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foobar"},
+		Replace: []string{"foobar"},
+	})
+
+	for run := 0; run < 5; run++ {
+		results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(results) != len(fileitems) {
+			t.Fatalf("expected %d results, got %d", len(fileitems), len(results))
+		}
+
+		for i, result := range results {
+			if expected := fileitems[len(fileitems)-1-i].Path; result.File.Path != expected {
+				t.Fatalf("run %d: expected %s at position %d, got %s", run, expected, i, result.File.Path)
+			}
+		}
+	}
+}
+
+func TestProcessFilesRename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	renameFile := writeTestFile(t, dir, "config_old.txt", "foobar_old\n")
+	collisionFile := writeTestFile(t, dir, "data_old.txt", "foobar_old\n")
+	writeTestFile(t, dir, "data_new.txt", "existing\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"_old"},
+		Replace: []string{"_new"},
+		Rename:  "content",
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{renameFile, renameFile}, {collisionFile, collisionFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		switch result.File.Path {
+		case renameFile:
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			if expected := filepath.Join(dir, "config_new.txt"); result.Renamed != expected {
+				t.Errorf("expected %s to be renamed to %s, got %q", renameFile, expected, result.Renamed)
+			}
+		case collisionFile:
+			if result.Error == nil {
+				t.Errorf("expected error for renaming %s to existing file", collisionFile)
+			}
+		}
+	}
+
+	if content := readTestFile(t, filepath.Join(dir, "config_new.txt")); content != "foobar_new\n" {
+		t.Errorf("expected %q, got %q", "foobar_new\n", content)
+	}
+	if _, err := os.Stat(renameFile); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", renameFile)
+	}
+	if content := readTestFile(t, filepath.Join(dir, "data_new.txt")); content != "existing\n" {
+		t.Errorf("expected existing file not to be overwritten, got %q", content)
+	}
+	if content := readTestFile(t, collisionFile); content != "foobar_old\n" {
+		t.Errorf("expected content of %s not to be changed, got %q", collisionFile, content)
+	}
+}
+
+func TestProcessFilesRenameDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "config_old.txt", "foobar_old\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"_old"},
+		Replace: []string{"_new"},
+		Rename:  "only",
+		DryRun:  true,
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{path, path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := filepath.Join(dir, "config_new.txt"); results[0].Renamed != expected {
+		t.Errorf("expected rename to %s, got %q", expected, results[0].Renamed)
+	}
+	if content := readTestFile(t, path); content != "foobar_old\n" {
+		t.Errorf("expected file not to be changed, got %q", content)
+	}
+}
+
+func TestApplyChangesetsToLineSqueezeWhitespace(t *testing.T) {
+	r, changesets := newTestReplacer(t, Options{
+		Search:            []string{"foobar"},
+		Replace:           []string{"barfoo"},
+		SqueezeWhitespace: true,
+	})
+
+	tests := map[string]string{
+		"\tkey  =\t\tfoobar   end": "\tkey = barfoo end",
+		"key  =  other":            "key  =  other",
+	}
+
+	for line, expected := range tests {
+		if newLine, _, _ := r.ApplyChangesetsToLine(line, changesets); newLine != expected {
+			t.Errorf("expected %q, got %q", expected, newLine)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileOncePerLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "foo and foo\nno match\nfoo foo foo\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:      []string{"foo"},
+		Replace:     []string{"bar"},
+		OncePerLine: true,
+	})
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "bar and foo\nno match\nbar foo foo\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+// concurrencyWriter tracks the maximum number of concurrent writes
+type concurrencyWriter struct {
+	active int32
+	max    int32
+}
+
+func (w *concurrencyWriter) Write(p []byte) (int, error) {
+	active := atomic.AddInt32(&w.active, 1)
+	defer atomic.AddInt32(&w.active, -1)
+
+	for {
+		max := atomic.LoadInt32(&w.max)
+		if active <= max || atomic.CompareAndSwapInt32(&w.max, max, active) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	return len(p), nil
+}
+
+func TestProcessFilesParallelNone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fileitems []FileItem
+	for i := 0; i < 10; i++ {
+		path := writeTestFile(t, dir, fmt.Sprintf("test%d.txt", i), "a\n")
+		fileitems = append(fileitems, FileItem{path, path})
+	}
+
+	// unstable replacement logs a warning while processing each file
+	r, changesets := newTestReplacer(t, Options{
+		Search:      []string{"a"},
+		Replace:     []string{"aa"},
+		Repeat:      1,
+		ThreadCount: 20,
+		Parallel:    "none",
+	})
+
+	logger := &concurrencyWriter{}
+	r.Logger = logger
+
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(fileitems) {
+		t.Errorf("expected %d processed files, got %d", len(fileitems), len(results))
+	}
+
+	if logger.max != 1 {
+		t.Errorf("expected files to be processed one after another, got %d at the same time", logger.max)
+	}
+}
+
+func TestApplyChangesetsToFileIfLineMatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "foo: enabled\nfoo: disabled\nfoo\n"
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{"replace", "bar: enabled\nfoo: disabled\nfoo\n"},
+		{"line", "bar\nfoo: disabled\nfoo\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", content)
+
+		r, changesets := newTestReplacer(t, Options{
+			Mode:          test.mode,
+			Search:        []string{"foo"},
+			Replace:       []string{"bar"},
+			IfLineMatches: `\benabled\b`,
+		})
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if content := readTestFile(t, path); content != test.expected {
+			t.Errorf("--mode=%s: expected %q, got %q", test.mode, test.expected, content)
+		}
+	}
+}
+
+func TestProcessFilesRequireContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	marked := writeTestFile(t, dir, "marked.go", "// Copyright ACME\nfoo()\n")
+	unmarked := writeTestFile(t, dir, "unmarked.go", "foo()\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:         []string{"foo"},
+		Replace:        []string{"bar"},
+		RequireContent: `(?m)^// Copyright`,
+	})
+
+	fileitems := []FileItem{{marked, marked}, {unmarked, unmarked}}
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.Error != nil {
+			t.Errorf("%s: %s", result.File.Path, result.Error)
+		}
+		if result.Changed != (result.File.Path == marked) {
+			t.Errorf("%s: expected changed %v, got %v", result.File.Path, result.File.Path == marked, result.Changed)
+		}
+	}
+
+	if content := readTestFile(t, marked); content != "// Copyright ACME\nbar()\n" {
+		t.Errorf("expected file with marker to be changed, got %q", content)
+	}
+	if content := readTestFile(t, unmarked); content != "foo()\n" {
+		t.Errorf("expected file without marker to be untouched, got %q", content)
+	}
+}
+
+func TestApplyChangesetsToFileDeleteMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "keep DEBUG this\nDEBUG\n  DEBUG DEBUG\nend\n"
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{
+			"literal",
+			Options{Search: []string{"DEBUG"}, Replace: []string{""}},
+			"keep  this\n\n   \nend\n",
+		},
+		{
+			"backrefs",
+			Options{Search: []string{"DEBUG ?"}, Replace: []string{""}, Regex: true, RegexBackref: true},
+			"keep this\n\n  \nend\n",
+		},
+		{
+			"drop empty lines",
+			Options{Search: []string{"DEBUG"}, Replace: []string{""}, DropEmptyLines: true},
+			"keep  this\nend\n",
+		},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", content)
+
+		r, changesets := newTestReplacer(t, test.opts)
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if content := readTestFile(t, path); content != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, content)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileIdenticalReplacement(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	for _, forceWrite := range []bool{false, true} {
+		path := writeTestFile(t, dir, "test.txt", "foobar\n")
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+
+		r, changesets := newTestReplacer(t, Options{
+			Search:       []string{"foo(bar)"},
+			Replace:      []string{"foo$1"},
+			Regex:        true,
+			RegexBackref: true,
+			ForceWrite:   forceWrite,
+		})
+
+		_, changed, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if written := !stat.ModTime().Equal(past); written != forceWrite || changed != forceWrite {
+			t.Errorf("--force-write=%v: expected file written %v, got written %v (changed %v)", forceWrite, forceWrite, written, changed)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileOnlyLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var content, expected string
+	for i := 1; i <= 16; i++ {
+		content += "foo\n"
+		if i == 3 || i == 7 || (i >= 12 && i <= 15) {
+			expected += "bar\n"
+		} else {
+			expected += "foo\n"
+		}
+	}
+	path := writeTestFile(t, dir, "test.txt", content)
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:    []string{"foo"},
+		Replace:   []string{"bar"},
+		OnlyLines: "3, 7,12-15",
+	})
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+func TestNewReplacerInvalidOnlyLines(t *testing.T) {
+	for _, onlyLines := range []string{"0", "5-3", "1,,2", "a-b", "1-"} {
+		if _, err := NewReplacer(Options{OnlyLines: onlyLines}); err == nil {
+			t.Errorf("--only-lines=%s: expected error", onlyLines)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileIndentRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "name: foo\nserver:\n  name: foo\n  tls:\n    name: foo\n\tname: foo\n"
+	maxIndent := 0
+	nestedMaxIndent := 3
+
+	tests := []struct {
+		opts     Options
+		expected string
+	}{
+		// nested block only
+		{Options{MinIndent: 2}, "name: foo\nserver:\n  name: bar\n  tls:\n    name: bar\n\tname: foo\n"},
+		{Options{MinIndent: 2, MaxIndent: &nestedMaxIndent}, "name: foo\nserver:\n  name: bar\n  tls:\n    name: foo\n\tname: foo\n"},
+		// tab is expanded to the next tab stop
+		{Options{MinIndent: 4, TabWidth: 4}, "name: foo\nserver:\n  name: foo\n  tls:\n    name: bar\n\tname: bar\n"},
+		// top-level lines only
+		{Options{MaxIndent: &maxIndent}, "name: bar\nserver:\n  name: foo\n  tls:\n    name: foo\n\tname: foo\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.yaml", content)
+
+		opts := test.opts
+		opts.Search = []string{"foo"}
+		opts.Replace = []string{"bar"}
+		r, changesets := newTestReplacer(t, opts)
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if result := readTestFile(t, path); result != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.opts, test.expected, result)
+		}
+	}
+
+	maxIndent = 1
+	if _, err := NewReplacer(Options{MinIndent: 2, MaxIndent: &maxIndent}); err == nil {
+		t.Error("expected error for --max-indent less than --min-indent")
+	}
+}
+
+func TestApplyChangesetsToFileEnsureHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	headerFile := writeTestFile(t, dir, "header.txt", "// Copyright\n// License: MIT\n")
+
+	tests := []struct {
+		content  string
+		expected string
+		changed  bool
+	}{
+		{"package main\n", "// Copyright\n// License: MIT\npackage main\n", true},
+		{"// Copyright\n// License: MIT\npackage main\n", "// Copyright\n// License: MIT\npackage main\n", false},
+		{"// Copyright\npackage main\n", "// Copyright\n// License: MIT\n// Copyright\npackage main\n", true},
+		{"package main\r\n", "// Copyright\r\n// License: MIT\r\npackage main\r\n", true},
+		{"", "// Copyright\n// License: MIT\n", true},
+	}
+
+	for _, header := range []string{headerFile, "// Copyright\n// License: MIT"} {
+		r, changesets := newTestReplacer(t, Options{EnsureHeader: header})
+
+		for _, test := range tests {
+			path := writeTestFile(t, dir, "test.go", test.content)
+
+			_, changed, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if changed != test.changed {
+				t.Errorf("%q: expected changed=%v, got %v", test.content, test.changed, changed)
+			}
+			if content := readTestFile(t, path); content != test.expected {
+				t.Errorf("%q: expected %q, got %q", test.content, test.expected, content)
+			}
+		}
+	}
+}
+
+func TestApplyChangesetsToFileNewlineAtEOF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		opts     Options
+		content  string
+		expected string
+	}{
+		{Options{NoNewlineAtEOF: true}, "foo\nbar\n", "bar\nbar"},
+		{Options{NoNewlineAtEOF: true}, "foo\nbar\n\n\n", "bar\nbar"},
+		{Options{NoNewlineAtEOF: true}, "foo\nbar", "bar\nbar"},
+		{Options{NoNewlineAtEOF: true}, "foo\r\nbar\r\n", "bar\r\nbar"},
+		{Options{EnsureNewlineAtEOF: true}, "foo\nbar", "bar\nbar\n"},
+		{Options{EnsureNewlineAtEOF: true}, "foo\nbar\n", "bar\nbar\n"},
+		{Options{EnsureNewlineAtEOF: true}, "foo\nbar\n\n\n", "bar\nbar\n"},
+		{Options{EnsureNewlineAtEOF: true}, "foo\r\nbar\r\n\r\n", "bar\r\nbar\r\n"},
+		{Options{EnsureNewlineAtEOF: true}, "foo\r\nbar", "bar\r\nbar\r\n"}, // line ending of the file
+		{Options{}, "foo\nbar\n\n", "bar\nbar\n\n"},
+		{Options{}, "foo\nbar", "bar\nbar"}, // last line without line ending is kept
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", test.content)
+
+		opts := test.opts
+		opts.Search = []string{"foo"}
+		opts.Replace = []string{"bar"}
+		r, changesets := newTestReplacer(t, opts)
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if content := readTestFile(t, path); content != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.content, test.expected, content)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileStripTrailingWhitespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		search   []string
+		replace  []string
+		content  string
+		expected string
+		changed  bool
+	}{
+		{[]string{"foo"}, []string{"bar"}, "foo  \nkeep\t \r\n  indented\n", "bar\nkeep\r\n  indented\n", true},
+		{nil, nil, "a \nb\t\nc", "a\nb\nc", true},
+		{nil, nil, "clean\nlines\n", "clean\nlines\n", false},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", test.content)
+
+		r, changesets := newTestReplacer(t, Options{Search: test.search, Replace: test.replace, StripTrailingWS: true})
+
+		_, changed, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != test.changed {
+			t.Errorf("%q: expected changed=%v, got %v", test.content, test.changed, changed)
+		}
+
+		if content := readTestFile(t, path); content != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.content, test.expected, content)
+		}
+	}
+}
+
+func TestNewReplacerNewlineAtEOFExclusive(t *testing.T) {
+	if _, err := NewReplacer(Options{NoNewlineAtEOF: true, EnsureNewlineAtEOF: true}); err == nil {
+		t.Error("expected error for --no-newline-at-eof together with --ensure-newline-at-eof")
+	}
+}
+
+func TestApplyChangesetsToFileRemoveEmptyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		content string
+		dryRun  bool
+		removed bool
+	}{
+		{"foo\nfoo\n", false, true},
+		{"\xef\xbb\xbffoo\n", false, true},
+		{"foo\nbar\n", false, false},
+		{"foo\nfoo\n", true, false},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", test.content)
+
+		r, changesets := newTestReplacer(t, Options{
+			Search:           []string{"foo"},
+			Replace:          []string{""},
+			DropEmptyLines:   true,
+			RemoveEmptyFiles: true,
+			DryRun:           test.dryRun,
+		})
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := os.Stat(path)
+		if removed := os.IsNotExist(err); removed != test.removed {
+			t.Errorf("%q (dry run: %v): expected removed=%v, got %v", test.content, test.dryRun, test.removed, removed)
+		}
+	}
+}
+
+func TestProcessFilesCycleReplace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := writeTestFile(t, dir, "first.txt", "name name name\nname name\n")
+	second := writeTestFile(t, dir, "second.txt", "name\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:       []string{"name"},
+		CycleReplace: "A,B,C",
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{first, first}, {second, second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+	}
+
+	if content := readTestFile(t, first); content != "A B C\nA B\n" {
+		t.Errorf("expected %q, got %q", "A B C\nA B\n", content)
+	}
+	// counted for each file
+	if content := readTestFile(t, second); content != "A\n" {
+		t.Errorf("expected %q, got %q", "A\n", content)
+	}
+}
+
+func TestApplyChangesetsToFilePreserveIndent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "server:\n  port: 80\n  host: localhost\ndef main():\n\tport = 80\n"
+	indent, noIndent := "    ", ""
+
+	tests := []struct {
+		opts     Options
+		expected string
+	}{
+		{Options{Mode: "line", PreserveIndent: true}, "server:\n  port: 8080\n  host: localhost\ndef main():\n\tport: 8080\n"},
+		{Options{Mode: "line"}, "server:\nport: 8080\n  host: localhost\ndef main():\nport: 8080\n"},
+		{Options{Mode: "lineinfile", PreserveIndent: true}, "server:\n  port: 8080\n  host: localhost\ndef main():\n\tport: 8080\n"},
+		{Options{Mode: "line", PreserveIndent: true, Trim: true}, "server:\n  port: 8080\n  host: localhost\ndef main():\n\tport: 8080\n"},
+		// --trim keeps the indentation of replaced lines unless --trim-indent is used
+		{Options{Mode: "line", Trim: true}, "server:\n  port: 8080\n  host: localhost\ndef main():\n\tport: 8080\n"},
+		{Options{Mode: "line", Trim: true, TrimIndent: &indent}, "server:\n    port: 8080\n  host: localhost\ndef main():\n    port: 8080\n"},
+		{Options{Mode: "line", Trim: true, TrimIndent: &noIndent}, "server:\nport: 8080\n  host: localhost\ndef main():\nport: 8080\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.yaml", content)
+
+		opts := test.opts
+		opts.Search = []string{"port"}
+		opts.Replace = []string{"port: 8080"}
+		r, changesets := newTestReplacer(t, opts)
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if result := readTestFile(t, path); result != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.opts, test.expected, result)
+		}
+	}
+
+	if _, err := NewReplacer(Options{PreserveIndent: true}); err == nil {
+		t.Error("expected error for --preserve-indent in replace mode")
+	}
+}
+
+func TestApplyChangesetsToFileInvertMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "a\nfoo 1\nb\nfoo 2\n"
+
+	tests := []struct {
+		replace  string
+		expected string
+	}{
+		// non-matching lines are replaced
+		{"x", "x\nfoo 1\nx\nfoo 2\n"},
+		// empty replace term keeps only matching lines
+		{"", "foo 1\nfoo 2\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", content)
+
+		r, changesets := newTestReplacer(t, Options{Mode: "line", InvertMatch: true, Search: []string{"foo"}, Replace: []string{test.replace}})
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if result := readTestFile(t, path); result != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.replace, test.expected, result)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileLineinfileInsert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	indent := "  "
+
+	tests := []struct {
+		opts     Options
+		content  string
+		expected string
+	}{
+		// original line endings are kept
+		{Options{LineinfileAfter: "^anchor"}, "a\r\nanchor\nb\r\n", "a\r\nanchor\nport: 8080\r\nb\r\n"},
+		{Options{LineinfileBefore: "^anchor"}, "a\r\nanchor\nb\r\n", "a\r\nport: 8080\r\nanchor\nb\r\n"},
+		{Options{LineinfileAfter: "^anchor"}, "a\nanchor", "a\nanchor\nport: 8080\n"},
+		{Options{LineinfileAfter: "^missing"}, "a\r\nb", "a\r\nb\r\nport: 8080\r\n"},
+		// --trim-indent
+		{Options{Trim: true, TrimIndent: &indent}, "server:\n", "server:\n  port: 8080\n"},
+		{Options{Trim: true, TrimIndent: &indent, LineinfileAfter: "^server:"}, "server:\nother:\n", "server:\n  port: 8080\nother:\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.yaml", test.content)
+
+		opts := test.opts
+		opts.Mode = "lineinfile"
+		opts.Search = []string{"port"}
+		opts.Replace = []string{"port: 8080"}
+		r, changesets := newTestReplacer(t, opts)
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if result := readTestFile(t, path); result != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.opts, test.expected, result)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileReplaceAtStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		opts     Options
+		expected string
+	}{
+		{Options{}, "Bar = bar + bar\n  bar\n"},
+		{Options{Trim: true}, "Bar = bar + bar\n  Bar\n"},
+		{Options{Regex: true, RegexBackref: true, Search: []string{"f(oo)"}, Replace: []string{"b$1"}, ReplaceAtStart: "B$1"}, "Boo = boo + boo\n  boo\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", "foo = foo + foo\n  foo\n")
+
+		opts := test.opts
+		if opts.Search == nil {
+			opts.Search = []string{"foo"}
+			opts.Replace = []string{"bar"}
+			opts.ReplaceAtStart = "Bar"
+		}
+		r, changesets := newTestReplacer(t, opts)
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if content := readTestFile(t, path); content != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.opts, test.expected, content)
+		}
+	}
+}
+
+func TestProcessFilesTotalLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fileitems []FileItem
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		path := writeTestFile(t, dir, name, "foo\nfoo\n")
+		fileitems = append(fileitems, FileItem{path, path})
+	}
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:      []string{"foo"},
+		Replace:     []string{"bar"},
+		TotalLimit:  5,
+		ThreadCount: 4,
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, fileitems)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, result := range results {
+		total += result.Replacements
+	}
+	if total != 5 {
+		t.Errorf("expected 5 replacements, got %d", total)
+	}
+
+	// files are processed in order, the third file reaches the limit
+	expected := []string{"bar\nbar\n", "bar\nbar\n", "bar\nfoo\n", "foo\nfoo\n"}
+	for i, fileitem := range fileitems {
+		if content := readTestFile(t, fileitem.Path); content != expected[i] {
+			t.Errorf("%s: expected %q, got %q", fileitem.Path, expected[i], content)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileFollowedBy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		opts     Options
+		content  string
+		expected string
+	}{
+		{Options{Search: []string{"foo"}, Replace: []string{"bar"}, FollowedBy: `\(`}, "foo( foo foo(x)\n", "bar( foo bar(x)\n"},
+		{Options{Search: []string{"price"}, Replace: []string{"$cost"}, FollowedBy: ` *=`}, "price = 1\nprice\n", "$cost = 1\nprice\n"},
+		{Options{Search: []string{"(v)([0-9]+)"}, Replace: []string{"$2$1"}, FollowedBy: `\.[0-9]+`, Regex: true, RegexBackref: true}, "v1.2 v3\n", "1v.2 v3\n"},
+		{Options{Search: []string{"FOO"}, Replace: []string{"x"}, FollowedBy: `[0-9]`, CaseInsensitive: true}, "foo1 Foo fOo2\n", "x1 Foo x2\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", test.content)
+		r, changesets := newTestReplacer(t, test.opts)
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := readTestFile(t, path); actual != test.expected {
+			t.Errorf("%q followed by %q in %q: expected %q, got %q", test.opts.Search[0], test.opts.FollowedBy, test.content, test.expected, actual)
+		}
+	}
+}
+
+func TestNewReplacerFollowedByInvalid(t *testing.T) {
+	for _, opts := range []Options{
+		{Search: []string{"foo"}, Replace: []string{"bar"}, FollowedBy: "("},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, FollowedBy: "x", Mode: "line"},
+		{Search: []string{"foo"}, Replace: []string{"bar"}, FollowedBy: "x", Concat: true},
+	} {
+		if _, err := NewReplacer(opts); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestInterpretEscapes(t *testing.T) {
+	tests := map[string]string{
+		`a\nb`:     "a\nb",
+		`a\tb\r\n`: "a\tb\r\n",
+		`a\\nb`:    `a\nb`,
+		`\d \\`:    `\d \`,
+		`plain`:    "plain",
+	}
+
+	for value, expected := range tests {
+		if actual := interpretEscapes(value); actual != expected {
+			t.Errorf("%q: expected %q, got %q", value, expected, actual)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileInterpretEscapes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		opts     Options
+		content  string
+		expected string
+	}{
+		{Options{Mode: "lineinfile", Search: []string{"^\\[main\\]"}, Replace: []string{`[main]\nkey=1`}, Regex: true}, "a\n", "a\n[main]\nkey=1\n"},
+		{Options{Mode: "replace", Search: []string{","}, Replace: []string{`\t`}}, "a,b\n", "a\tb\n"},
+		{Options{Mode: "replace", Search: []string{"x"}, Replace: []string{`C:\\dir`}}, "x\n", "C:\\dir\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", test.content)
+
+		opts := test.opts
+		opts.InterpretEscapes = true
+		r, changesets := newTestReplacer(t, opts)
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := readTestFile(t, path); actual != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.opts.Replace[0], test.expected, actual)
+		}
+	}
+
+	// without --interpret-escapes the replace term is used literally
+	path := writeTestFile(t, dir, "test.txt", "a,b\n")
+	r, changesets := newTestReplacer(t, Options{Search: []string{","}, Replace: []string{`\n`}})
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+	if actual := readTestFile(t, path); actual != "a\\nb\n" {
+		t.Errorf("expected %q, got %q", "a\\nb\n", actual)
+	}
+}
+
+func TestEscapeLiteralDollars(t *testing.T) {
+	search := regexp.MustCompile(`(?P<name>[a-z]+)=([0-9]+)`)
+
+	tests := map[string]string{
+		"$1 costs $5":     "$1 costs $$5",
+		"${2}$ and $$":    "${2}$$ and $$",
+		"$name $names":    "$name $$names",
+		"${name}s ${x} $": "${name}s $${x} $$",
+		"US$":             "US$$",
+	}
+
+	for replace, expected := range tests {
+		if actual := escapeLiteralDollars(search, replace); actual != expected {
+			t.Errorf("%q: expected %q, got %q", replace, expected, actual)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileReplaceEscape(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "price=5\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:        []string{"(price)=([0-9]+)"},
+		Replace:       []string{"$1=$$2 (was $2, $USD)"},
+		Regex:         true,
+		RegexBackref:  true,
+		ReplaceEscape: true,
+	})
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "price=$2 (was 5, $USD)\n"; readTestFile(t, path) != expected {
+		t.Errorf("expected %q, got %q", expected, readTestFile(t, path))
+	}
+}
+
+func TestUnmatchedSearches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := writeTestFile(t, dir, "a.txt", "foo\n")
+	b := writeTestFile(t, dir, "b.txt", "bar\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foo", "bar", "missing"},
+		Replace: []string{"1", "2", "3"},
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{a, a}, {b, b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unmatched := UnmatchedSearches(changesets, results); len(unmatched) != 1 || unmatched[0] != "missing" {
+		t.Errorf("expected [missing], got %v", unmatched)
+	}
+
+	// --check reports matches instead of changing files
+	r, changesets = newTestReplacer(t, Options{Search: []string{"1", "3"}, Check: true})
+	results, err = r.ProcessFiles(context.Background(), changesets, []FileItem{{a, a}, {b, b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unmatched := UnmatchedSearches(changesets, results); len(unmatched) != 1 || unmatched[0] != "3" {
+		t.Errorf("expected [3], got %v", unmatched)
+	}
+
+	// --rename=only matches file names
+	c := writeTestFile(t, dir, "foo.txt", "other\n")
+	r, changesets = newTestReplacer(t, Options{Search: []string{"foo", "missing"}, Replace: []string{"renamed", "x"}, Rename: "only"})
+	results, err = r.ProcessFiles(context.Background(), changesets, []FileItem{{c, c}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unmatched := UnmatchedSearches(changesets, results); len(unmatched) != 1 || unmatched[0] != "missing" {
+		t.Errorf("expected [missing], got %v", unmatched)
+	}
+}
+
+func TestApplyChangesetsToReaderLikeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		opts    Options
+		content string
+	}{
+		{Options{}, "a\nfoo\nb"},
+		{Options{DedupeAdjacent: true}, "bar\nfoo\nfoo\nb\n"},
+		{Options{EnsureHeader: "# header"}, "a\r\nfoo\r\n"},
+		{Options{EnsureHeader: "# header"}, "# header\nfoo\n"},
+		{Options{EnsureHeader: "# header"}, "\xef\xbb\xbffoo"},
+		{Options{NoNewlineAtEOF: true}, "foo\n\nbar\n\n\n"},
+		{Options{NoNewlineAtEOF: true}, "foo\r\nbar"},
+		{Options{EnsureNewlineAtEOF: true}, "foo\nbar\n\n\n"},
+		{Options{EnsureNewlineAtEOF: true}, "foo\r\nbar\r\n\r\n"},
+		{Options{EnsureNewlineAtEOF: true}, "foo\r\nbar"},
+		{Options{EnsureNewlineAtEOF: true}, "bar"},
+		{Options{EnsureNewlineAtEOF: true}, "\n\n"},
+		{Options{EnsureNewlineAtEOF: true}, ""},
+		{Options{StripTrailingWS: true}, "foo \t\nkeep\t \r\n  indented"},
+		{Options{StripTrailingWS: true, NoNewlineAtEOF: true}, "foo\n  \n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", test.content)
+
+		opts := test.opts
+		opts.Search = []string{"foo"}
+		opts.Replace = []string{"bar"}
+		r, changesets := newTestReplacer(t, opts)
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		var out strings.Builder
+		if err := r.ApplyChangesetsToReader(strings.NewReader(test.content), &out, "stdin", changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := readTestFile(t, path); out.String() != expected {
+			t.Errorf("%+v %q: expected %q like the file, got %q", test.opts, test.content, expected, out.String())
+		}
+	}
+}
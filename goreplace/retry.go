@@ -0,0 +1,51 @@
+package goreplace
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Delay before the first retry of a write (--retry), doubled for each further retry
+var retryDelay = 100 * time.Millisecond
+
+// Write file to the file system, transient errors are retried --retry times
+func (r *Replacer) writeFileWithRetry(filename string, content []byte, perm os.FileMode) error {
+	delay := retryDelay
+
+	for retry := 0; ; retry++ {
+		err := r.FileSystem.WriteFile(filename, content, perm)
+		if err == nil || retry >= r.opts.Retry || !isTransientError(err) {
+			return err
+		}
+
+		r.logMessage(err.Error() + ", retrying in " + delay.String())
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Checks if err is caused by a file which is locked by another process
+func isTransientError(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return false
+	}
+
+	for _, transient := range transientErrnos {
+		if errno == transient {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package goreplace
+
+import (
+	"syscall"
+)
+
+// Errors while another process holds the file
+var transientErrnos = []syscall.Errno{syscall.EAGAIN, syscall.EBUSY, syscall.ETXTBSY}
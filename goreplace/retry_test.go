@@ -0,0 +1,71 @@
+package goreplace
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestApplyChangesetsToFileRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = time.Millisecond
+
+	locked := &os.PathError{Op: "rename", Path: "test.txt", Err: transientErrnos[0]}
+
+	tests := []struct {
+		retry    int
+		failures []error
+		success  bool
+		calls    int
+	}{
+		{3, []error{locked, locked}, true, 3},
+		{1, []error{locked, locked}, false, 2},
+		{0, []error{locked}, false, 1},
+		{3, []error{&os.PathError{Op: "open", Path: "test.txt", Err: syscall.ENOENT}}, false, 1},
+		{3, []error{errors.New("disk full")}, false, 1},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", "foo\n")
+
+		r, changesets := newTestReplacer(t, Options{
+			Search:  []string{"foo"},
+			Replace: []string{"bar"},
+			Retry:   test.retry,
+		})
+
+		calls := 0
+		r.FileSystem = writeHookFS{osFS{}, func(filename string, content []byte, perm os.FileMode) error {
+			calls++
+			if calls <= len(test.failures) {
+				return test.failures[calls-1]
+			}
+			return writeFileAtomic(filename, content, perm)
+		}}
+
+		_, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets)
+		if success := err == nil; success != test.success {
+			t.Errorf("--retry=%d with %v: expected success=%v, got %v", test.retry, test.failures, test.success, err)
+		}
+		if calls != test.calls {
+			t.Errorf("--retry=%d with %v: expected %d writes, got %d", test.retry, test.failures, test.calls, calls)
+		}
+
+		expected := "foo\n"
+		if test.success {
+			expected = "bar\n"
+		}
+		if content := readTestFile(t, path); content != expected {
+			t.Errorf("--retry=%d with %v: expected %q, got %q", test.retry, test.failures, expected, content)
+		}
+	}
+}
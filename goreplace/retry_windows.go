@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package goreplace
+
+import (
+	"syscall"
+)
+
+// Errors while another process (eg. a virus scanner) holds the file
+var transientErrnos = []syscall.Errno{
+	5,  // ERROR_ACCESS_DENIED, renaming over a file which is open
+	32, // ERROR_SHARING_VIOLATION
+	33, // ERROR_LOCK_VIOLATION
+}
@@ -0,0 +1,91 @@
+package goreplace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Search and replace rule of --rules-json, unset settings use the global options
+type replaceRule struct {
+	Search     string `json:"search"`
+	Replace    string `json:"replace"`
+	Mode       string `json:"mode"`
+	Regex      *bool  `json:"regex"`
+	IgnoreCase *bool  `json:"ignoreCase"`
+	Once       bool   `json:"once"`
+}
+
+// Modes available for rules
+var ruleModes = []string{"replace", "line", "lineinfile", "prepend", "append"}
+
+// Read rules from JSON document (array of rules)
+func readRulesFile(path string) ([]replaceRule, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []replaceRule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("Invalid rules file %s: %s", path, err)
+	}
+
+	for i, rule := range rules {
+		if rule.Search == "" {
+			return nil, fmt.Errorf("Invalid rule %d in %s: search term is missing", i+1, path)
+		}
+
+		if rule.Mode != "" && !contains(ruleModes, rule.Mode) {
+			return nil, fmt.Errorf("Invalid rule %d in %s: unknown mode \"%s\"", i+1, path, rule.Mode)
+		}
+	}
+
+	return rules, nil
+}
+
+// Checks changesets for search terms used more than once (--dedupe-changesets)
+// Duplicates with the same replace term and mode are removed, search terms with
+// different replace terms or modes are conflicting. Both are reported as warning,
+// with --strict-rules as error.
+func (r *Replacer) dedupeChangesets(changesets []Changeset) ([]Changeset, error) {
+	var ret []Changeset
+	first := map[string]Changeset{}
+
+	for _, changeset := range changesets {
+		// compiled regex includes --regex, --ignore-case and --glob of the term
+		key := changeset.Search.String()
+
+		previous, found := first[key]
+		if !found {
+			first[key] = changeset
+			ret = append(ret, changeset)
+			continue
+		}
+
+		var message string
+		duplicate := false
+		if previous.Replace != changeset.Replace {
+			message = fmt.Sprintf("Search term \"%s\" is used with conflicting replace terms \"%s\" and \"%s\"", changeset.SearchPlain, previous.Replace, changeset.Replace)
+		} else if r.changesetMode(previous) != r.changesetMode(changeset) || previous.once != changeset.once {
+			message = fmt.Sprintf("Search term \"%s\" is used with conflicting settings (mode, once)", changeset.SearchPlain)
+		} else {
+			message = fmt.Sprintf("Search term \"%s\" is used more than once with replace term \"%s\", duplicate is ignored", changeset.SearchPlain, changeset.Replace)
+			duplicate = true
+		}
+
+		// conflicting changesets are all applied
+		if !duplicate {
+			ret = append(ret, changeset)
+		}
+
+		// --strict-rules
+		if r.opts.StrictRules {
+			return nil, errors.New(message)
+		}
+		r.logWarning(message)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,139 @@
+package goreplace
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestApplyChangesetsToFileRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rules := writeTestFile(t, dir, "rules.json", `[
+		{"search": "^version=.*", "replace": "version=2.0", "mode": "line", "regex": true},
+		{"search": "FOO", "replace": "bar", "ignoreCase": true, "once": true},
+		{"search": "debug=", "replace": "debug=false", "mode": "lineinfile"}
+	]`)
+	path := writeTestFile(t, dir, "test.txt", "version=1.0 beta\nfoo foo\nFoo\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:    []string{"beta"},
+		Replace:   []string{"stable"},
+		RulesJSON: rules,
+	})
+	if len(changesets) != 4 {
+		t.Fatalf("expected 4 changesets, got %d", len(changesets))
+	}
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "version=2.0\nbar foo\nFoo\ndebug=false\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+func TestBuildChangesetsInvalidRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, content := range []string{
+		`{"search": "foo"}`,
+		`[{"replace": "bar"}]`,
+		`[{"search": "foo", "mode": "template"}]`,
+		`[{"search": "(", "regex": true}]`,
+	} {
+		rules := writeTestFile(t, dir, "rules.json", content)
+
+		r, err := NewReplacer(Options{RulesJSON: rules})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := r.BuildChangesets(); err == nil {
+			t.Errorf("%s: expected error", content)
+		}
+	}
+}
+
+func TestBuildChangesetsDedupe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rules := writeTestFile(t, dir, "rules.json", `[
+		{"search": "foo", "replace": "bar"},
+		{"search": "foo", "replace": "baz"},
+		{"search": "x", "replace": "y", "mode": "line"}
+	]`)
+
+	var logger bytes.Buffer
+	r, err := NewReplacer(Options{
+		Search:           []string{"foo", "x"},
+		Replace:          []string{"bar", "y"},
+		RulesJSON:        rules,
+		DedupeChangesets: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Logger = &logger
+
+	changesets, err := r.BuildChangesets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// duplicate foo=bar is removed, conflicting rules are kept
+	if len(changesets) != 4 {
+		t.Errorf("expected 4 changesets, got %d", len(changesets))
+	}
+
+	for _, expected := range []string{
+		`Warning: Search term "foo" is used more than once with replace term "bar", duplicate is ignored`,
+		`Warning: Search term "foo" is used with conflicting replace terms "bar" and "baz"`,
+		`Warning: Search term "x" is used with conflicting settings (mode, once)`,
+	} {
+		if !strings.Contains(logger.String(), expected+"\n") {
+			t.Errorf("expected warning %q, got %q", expected, logger.String())
+		}
+	}
+
+	// --strict-rules
+	r, err = NewReplacer(Options{
+		RulesJSON:        rules,
+		DedupeChangesets: true,
+		StrictRules:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.BuildChangesets(); err == nil || err.Error() != `Search term "foo" is used with conflicting replace terms "bar" and "baz"` {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+}
+
+func TestBuildChangesetsWithoutDedupe(t *testing.T) {
+	_, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foo", "foo"},
+		Replace: []string{"bar", "bar"},
+	})
+
+	if len(changesets) != 2 {
+		t.Errorf("expected duplicates to be kept without --dedupe-changesets, got %d changesets", len(changesets))
+	}
+}
@@ -0,0 +1,69 @@
+package goreplace
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+)
+
+// SampleFiles previews the first count changed lines of the files (--sample),
+// files are processed one after another in the given order and reading stops
+// as soon as enough lines were found, files are never written
+func (r *Replacer) SampleFiles(ctx context.Context, changesets []Changeset, fileitems []FileItem, count int) ([]ChangeResult, error) {
+	var ret []ChangeResult
+
+	for _, fileitem := range fileitems {
+		if count <= 0 || ctx.Err() != nil {
+			break
+		}
+
+		result := r.sampleFile(fileitem, changesets, count)
+		if result.Changed {
+			count -= result.Replacements
+		}
+
+		ret = append(ret, result)
+	}
+
+	return ret, ctx.Err()
+}
+
+// Preview of at most count changed lines of a file,
+// Replacements is the number of previewed lines
+func (r *Replacer) sampleFile(fileitem FileItem, changesets []Changeset, count int) ChangeResult {
+	file, err := r.FileSystem.Open(fileitem.Path)
+	if err != nil {
+		return ChangeResult{File: fileitem, Error: err}
+	}
+	defer file.Close()
+
+	// track matches per file
+	changesets = resetChangesets(changesets)
+
+	reader := bufio.NewReader(file)
+	readByteOrderMark(reader)
+
+	var lines []previewLine
+	processor := r.newLineProcessor(reader, fileitem.Path, changesets)
+	for len(lines) < count {
+		line, err := processor.next()
+		if err != nil {
+			break
+		}
+
+		if line.changed || line.skip {
+			lines = append(lines, previewLine{processor.lineNumber, line.original, line.text, line.skip})
+		}
+	}
+
+	// --replace-cmd
+	if err := r.commandFailure(fileitem.Path); err != nil {
+		return ChangeResult{File: fileitem, Error: err}
+	}
+
+	if len(lines) == 0 {
+		return ChangeResult{File: fileitem, Output: fmt.Sprintf("%s no match", fileitem.Path), Matched: changesetsMatched(changesets)}
+	}
+
+	return ChangeResult{File: fileitem, Output: formatPreview(fileitem, lines), Changed: true, Matched: true, Replacements: len(lines)}
+}
@@ -0,0 +1,59 @@
+package goreplace
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSampleFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fileitems []FileItem
+	for i := 0; i < 3; i++ {
+		path := writeTestFile(t, dir, fmt.Sprintf("file%d.txt", i), "foo 1\nbar\nfoo 2\nfoo 3\n")
+		fileitems = append(fileitems, FileItem{path, path})
+	}
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foo"},
+		Replace: []string{"baz"},
+		DryRun:  true,
+		Sample:  5,
+	})
+
+	results, err := r.SampleFiles(context.Background(), changesets, fileitems, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected sampling to stop after 2 files, got %d results", len(results))
+	}
+
+	previews := 0
+	for _, result := range results {
+		previews += strings.Count(result.Output, " | ")
+	}
+	if previews != 5 {
+		t.Errorf("expected 5 previewed lines, got %d", previews)
+	}
+
+	expected := fileitems[1].Path + ":\n1: foo 1 | baz 1\n3: foo 2 | baz 2\n"
+	if results[1].Output != expected {
+		t.Errorf("expected %q, got %q", expected, results[1].Output)
+	}
+
+	for _, fileitem := range fileitems {
+		if content := readTestFile(t, fileitem.Path); content != "foo 1\nbar\nfoo 2\nfoo 3\n" {
+			t.Errorf("%s: expected file to be untouched, got %q", fileitem.Path, content)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package goreplace
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// SARIF document of --output-format=sarif, only the properties used by code scanning
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version,omitempty"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+// Rule of a search term, the search term is its id
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Region of a match, end column is exclusive
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// URI of a file for SARIF, relative paths stay relative to the working directory
+func sarifURI(path string) string {
+	if filepath.IsAbs(path) {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	}
+
+	return (&url.URL{Path: filepath.ToSlash(path)}).String()
+}
+
+func newSARIFLog(version string, results []ChangeResult) sarifLog {
+	run := sarifRun{
+		Tool:       sarifTool{Driver: sarifDriver{Name: "go-replace", Version: version, Rules: []sarifRule{}}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+
+	// index of the rule of each search term
+	rules := map[string]int{}
+
+	for _, result := range results {
+		for _, match := range result.Matches {
+			index, found := rules[match.Search]
+			if !found {
+				index = len(run.Tool.Driver.Rules)
+				rules[match.Search] = index
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{match.Search, sarifMessage{"Search term " + match.Search}})
+			}
+
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    match.Search,
+				RuleIndex: index,
+				Level:     "warning",
+				Message:   sarifMessage{"Found " + match.Text},
+				Locations: []sarifLocation{{sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{sarifURI(match.Path)},
+					Region:           sarifRegion{match.Line, match.Column, match.Column + utf8.RuneCountInString(match.Text)},
+				}}},
+			})
+		}
+	}
+
+	return sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}}
+}
+
+// WriteSARIF writes the matches of the results (--check, --locations) as
+// SARIF document to w (--output-format=sarif), version is the tool version
+func WriteSARIF(w io.Writer, version string, results []ChangeResult) error {
+	content, err := json.MarshalIndent(newSARIFLog(version, results), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(content, '\n'))
+	return err
+}
@@ -0,0 +1,93 @@
+package goreplace
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "test.txt", "first line\nthe foobar and ä foobaz\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search: []string{"fooba[rz]", "first"},
+		Regex:  true,
+		Check:  true,
+	})
+
+	result := r.processFile(FileItem{path, path}, changesets)
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteSARIF(&buffer, "1.0.0", []ChangeResult{result}); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buffer.Bytes(), &log); err != nil {
+		t.Fatalf("expected valid JSON, got %s", err)
+	}
+
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("expected SARIF 2.1.0 document with one run, got %+v", log)
+	}
+
+	run := log.Runs[0]
+	if run.Tool.Driver.Name != "go-replace" || run.Tool.Driver.Version != "1.0.0" {
+		t.Errorf("unexpected tool %+v", run.Tool.Driver)
+	}
+
+	// rules are ordered by first match
+	if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != "first" || run.Tool.Driver.Rules[1].ID != "fooba[rz]" {
+		t.Errorf("expected rules first and fooba[rz], got %+v", run.Tool.Driver.Rules)
+	}
+
+	uri := "file://" + filepath.ToSlash(path)
+	expected := []struct {
+		ruleID    string
+		ruleIndex int
+		region    sarifRegion
+	}{
+		{"first", 0, sarifRegion{1, 1, 6}},
+		{"fooba[rz]", 1, sarifRegion{2, 5, 11}},
+		{"fooba[rz]", 1, sarifRegion{2, 18, 24}},
+	}
+
+	if len(run.Results) != len(expected) {
+		t.Fatalf("expected %d results, got %+v", len(expected), run.Results)
+	}
+	for i, result := range run.Results {
+		if result.RuleID != expected[i].ruleID || result.RuleIndex != expected[i].ruleIndex {
+			t.Errorf("result %d: expected rule %s (%d), got %s (%d)", i, expected[i].ruleID, expected[i].ruleIndex, result.RuleID, result.RuleIndex)
+		}
+		if len(result.Locations) != 1 {
+			t.Errorf("result %d: expected one location, got %+v", i, result.Locations)
+			continue
+		}
+
+		location := result.Locations[0].PhysicalLocation
+		if location.ArtifactLocation.URI != uri {
+			t.Errorf("result %d: expected uri %s, got %s", i, uri, location.ArtifactLocation.URI)
+		}
+		if location.Region != expected[i].region {
+			t.Errorf("result %d: expected region %+v, got %+v", i, expected[i].region, location.Region)
+		}
+	}
+}
+
+func TestSARIFURI(t *testing.T) {
+	if uri := sarifURI("dir/my file.txt"); uri != "dir/my%20file.txt" {
+		t.Errorf("expected relative uri, got %s", uri)
+	}
+}
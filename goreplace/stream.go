@@ -0,0 +1,145 @@
+package goreplace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Files of at least this size are streamed line by line to a temporary file
+// instead of buffering the whole content (see streamChangesetsToFile)
+var streamMinSize int64 = 8 << 20
+
+// Checks if file can be streamed, options which need the whole content
+// (lineinfile, header, end of file, dry run) or write somewhere else use the buffer
+func (r *Replacer) canStreamFile(changesets []Changeset, timeout *fileTimeout) bool {
+	if timeout != nil || r.opts.DryRun || r.opts.Preview || r.opts.Retry > 0 || r.opts.RemoveEmptyFiles || r.opts.ValidateCmd != "" {
+		return false
+	}
+
+	if r.opts.header != "" || r.opts.NoNewlineAtEOF || r.opts.EnsureNewlineAtEOF {
+		return false
+	}
+
+	if r.opts.Output != "" || r.opts.OutputStripFileExt != "" || r.opts.OutputDir != "" || r.opts.OutputTemplate != "" {
+		return false
+	}
+
+	return !r.hasLineInFileChangesets(changesets)
+}
+
+// Applies changesets to file line by line and writes each line to a temporary
+// file as soon as it is produced, the temporary file replaces the file at the end.
+// The temporary file is only created when the first line changed, the unchanged
+// lines before are copied from the file. File is closed afterwards.
+func (r *Replacer) streamChangesetsToFile(fileitem FileItem, file *os.File, changesets []Changeset) ChangeResult {
+	defer file.Close()
+
+	// track matches per file
+	changesets = resetChangesets(changesets)
+
+	var (
+		out       *atomicFile
+		writer    *bufio.Writer
+		offset    int64 // bytes of the file read so far
+		identical = true
+	)
+
+	reader := bufio.NewReader(file)
+
+	// --preserve-bom
+	// byte order mark is not part of the first line
+	bom := readByteOrderMark(reader)
+	offset = int64(len(bom))
+
+	// start of the unchanged content copied to the temporary file
+	copyStart := int64(0)
+	if bom != "" && r.opts.PreserveBOM == "no" {
+		copyStart = offset
+		identical = false
+	}
+
+	// create temporary file and copy the unchanged content read so far
+	startWriting := func() error {
+		// --root
+		if err := r.checkRoot(fileitem.Output); err != nil {
+			return err
+		}
+
+		var err error
+		if out, err = createAtomicFile(fileitem.Output); err != nil {
+			return err
+		}
+
+		writer = bufio.NewWriter(out)
+		_, err = io.Copy(writer, io.NewSectionReader(file, copyStart, offset-copyStart))
+		return err
+	}
+
+	fail := func(err error) ChangeResult {
+		if out != nil {
+			out.discard()
+		}
+		return ChangeResult{File: fileitem, Error: err}
+	}
+
+	if !identical {
+		if err := startWriting(); err != nil {
+			return fail(err)
+		}
+	}
+
+	lines := r.newLineProcessor(reader, fileitem.Path, changesets)
+	for {
+		line, err := lines.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(err)
+		}
+
+		if line.skip || line.text != line.original || line.ending != line.originalEnding {
+			identical = false
+		}
+
+		if out == nil && (line.changed || line.skip || line.ending != line.originalEnding) {
+			if err := startWriting(); err != nil {
+				return fail(err)
+			}
+		}
+
+		if out != nil && !line.skip {
+			writer.WriteString(line.text + line.ending)
+		}
+
+		offset += int64(len(line.original) + len(line.originalEnding))
+	}
+
+	// --replace-cmd, file isn't written if the command failed
+	if err := r.commandFailure(fileitem.Path); err != nil {
+		return fail(err)
+	}
+
+	result := newChangeResult(fileitem, changesets)
+
+	if out == nil {
+		result.Output = r.unchangedOutput(result)
+		return result
+	}
+
+	// --force-write, --max-replacements-per-file, --total-limit
+	if !r.writeChanges(&result, identical) {
+		out.discard()
+		return result
+	}
+
+	if result.Error = out.commit(writer.Flush(), 0644); result.Error != nil {
+		return result
+	}
+
+	result.Output = fmt.Sprintf("%s found and replaced match\n", fileitem.Path)
+	result.Changed = true
+
+	return result
+}
@@ -0,0 +1,165 @@
+package goreplace
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamChangesetsToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(size int64) { streamMinSize = size }(streamMinSize)
+
+	tests := []struct {
+		opts    Options
+		content string
+	}{
+		{Options{}, "a\nfoo\nb\n"},
+		{Options{}, "a\nb\n"},
+		{Options{}, "a\nfoo"},
+		{Options{}, "a\r\nfoo\r\nb\r\n"},
+		{Options{}, "\xef\xbb\xbfa\nfoo\n"},
+		{Options{PreserveBOM: "no"}, "\xef\xbb\xbfa\nb\n"},
+		{Options{LineEnding: "crlf"}, "a\nb\n"},
+		{Options{LineEnding: "lf"}, "a\r\nb"},
+		{Options{DedupeAdjacent: true}, "bar\nfoo\nb\n"},
+		{Options{DropEmptyLines: true}, "a\nfoo\nb\n"},
+		{Options{MaxReplacements: 1}, "foo\nfoo\n"},
+		{Options{Mode: "line"}, "a\n  foo x\n"},
+		{Options{StripTrailingWS: true}, "a \nb\t\r\nc"},
+		{Options{StripTrailingWS: true, DedupeAdjacent: true}, "bar \nfoo\n"},
+	}
+
+	for _, test := range tests {
+		var expected []string
+
+		for _, size := range []int64{1 << 30, 0} {
+			streamMinSize = size
+			path := writeTestFile(t, dir, "test.txt", test.content)
+
+			opts := test.opts
+			opts.Search = []string{"foo"}
+			opts.Replace = []string{"bar"}
+			if opts.DropEmptyLines {
+				opts.Replace = []string{""}
+			}
+			r, changesets := newTestReplacer(t, opts)
+
+			output, changed, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := []string{output, fmt.Sprint(changed), readTestFile(t, path)}
+			if expected == nil {
+				// buffered result
+				expected = actual
+			} else if strings.Join(actual, "|") != strings.Join(expected, "|") {
+				t.Errorf("%+v %q: expected %q, got %q", test.opts, test.content, expected, actual)
+			}
+		}
+
+		// no temporary files are left
+		if files, _ := filepath.Glob(filepath.Join(dir, ".test.txt.*")); len(files) > 0 {
+			t.Errorf("%+v %q: temporary files left: %v", test.opts, test.content, files)
+		}
+	}
+}
+
+func TestStreamChangesetsToFileLargeFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("large file")
+	}
+
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 32 MiB file, four times streamMinSize
+	path := filepath.Join(dir, "large.txt")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := bufio.NewWriter(file)
+	lines := 0
+	for size := 0; size < 32<<20; lines++ {
+		n, _ := fmt.Fprintf(writer, "line %08d foobar %s\n", lines, strings.Repeat("x", 40))
+		size += n
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:  []string{"foobar"},
+		Replace: []string{"barfoo"},
+	})
+
+	// sample heap while processing, the buffered content alone would need 64 MiB
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	baseline := stats.HeapAlloc
+
+	done := make(chan bool)
+	peak := make(chan uint64)
+	go func() {
+		var max uint64
+		for {
+			select {
+			case <-done:
+				peak <- max
+				return
+			case <-time.After(time.Millisecond):
+				runtime.ReadMemStats(&stats)
+				if stats.HeapAlloc > max {
+					max = stats.HeapAlloc
+				}
+			}
+		}
+	}()
+
+	_, changed, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets)
+	done <- true
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("expected file to be changed")
+	}
+
+	if growth := int64(<-peak) - int64(baseline); growth > 16<<20 {
+		t.Errorf("expected heap to grow less than 16 MiB, got %d MiB", growth>>20)
+	}
+
+	file, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for ; scanner.Scan(); count++ {
+		if expected := fmt.Sprintf("line %08d barfoo %s", count, strings.Repeat("x", 40)); scanner.Text() != expected {
+			t.Fatalf("line %d: expected %q, got %q", count+1, expected, scanner.Text())
+		}
+	}
+	if count != lines {
+		t.Errorf("expected %d lines, got %d", lines, count)
+	}
+}
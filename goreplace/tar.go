@@ -0,0 +1,70 @@
+package goreplace
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Checks if file is a tar archive which is searched by --scan-tar
+func (r *Replacer) isScannedTar(path string) bool {
+	return r.opts.ScanTar && strings.HasSuffix(strings.ToLower(path), ".tar")
+}
+
+// Searches the files inside of a tar archive (--scan-tar), the archive is only read
+// Files are reported like with --check, --locations or --files-with-matches,
+// their path is the path of the archive and the path inside (archive.tar/dir/file)
+func (r *Replacer) scanTarFile(fileitem FileItem, changesets []Changeset) ChangeResult {
+	file, err := r.FileSystem.Open(fileitem.Path)
+	if err != nil {
+		return ChangeResult{File: fileitem, Error: err}
+	}
+	defer file.Close()
+
+	var (
+		report  []string
+		matches []Match
+	)
+
+	archive := tar.NewReader(file)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ChangeResult{File: fileitem, Error: fmt.Errorf("Invalid tar archive %s: %s", fileitem.Path, err)}
+		}
+
+		// directories, links, ...
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		name := fileitem.Path + "/" + strings.TrimPrefix(header.Name, "./")
+		reader := bufio.NewReader(archive)
+
+		if r.opts.FilesWithMatches {
+			// --files-with-matches
+			matched, err := r.readerMatches(reader, changesets)
+			if err != nil {
+				return ChangeResult{File: fileitem, Error: fmt.Errorf("%s: %s", name, err)}
+			} else if matched {
+				report = append(report, name)
+			}
+			continue
+		}
+
+		// --check, --locations
+		output, fileMatches, err := r.checkReader(name, reader, changesets)
+		if err != nil {
+			return ChangeResult{File: fileitem, Error: fmt.Errorf("%s: %s", name, err)}
+		} else if len(fileMatches) > 0 {
+			report = append(report, output)
+			matches = append(matches, fileMatches...)
+		}
+	}
+
+	return ChangeResult{File: fileitem, Output: strings.Join(report, "\n"), Matched: len(report) > 0, Matches: matches}
+}
@@ -0,0 +1,96 @@
+package goreplace
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write tar archive with the files (name and content) to path
+func writeTestTar(t *testing.T, path string, files [][2]string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	archive := tar.NewWriter(file)
+	if err := archive.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range files {
+		header := &tar.Header{Name: entry[0], Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(entry[1]))}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write([]byte(entry[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanTarFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.tar")
+	writeTestTar(t, path, [][2]string{
+		{"dir/a.txt", "a\nfoo bar\n"},
+		{"./b.txt", "nothing\n"},
+		{"c.txt", "foo\n"},
+	})
+	original := readTestFile(t, path)
+
+	tests := []struct {
+		opts     Options
+		expected string
+	}{
+		{Options{Check: true}, path + "/dir/a.txt:2: foo\n" + path + "/c.txt:1: foo"},
+		{Options{Locations: true}, path + "/dir/a.txt:2:1:2: foo\n" + path + "/c.txt:1:1:0: foo"},
+		{Options{FilesWithMatches: true}, path + "/dir/a.txt\n" + path + "/c.txt"},
+	}
+
+	for _, test := range tests {
+		opts := test.opts
+		opts.Search = []string{"foo"}
+		opts.ScanTar = true
+		r, changesets := newTestReplacer(t, opts)
+
+		result := r.processFile(FileItem{path, path}, changesets)
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+
+		if !result.Matched || result.Output != test.expected {
+			t.Errorf("%+v: expected %q, got %q (matched: %v)", test.opts, test.expected, result.Output, result.Matched)
+		}
+	}
+
+	// archive is never changed
+	if readTestFile(t, path) != original {
+		t.Error("expected archive to be unchanged")
+	}
+}
+
+func TestScanTarFileInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "broken.tar", "not a tar archive\n")
+
+	r, changesets := newTestReplacer(t, Options{Search: []string{"foo"}, Check: true, ScanTar: true})
+	if result := r.processFile(FileItem{path, path}, changesets); result.Error == nil {
+		t.Errorf("expected error for invalid archive, got %+v", result)
+	}
+}
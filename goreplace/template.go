@@ -0,0 +1,94 @@
+package goreplace
+
+import (
+	"bytes"
+	"fmt"
+	sprig "github.com/Masterminds/sprig"
+	"os"
+	"strings"
+	"text/template"
+)
+
+type templateData struct {
+	Arg map[string]string
+	Env map[string]string
+}
+
+// Data of replace term templates (--go-template)
+type replaceTemplateData struct {
+	Match  string
+	Groups []string
+	File   string
+	Line   int
+}
+
+func createTemplate() *template.Template {
+	tmpl := template.New("base")
+	tmpl.Funcs(sprig.TxtFuncMap())
+	tmpl.Option("missingkey=zero")
+
+	return tmpl
+}
+
+// ParseContentAsTemplate parses content as golang template and executes it with changesets and environment as data
+func (r *Replacer) ParseContentAsTemplate(templateContent string, changesets []Changeset) (bytes.Buffer, error) {
+	var content bytes.Buffer
+	data := generateTemplateData(changesets)
+	tmpl, err := createTemplate().Parse(templateContent)
+	if err != nil {
+		return content, err
+	}
+
+	err = tmpl.Execute(&content, &data)
+	if err != nil {
+		return content, err
+	}
+
+	return content, nil
+}
+
+func generateTemplateData(changesets []Changeset) templateData {
+	// init
+	var ret templateData
+	ret.Arg = make(map[string]string)
+	ret.Env = make(map[string]string)
+
+	// add changesets
+	for _, changeset := range changesets {
+		ret.Arg[changeset.SearchPlain] = changeset.Replace
+	}
+
+	// add env variables
+	for _, e := range os.Environ() {
+		split := strings.SplitN(e, "=", 2)
+		envKey, envValue := split[0], split[1]
+		ret.Env[envKey] = envValue
+	}
+
+	return ret
+}
+
+// Render replace term template of changeset for match (submatch indexes in content) and append it to dst
+// On errors the match is kept unchanged
+func (r *Replacer) renderReplaceTemplate(dst []byte, changeset Changeset, content string, match []int, position linePosition) []byte {
+	data := replaceTemplateData{File: position.File, Line: position.Line}
+
+	for i := 0; i+1 < len(match); i += 2 {
+		group := ""
+		if match[i] >= 0 {
+			group = content[match[i]:match[i+1]]
+		}
+		data.Groups = append(data.Groups, group)
+	}
+	if len(data.Groups) > 0 {
+		data.Match = data.Groups[0]
+	}
+
+	var buffer bytes.Buffer
+	if err := changeset.replaceTemplate.Execute(&buffer, &data); err != nil {
+		r.logWarning(fmt.Sprintf("%s:%d: %s", position.File, position.Line, err))
+		return append(dst, data.Match...)
+	}
+
+	return append(dst, buffer.Bytes()...)
+}
@@ -0,0 +1,68 @@
+package goreplace
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// returned by processing of files which reached --regex-timeout
+var errTimeout = errors.New("timeout reached")
+
+// States of a file processed with --regex-timeout
+const (
+	timeoutRunning int32 = iota
+	timeoutWriting
+	timeoutExpired
+)
+
+// Decides between writing a file and skipping it after --regex-timeout,
+// a nil timeout never expires
+type fileTimeout struct {
+	state int32
+}
+
+// Marks file as being written, false if the timeout already expired
+func (t *fileTimeout) startWrite() bool {
+	return t == nil || atomic.CompareAndSwapInt32(&t.state, timeoutRunning, timeoutWriting)
+}
+
+// Marks timeout as expired, false if the file is already being written
+func (t *fileTimeout) expire() bool {
+	return t != nil && atomic.CompareAndSwapInt32(&t.state, timeoutRunning, timeoutExpired)
+}
+
+// Checks if the timeout expired
+func (t *fileTimeout) expired() bool {
+	return t != nil && atomic.LoadInt32(&t.state) == timeoutExpired
+}
+
+// Applies changesets to file, the file is skipped with a warning
+// if processing takes longer than --regex-timeout. Processing can't be
+// interrupted, it continues in the background until the current line
+// is done and the file isn't written then.
+func (r *Replacer) applyChangesetsToFileWithTimeout(fileitem FileItem, changesets []Changeset) ChangeResult {
+	timeout := &fileTimeout{}
+	done := make(chan ChangeResult, 1)
+
+	go func() {
+		done <- r.applyChangesetsToFile(fileitem, changesets, timeout)
+	}()
+
+	timer := time.NewTimer(r.opts.regexTimeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-done:
+		return result
+	case <-timer.C:
+		if timeout.expire() {
+			r.logWarning(fmt.Sprintf("%s: processing took longer than --regex-timeout=%s, file skipped", fileitem.Path, r.opts.RegexTimeout))
+			return ChangeResult{File: fileitem, Output: fmt.Sprintf("%s skipped, timeout reached", fileitem.Path)}
+		}
+
+		// file is already being written
+		return <-done
+	}
+}
@@ -0,0 +1,77 @@
+package goreplace
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProcessFilesRegexTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the replace command blocks until the test is done,
+	// so processing the line always takes longer than the timeout
+	started := make(chan bool, 1)
+	release := make(chan bool)
+	defer func(run func([]string, string) ([]byte, error)) { runReplaceCmd = run }(runReplaceCmd)
+	defer close(release)
+	runReplaceCmd = func(args []string, input string) ([]byte, error) {
+		started <- true
+		<-release
+		return []byte("fast"), nil
+	}
+
+	content := "slow\n"
+	slowFile := writeTestFile(t, dir, "slow.txt", content)
+	fastFile := writeTestFile(t, dir, "fast.txt", "fast\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:       []string{"slow"},
+		ReplaceCmd:   "cat",
+		RegexTimeout: "1ms",
+	})
+
+	var logger bytes.Buffer
+	r.Logger = &logger
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{slowFile, slowFile}, {fastFile, fastFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the line is still in progress
+	<-started
+
+	for _, result := range results {
+		if result.Error != nil {
+			t.Errorf("%s: expected no error, got %s", result.File.Path, result.Error)
+		}
+
+		if result.File.Path == slowFile && result.Changed {
+			t.Errorf("expected %s to be skipped", slowFile)
+		}
+	}
+
+	if !strings.Contains(logger.String(), slowFile+": processing took longer than --regex-timeout=1ms") {
+		t.Errorf("expected timeout warning, got %q", logger.String())
+	}
+
+	if readTestFile(t, slowFile) != content {
+		t.Errorf("expected %s not to be changed", slowFile)
+	}
+}
+
+func TestNewReplacerInvalidRegexTimeout(t *testing.T) {
+	for _, timeout := range []string{"5", "-1s", "0s"} {
+		if _, err := NewReplacer(Options{RegexTimeout: timeout}); err == nil {
+			t.Errorf("expected error for --regex-timeout=%s", timeout)
+		}
+	}
+}
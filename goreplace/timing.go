@@ -0,0 +1,58 @@
+package goreplace
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// WriteTimingReport writes the duration of searching files (walk),
+// of processing all files and the slowest files to w (--timing)
+func WriteTimingReport(w io.Writer, walk time.Duration, processing time.Duration, results []ChangeResult, slowest int) {
+	fmt.Fprintln(w, "Timing:")
+	fmt.Fprintf(w, "  walk:       %s\n", walk.Round(time.Microsecond))
+	fmt.Fprintf(w, "  processing: %s (%d file(s))\n", processing.Round(time.Microsecond), len(results))
+
+	sorted := append([]ChangeResult{}, results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Duration > sorted[j].Duration
+	})
+	if len(sorted) > slowest {
+		sorted = sorted[:slowest]
+	}
+
+	if len(sorted) > 0 {
+		fmt.Fprintf(w, "  slowest files:\n")
+		for _, result := range sorted {
+			fmt.Fprintf(w, "    %12s  %s\n", result.Duration.Round(time.Microsecond), result.File.Path)
+		}
+	}
+}
+
+// WriteBenchmarkReport writes the throughput of processing files to w (--benchmark),
+// size is the total size of the processed files in bytes (see Replacer.FileitemsSize)
+func WriteBenchmarkReport(w io.Writer, processing time.Duration, files int, size int64) {
+	seconds := processing.Seconds()
+	if seconds <= 0 {
+		seconds = time.Nanosecond.Seconds()
+	}
+	megabytes := float64(size) / 1000 / 1000
+
+	fmt.Fprintln(w, "Benchmark:")
+	fmt.Fprintf(w, "  processed:  %d file(s), %.2f MB in %s\n", files, megabytes, processing.Round(time.Microsecond))
+	fmt.Fprintf(w, "  throughput: %.2f files/sec, %.2f MB/sec\n", float64(files)/seconds, megabytes/seconds)
+}
+
+// FileitemsSize returns the total size of the files in bytes,
+// files which can't be read are ignored
+func (r *Replacer) FileitemsSize(fileitems []FileItem) int64 {
+	var size int64
+	for _, fileitem := range fileitems {
+		if info, err := r.FileSystem.Stat(fileitem.Path); err == nil {
+			size += info.Size()
+		}
+	}
+
+	return size
+}
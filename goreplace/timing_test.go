@@ -0,0 +1,67 @@
+package goreplace
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTimingReport(t *testing.T) {
+	results := []ChangeResult{
+		{File: FileItem{Path: "fast.txt"}, Duration: time.Millisecond},
+		{File: FileItem{Path: "slow.txt"}, Duration: 30 * time.Millisecond},
+		{File: FileItem{Path: "medium.txt"}, Duration: 20 * time.Millisecond},
+	}
+
+	var report bytes.Buffer
+	WriteTimingReport(&report, 5*time.Millisecond, 40*time.Millisecond, results, 2)
+
+	expected := strings.Join([]string{
+		"Timing:",
+		"  walk:       5ms",
+		"  processing: 40ms (3 file(s))",
+		"  slowest files:",
+		"            30ms  slow.txt",
+		"            20ms  medium.txt",
+		"",
+	}, "\n")
+	if report.String() != expected {
+		t.Errorf("expected %q, got %q", expected, report.String())
+	}
+}
+
+func TestWriteBenchmarkReport(t *testing.T) {
+	var report bytes.Buffer
+	WriteBenchmarkReport(&report, 2*time.Second, 10, 5000000)
+
+	expected := strings.Join([]string{
+		"Benchmark:",
+		"  processed:  10 file(s), 5.00 MB in 2s",
+		"  throughput: 5.00 files/sec, 2.50 MB/sec",
+		"",
+	}, "\n")
+	if report.String() != expected {
+		t.Errorf("expected %q, got %q", expected, report.String())
+	}
+}
+
+func TestFileitemsSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := writeTestFile(t, dir, "a.txt", "foobar\n")
+	b := writeTestFile(t, dir, "b.txt", "foo\n")
+	missing := filepath.Join(dir, "missing.txt")
+
+	r, _ := newTestReplacer(t, Options{Search: []string{"foo"}, Replace: []string{"bar"}})
+	if size := r.FileitemsSize([]FileItem{{a, a}, {b, b}, {missing, missing}}); size != 11 {
+		t.Errorf("expected 11 bytes, got %d", size)
+	}
+}
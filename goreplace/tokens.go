@@ -0,0 +1,46 @@
+package goreplace
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Characters of a token if --token-chars is used without a value
+const defaultTokenChars = "[A-Za-z0-9_]"
+
+// Compile --token-chars, a character class like [A-Za-z0-9_.-]
+func parseTokenChars(class string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(class, "[") || !strings.HasSuffix(class, "]") {
+		return nil, errors.New("must be a character class like " + defaultTokenChars)
+	}
+
+	return regexp.Compile("^" + class + "$")
+}
+
+// Keep only matches which are complete tokens (--token-chars),
+// the characters before and after a match must not be token characters
+func (r *Replacer) tokenMatches(content string, matches [][]int) [][]int {
+	if r.opts.tokenChars == nil {
+		return matches
+	}
+
+	var ret [][]int
+	for _, match := range matches {
+		before, _ := utf8.DecodeLastRuneInString(content[:match[0]])
+		after, _ := utf8.DecodeRuneInString(content[match[1]:])
+
+		if !r.isTokenChar(before) && !r.isTokenChar(after) {
+			ret = append(ret, match)
+		}
+	}
+
+	return ret
+}
+
+// Checks if c is part of a token (--token-chars),
+// start and end of the content are no token characters
+func (r *Replacer) isTokenChar(c rune) bool {
+	return c != utf8.RuneError && r.opts.tokenChars.MatchString(string(c))
+}
@@ -0,0 +1,75 @@
+package goreplace
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestApplyChangesetsToFileTokenChars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "foo foo-bar foo.baz foo_x (foo) foofoo\n"
+	tests := []struct {
+		tokenChars string
+		expected   string
+	}{
+		{"[A-Za-z0-9_]", "X X-bar X.baz foo_x (X) foofoo\n"},
+		{"[A-Za-z0-9_.-]", "X foo-bar foo.baz foo_x (X) foofoo\n"},
+		{"[A-Za-z]", "X X-bar X.baz X_x (X) foofoo\n"},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, dir, "test.txt", content)
+
+		r, changesets := newTestReplacer(t, Options{
+			Search:     []string{"foo"},
+			Replace:    []string{"X"},
+			TokenChars: test.tokenChars,
+		})
+
+		if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+			t.Fatal(err)
+		}
+
+		if result := readTestFile(t, path); result != test.expected {
+			t.Errorf("--token-chars=%s: expected %q, got %q", test.tokenChars, test.expected, result)
+		}
+	}
+}
+
+func TestApplyChangesetsToFileTokenCharsUnit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// foo-bar is a token of its own, foo-bar-baz is a longer token
+	path := writeTestFile(t, dir, "test.txt", "foo-bar foo-bar-baz x.foo-bar\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:     []string{"foo-bar"},
+		Replace:    []string{"qux"},
+		TokenChars: "[A-Za-z0-9_.-]",
+	})
+
+	if _, _, err := r.ApplyChangesetsToFile(FileItem{path, path}, changesets); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "qux foo-bar-baz x.foo-bar\n"
+	if result := readTestFile(t, path); result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+
+	for _, tokenChars := range []string{"abc", "[a-z"} {
+		if _, err := NewReplacer(Options{TokenChars: tokenChars}); err == nil {
+			t.Errorf("--token-chars=%s: expected error", tokenChars)
+		}
+	}
+}
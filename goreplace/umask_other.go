@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package goreplace
+
+import (
+	"os"
+)
+
+// There is no umask on this platform
+func applyUmask(perm os.FileMode) os.FileMode {
+	return perm
+}
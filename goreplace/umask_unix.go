@@ -0,0 +1,24 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package goreplace
+
+import (
+	"os"
+	"syscall"
+)
+
+// Umask of the process, it can only be read by setting it so it's
+// read once before any files are written
+var processUmask = readUmask()
+
+func readUmask() os.FileMode {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return os.FileMode(mask)
+}
+
+// Mode of a new file created with perm, the umask is applied like open(2) does
+func applyUmask(perm os.FileMode) os.FileMode {
+	return perm &^ processUmask
+}
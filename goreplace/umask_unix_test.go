@@ -0,0 +1,44 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package goreplace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomicUmask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(umask os.FileMode) { processUmask = umask }(processUmask)
+	processUmask = 0027
+
+	existing := writeTestFile(t, dir, "existing.txt", "foobar\n")
+	if err := os.Chmod(existing, 0606); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]os.FileMode{
+		filepath.Join(dir, "new.txt"): 0640,
+		existing:                      0606,
+	} {
+		if err := writeFileAtomic(path, []byte("barfoo\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := stat.Mode().Perm(); mode != expected {
+			t.Errorf("%s: expected mode %04o, got %04o", path, expected, mode)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package goreplace
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Runs the --validate-cmd command line and returns its output, replaced in tests
+var runValidateCmd = func(args []string) ([]byte, error) {
+	return exec.Command(args[0], args[1:]...).CombinedOutput()
+}
+
+// Content of a file before it is written (--validate-cmd)
+type fileBackup struct {
+	fs       FileSystem
+	filename string
+	content  []byte
+	exists   bool
+}
+
+// Read content of filename to restore it later, missing files are removed on restore
+func (r *Replacer) backupFile(filename string) (*fileBackup, error) {
+	content, err := r.readFile(filename)
+	if os.IsNotExist(err) {
+		return &fileBackup{fs: r.FileSystem, filename: filename}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &fileBackup{fs: r.FileSystem, filename: filename, content: content, exists: true}, nil
+}
+
+// Restore the original content, mode and owner of existing files are kept by the file system
+func (b *fileBackup) restore() error {
+	if !b.exists {
+		return b.fs.Remove(b.filename)
+	}
+
+	return b.fs.WriteFile(b.filename, b.content, 0644)
+}
+
+// Command line of --validate-cmd for filename, {} is replaced
+// with filename, otherwise filename is added as last argument
+// The command is split into arguments like a shell does (see splitCommandLine),
+// but it is not run by a shell.
+func (r *Replacer) validateCommand(filename string) []string {
+	args := append([]string{}, r.opts.validateCmd...)
+
+	placeholder := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{}") {
+			args[i] = strings.Replace(arg, "{}", filename, -1)
+			placeholder = true
+		}
+	}
+
+	if !placeholder {
+		args = append(args, filename)
+	}
+
+	return args
+}
+
+// Run --validate-cmd for the written file, the backup is restored if it fails
+func (r *Replacer) validateFile(filename string, backup *fileBackup) error {
+	output, err := runValidateCmd(r.validateCommand(filename))
+	if err == nil {
+		return nil
+	}
+
+	if restoreErr := backup.restore(); restoreErr != nil {
+		return fmt.Errorf("%s: --validate-cmd failed (%s), restoring original content failed: %s", filename, err, restoreErr)
+	}
+
+	message := strings.TrimSpace(string(output))
+	if message == "" {
+		message = err.Error()
+	}
+
+	return fmt.Errorf("%s: --validate-cmd failed, original content restored: %s", filename, message)
+}
@@ -0,0 +1,115 @@
+package goreplace
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProcessFilesValidateCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(run func([]string) ([]byte, error)) { runValidateCmd = run }(runValidateCmd)
+
+	valid := writeTestFile(t, dir, "valid.conf", "foobar\n")
+	invalid := writeTestFile(t, dir, "invalid.conf", "foobar\n")
+
+	var validated []string
+	runValidateCmd = func(args []string) ([]byte, error) {
+		validated = append(validated, filepath.Base(args[len(args)-1]))
+		if strings.HasSuffix(args[len(args)-1], "invalid.conf") {
+			return []byte("syntax error in line 1\n"), errors.New("exit status 1")
+		}
+		return nil, nil
+	}
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:      []string{"foobar"},
+		Replace:     []string{"barfoo"},
+		ValidateCmd: "check-config",
+		ThreadCount: 1,
+	})
+
+	results, err := r.ProcessFiles(context.Background(), changesets, []FileItem{{valid, valid}, {invalid, invalid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.File.Path == invalid {
+			if result.Error == nil || !strings.Contains(result.Error.Error(), "syntax error in line 1") {
+				t.Errorf("expected validation error, got %v", result.Error)
+			}
+		} else if result.Error != nil || !result.Changed {
+			t.Errorf("expected %s to be changed, got %v", result.File.Path, result.Error)
+		}
+	}
+
+	if content := readTestFile(t, valid); content != "barfoo\n" {
+		t.Errorf("expected valid file to be changed, got %q", content)
+	}
+	if content := readTestFile(t, invalid); content != "foobar\n" {
+		t.Errorf("expected invalid file to be restored, got %q", content)
+	}
+	if len(validated) != 2 {
+		t.Errorf("expected both files to be validated, got %v", validated)
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	tests := []struct {
+		cmd      string
+		expected []string
+	}{
+		{"gofmt -l", []string{"gofmt", "-l", "main.go"}},
+		{"nginx -t -c {}", []string{"nginx", "-t", "-c", "main.go"}},
+		{"check --file={}", []string{"check", "--file=main.go"}},
+		{`sh -c "exit 1"`, []string{"sh", "-c", "exit 1", "main.go"}},
+		{`sh -c 'test -s "$0"' {}`, []string{"sh", "-c", `test -s "$0"`, "main.go"}},
+	}
+
+	for _, test := range tests {
+		r, _ := newTestReplacer(t, Options{Search: []string{"foo"}, Replace: []string{"bar"}, ValidateCmd: test.cmd})
+
+		if args := r.validateCommand("main.go"); !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.cmd, test.expected, args)
+		}
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := map[string][]string{
+		"gofmt -l":                 {"gofmt", "-l"},
+		"  a \t b  ":               {"a", "b"},
+		`sh -c "exit 1"`:           {"sh", "-c", "exit 1"},
+		`echo 'a "b"' "c 'd'"`:     {"echo", `a "b"`, `c 'd'`},
+		`echo "a \"b\" \$x \n"`:    {"echo", `a "b" $x \n`},
+		`echo a\ b \'c`:            {"echo", "a b", "'c"},
+		`echo x'y'"z" '' --opt=''`: {"echo", "xyz", "", "--opt="},
+		"":                         nil,
+	}
+
+	for value, expected := range tests {
+		if args, err := splitCommandLine(value); err != nil || !reflect.DeepEqual(args, expected) {
+			t.Errorf("%s: expected %q, got %q (%v)", value, expected, args, err)
+		}
+	}
+
+	for _, value := range []string{`sh -c "exit 1`, `echo 'a`, `echo a\`} {
+		if args, err := splitCommandLine(value); err == nil {
+			t.Errorf("%s: expected error, got %q", value, args)
+		}
+	}
+
+	if _, err := NewReplacer(Options{Search: []string{"foo"}, Replace: []string{"bar"}, ValidateCmd: `sh -c "exit 1`}); err == nil {
+		t.Error("expected error for --validate-cmd with unterminated quote")
+	}
+}
@@ -0,0 +1,258 @@
+package goreplace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Delay after the last change of a file before it is processed again (--watch),
+// editors often write a file in multiple steps
+var watchDebounce = 200 * time.Millisecond
+
+// Interval of checking the files below --path for changes (--watch)
+// if file system events are not available
+var watchPollInterval = time.Second
+
+// Watch processes files below --path again whenever they change (--watch)
+// until the context is cancelled. Paths of changed files are received from
+// events, with nil file system events are used and the files are polled for
+// changes if they are not available. Files are selected by
+// the usual filters, results are passed to OnResult.
+func (r *Replacer) Watch(ctx context.Context, changesets []Changeset, events <-chan string) error {
+	// --explain-skips, skipped files were already reported by the first walk
+	r.opts.ExplainSkips = false
+
+	if events == nil && r.isOSFileSystem() {
+		var err error
+		if events, err = r.notifyChanges(ctx); err != nil {
+			r.logWarning(fmt.Sprintf("--watch: file system events not available, polling files instead: %s", err))
+		}
+	}
+
+	if events == nil {
+		events = r.pollChanges(ctx, watchPollInterval)
+	}
+
+	// modification time of files written by the watcher itself,
+	// writing a file must not trigger processing it again
+	written := map[string]time.Time{}
+
+	pending := map[string]bool{}
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case path, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			if info, err := r.FileSystem.Stat(path); err == nil && info.ModTime().Equal(written[path]) {
+				continue
+			}
+
+			pending[path] = true
+			debounce.Reset(watchDebounce)
+
+		case <-debounce.C:
+			fileitems, err := r.selectWatchedFiles(pending)
+			if err != nil {
+				return err
+			}
+			pending = map[string]bool{}
+
+			results, err := r.ProcessFiles(ctx, changesets, fileitems)
+			for _, result := range results {
+				if info, statErr := r.FileSystem.Stat(result.File.Path); statErr == nil && result.Changed {
+					written[result.File.Path] = info.ModTime()
+				}
+			}
+
+			if err != nil && err != ctx.Err() {
+				return err
+			}
+		}
+	}
+}
+
+// Files of paths which are selected by the filters of --path
+// (--path-pattern, --path-regex, ...), other paths are ignored
+func (r *Replacer) selectWatchedFiles(paths map[string]bool) ([]FileItem, error) {
+	filter := r.newPathFilter(r.opts.Path)
+
+	var ret []FileItem
+	for path := range paths {
+		if !r.selectedInPath(filter, path) {
+			continue
+		}
+
+		file, err := r.pathFileItem(path)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, file)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+
+	// --since-git
+	if r.opts.SinceGit && len(ret) > 0 {
+		return filterGitChangedFiles(ret)
+	}
+
+	return ret, nil
+}
+
+// Sends paths of files below --path which were created or written, reported
+// by file system events. Directories are watched recursively, also when they
+// are created later on.
+func (r *Replacer) notifyChanges(ctx context.Context) (<-chan string, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := r.newPathFilter(r.opts.Path)
+
+	// watches the directory and the searched directories below it,
+	// files found are passed to found
+	watchDir := func(dir string, found func(path string)) error {
+		return r.FileSystem.Walk(dir, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !f.IsDir() {
+				found(path)
+				return nil
+			}
+
+			if r.dirSkipReason(filter, path, f) != "" {
+				return filepath.SkipDir
+			}
+
+			return watcher.Add(path)
+		})
+	}
+
+	if err := watchDir(r.opts.Path, func(string) {}); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	events := make(chan string)
+
+	go func() {
+		defer close(events)
+		defer watcher.Close()
+
+		for {
+			var paths []string
+
+			select {
+			case <-ctx.Done():
+				return
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				r.logWarning(fmt.Sprintf("--watch: %s", err))
+				continue
+
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+					continue
+				}
+
+				if info, err := r.FileSystem.Lstat(event.Name); err == nil && info.IsDir() {
+					// files may be created before the new directory is watched
+					if err := watchDir(event.Name, func(path string) { paths = append(paths, path) }); err != nil {
+						r.logWarning(fmt.Sprintf("--watch: %s", err))
+					}
+				} else {
+					paths = append(paths, event.Name)
+				}
+			}
+
+			for _, path := range paths {
+				select {
+				case events <- path:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// Sends paths of files below --path which were added or modified,
+// files are compared by modification time and size each interval
+func (r *Replacer) pollChanges(ctx context.Context, interval time.Duration) <-chan string {
+	events := make(chan string)
+
+	type fileState struct {
+		modTime time.Time
+		size    int64
+	}
+
+	snapshot := func() map[string]fileState {
+		ret := map[string]fileState{}
+		r.SearchFilesInPath(ctx, r.opts.Path, func(f os.FileInfo, path string) {
+			ret[path] = fileState{f.ModTime(), f.Size()}
+		})
+		return ret
+	}
+
+	// changes are detected from now on
+	files := snapshot()
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current := snapshot()
+			for path, state := range current {
+				if previous, found := files[path]; found && previous == state {
+					continue
+				}
+
+				select {
+				case events <- path:
+				case <-ctx.Done():
+					return
+				}
+			}
+			files = current
+		}
+	}()
+
+	return events
+}
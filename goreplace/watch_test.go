@@ -0,0 +1,189 @@
+package goreplace
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(debounce time.Duration) { watchDebounce = debounce }(watchDebounce)
+	watchDebounce = 10 * time.Millisecond
+
+	path := writeTestFile(t, dir, "test.txt", "bar\n")
+	ignored := writeTestFile(t, dir, "test.md", "bar\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Search:      []string{"foo"},
+		Replace:     []string{"bar"},
+		Path:        dir,
+		PathPattern: "*.txt",
+	})
+
+	processed := make(chan ChangeResult, 10)
+	r.OnResult = func(result ChangeResult) {
+		processed <- result
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- r.Watch(ctx, changesets, events)
+	}()
+
+	// rapid events of the same file are processed once
+	writeTestFile(t, dir, "test.txt", "foo\n")
+	writeTestFile(t, dir, "test.md", "foo\n")
+	events <- path
+	events <- ignored
+	events <- path
+
+	select {
+	case result := <-processed:
+		if result.File.Path != path || !result.Changed {
+			t.Errorf("expected %s to be changed, got %+v", path, result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("modified file was not processed")
+	}
+
+	// the watcher's own write is no change
+	events <- path
+
+	select {
+	case result := <-processed:
+		t.Errorf("expected no further results, got %+v", result)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	if content := readTestFile(t, path); content != "bar\n" {
+		t.Errorf("expected %q, got %q", "bar\n", content)
+	}
+	if content := readTestFile(t, filepath.Join(dir, "test.md")); content != "foo\n" {
+		t.Errorf("expected file not matching --path-pattern to be unchanged, got %q", content)
+	}
+}
+
+func TestWatchPollChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "old.txt", "a\n")
+
+	r, _ := newTestReplacer(t, Options{Search: []string{"foo"}, Replace: []string{"bar"}, Path: dir})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := r.pollChanges(ctx, 10*time.Millisecond)
+
+	path := writeTestFile(t, dir, "new.txt", "foo\n")
+
+	select {
+	case changed := <-events:
+		if changed != path {
+			t.Errorf("expected %s, got %s", path, changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("new file was not reported")
+	}
+}
+
+func TestSelectWatchedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, sub := range []string{".hidden", ".git", "a/b"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := map[string]bool{dir: true, filepath.Join(dir, "missing.txt"): true, "/elsewhere/test.txt": true}
+	for _, name := range []string{"test.txt", "test.md", ".hidden/test.txt", ".git/test.txt", "a/test.txt", "a/b/test.txt"} {
+		paths[writeTestFile(t, dir, name, "foo\n")] = true
+	}
+
+	r, _ := newTestReplacer(t, Options{
+		Search:      []string{"foo"},
+		Replace:     []string{"bar"},
+		Path:        dir,
+		PathPattern: "*.txt",
+		SkipHidden:  true,
+		MaxDepth:    "1",
+	})
+
+	fileitems, err := r.selectWatchedFiles(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var selected []string
+	for _, fileitem := range fileitems {
+		selected = append(selected, fileitem.Path)
+	}
+
+	expected := []string{filepath.Join(dir, "a/test.txt"), filepath.Join(dir, "test.txt")}
+	if !reflect.DeepEqual(selected, expected) {
+		t.Errorf("expected %v, got %v", expected, selected)
+	}
+}
+
+func TestWatchNotifyChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, _ := newTestReplacer(t, Options{Search: []string{"foo"}, Replace: []string{"bar"}, Path: dir})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := r.notifyChanges(ctx)
+	if err != nil {
+		t.Skipf("file system events not available: %s", err)
+	}
+
+	expectEvent := func(path string) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case changed := <-events:
+				if changed == path {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("%s was not reported", path)
+			}
+		}
+	}
+
+	expectEvent(writeTestFile(t, dir, "new.txt", "foo\n"))
+
+	// directories created later are watched too
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(writeTestFile(t, dir, "sub/new.txt", "foo\n"))
+}
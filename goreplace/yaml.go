@@ -0,0 +1,318 @@
+package goreplace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Characters which can't start a plain YAML scalar
+const yamlIndicators = "-?:,[]{}#&*!|>'\"%@`"
+
+// Locates values in YAML block mappings and sequences line by line,
+// so comments and formatting of the document are kept (--mode=yaml)
+// Flow collections ({...}, [...]) and block scalars (|, >) are no scalar values.
+type yamlScanner struct {
+	lines []string // lines without line endings
+}
+
+// Position of a scalar value (line, start and end of the value in the line)
+type yamlValue struct {
+	Line  int
+	Start int
+	End   int
+}
+
+// Indentation of line, -1 for blank and comment lines
+func yamlIndent(line string) int {
+	content := strings.TrimLeft(line, " ")
+	if content == "" || strings.HasPrefix(content, "#") {
+		return -1
+	}
+
+	return len(line) - len(content)
+}
+
+// End of the block starting at line start (exclusive), the block contains
+// all following lines indented more than indent, items of a sequence
+// (- value) on the same indentation also belong to a mapping key
+func (s *yamlScanner) blockEnd(start int, indent int, sequence bool) int {
+	end := start
+	for end < len(s.lines) {
+		lineIndent := yamlIndent(s.lines[end])
+		if lineIndent >= 0 && lineIndent <= indent {
+			if !sequence || lineIndent < indent || !strings.HasPrefix(s.lines[end][lineIndent:], "-") {
+				break
+			}
+		}
+		end++
+	}
+
+	return end
+}
+
+// Find the scalar value at path in the lines of the block [start, end)
+func (s *yamlScanner) find(start int, end int, path []jsonPathElement) (yamlValue, bool, error) {
+	// indentation of the block is the indentation of its first line
+	indent := -1
+	for ; start < end && indent < 0; start++ {
+		if s.lines[start] != "---" {
+			indent = yamlIndent(s.lines[start])
+		}
+	}
+	if indent < 0 {
+		return yamlValue{}, false, nil
+	}
+
+	element := path[0]
+	item := 0
+
+	for i := start - 1; i < end; i++ {
+		line := s.lines[i]
+		if yamlIndent(line) != indent {
+			continue
+		}
+		content := line[indent:]
+
+		if !element.IsKey {
+			// sequence item
+			if content != "-" && !strings.HasPrefix(content, "- ") {
+				continue
+			}
+
+			itemEnd := s.blockEnd(i+1, indent, false)
+			if item != element.Index {
+				item++
+				i = itemEnd - 1
+				continue
+			}
+
+			if len(path) > 1 {
+				// item is a block, the dash is indentation of its first line
+				block := &yamlScanner{lines: append([]string{}, s.lines...)}
+				block.lines[i] = line[:indent] + " " + line[indent+1:]
+				return block.find(i, itemEnd, path[1:])
+			}
+
+			if _, _, isKey := yamlKey(strings.TrimLeft(content[1:], " ")); isKey {
+				return yamlValue{}, false, errors.New("value at --yaml-path is no scalar")
+			}
+			return s.scalar(i, indent+1, itemEnd)
+		}
+
+		key, valueStart, ok := yamlKey(content)
+		if !ok {
+			continue
+		}
+
+		childEnd := s.blockEnd(i+1, indent, true)
+		if key != element.Key {
+			i = childEnd - 1
+			continue
+		}
+
+		if len(path) > 1 {
+			return s.find(i+1, childEnd, path[1:])
+		}
+
+		return s.scalar(i, indent+valueStart, childEnd)
+	}
+
+	return yamlValue{}, false, nil
+}
+
+// Scalar value starting at position start of line, the value ends before
+// a comment or at the end of the line. An empty value is only a scalar (null)
+// if the block of the value (line to end) has no content.
+func (s *yamlScanner) scalar(line int, start int, end int) (yamlValue, bool, error) {
+	text := s.lines[line]
+	for start < len(text) && text[start] == ' ' {
+		start++
+	}
+
+	valueEnd := len(text)
+	if start < len(text) && (text[start] == '"' || text[start] == '\'') {
+		// quoted value
+		if valueEnd = yamlClosingQuote(text, start); valueEnd < 0 {
+			return yamlValue{}, false, errors.New("value at --yaml-path is an unterminated string")
+		}
+	} else {
+		if comment := strings.Index(text[start:], " #"); comment >= 0 {
+			valueEnd = start + comment
+		} else if strings.HasPrefix(text[start:], "#") {
+			valueEnd = start
+		}
+		valueEnd = start + len(strings.TrimRight(text[start:valueEnd], " \t"))
+	}
+
+	value := text[start:valueEnd]
+	if value == "" {
+		for i := line + 1; i < end; i++ {
+			if yamlIndent(s.lines[i]) >= 0 {
+				return yamlValue{}, false, errors.New("value at --yaml-path is no scalar")
+			}
+		}
+	} else if strings.IndexByte("[{|>", value[0]) >= 0 {
+		return yamlValue{}, false, errors.New("value at --yaml-path is no scalar")
+	}
+
+	return yamlValue{line, start, valueEnd}, true, nil
+}
+
+// Key of a mapping line (key: value) and position of its value,
+// ok is false if content is no key
+func yamlKey(content string) (string, int, bool) {
+	if content[0] == '"' || content[0] == '\'' {
+		end := yamlClosingQuote(content, 0)
+		if end < 0 || !strings.HasPrefix(content[end:], ":") {
+			return "", 0, false
+		}
+
+		key := content[1 : end-1]
+		if content[0] == '"' {
+			unquoted, err := strconv.Unquote(content[:end])
+			if err != nil {
+				return "", 0, false
+			}
+			key = unquoted
+		} else {
+			key = strings.Replace(key, "''", "'", -1)
+		}
+		return key, end + 1, true
+	}
+
+	if strings.HasPrefix(content, "- ") || content == "-" {
+		return "", 0, false
+	}
+
+	for i := 0; i < len(content); i++ {
+		if content[i] == ':' && (i+1 == len(content) || content[i+1] == ' ') {
+			return strings.TrimRight(content[:i], " "), i + 1, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// Position after the quote closing the quote at position start, -1 if it isn't closed
+func yamlClosingQuote(text string, start int) int {
+	quote := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			// escaped single quote ('')
+			i++
+		case text[i] == quote:
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// YAML scalar of the replace term, quoted like the original value,
+// plain values are quoted if they aren't a valid plain scalar
+func yamlReplaceValue(original string, replace string) string {
+	switch {
+	case strings.HasPrefix(original, "'"):
+		return "'" + strings.Replace(replace, "'", "''", -1) + "'"
+	case strings.HasPrefix(original, `"`) || !isYAMLPlainScalar(replace):
+		value, _ := json.Marshal(replace)
+		return string(value)
+	}
+
+	return replace
+}
+
+// Checks if value can be written as plain scalar without changing its meaning
+func isYAMLPlainScalar(value string) bool {
+	if value == "" || strings.TrimSpace(value) != value || strings.IndexByte(yamlIndicators, value[0]) >= 0 {
+		return false
+	}
+
+	return !strings.Contains(value, ": ") && !strings.Contains(value, " #") && !strings.ContainsAny(value, "\r\n\t")
+}
+
+// Replace scalar value at --yaml-path in YAML content, comments and formatting are kept
+// Returns the new content and if the path was found
+func replaceYAMLValue(content []byte, path []jsonPathElement, replace string) ([]byte, bool, error) {
+	lines := strings.Split(string(content), "\n")
+
+	// line endings are restored when joining the lines
+	scanner := &yamlScanner{lines: make([]string, len(lines))}
+	for i, line := range lines {
+		scanner.lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	value, found, err := scanner.find(0, len(lines), path)
+	if err != nil || !found {
+		return content, false, err
+	}
+
+	line := lines[value.Line]
+	scalar := yamlReplaceValue(line[value.Start:value.End], replace)
+
+	// empty value (null) is separated from the key
+	if value.Start == value.End && (value.Start == 0 || line[value.Start-1] != ' ') {
+		scalar = " " + scalar
+	}
+	lines[value.Line] = line[:value.Start] + scalar + line[value.End:]
+
+	return []byte(strings.Join(lines, "\n")), true, nil
+}
+
+// Replace value at --yaml-path in file (--mode=yaml)
+func (r *Replacer) applyYAMLToFile(fileitem FileItem, changesets []Changeset) ChangeResult {
+	content, err := r.readFile(fileitem.Path)
+	if err != nil {
+		return ChangeResult{File: fileitem, Error: err}
+	}
+
+	changeset := changesets[0]
+	replaced, found, err := replaceYAMLValue(content, r.opts.yamlPath, changeset.Replace)
+	if err != nil {
+		return ChangeResult{File: fileitem, Error: fmt.Errorf("%s: %s", fileitem.Path, err)}
+	} else if !found {
+		return ChangeResult{File: fileitem, Output: fmt.Sprintf("%s no match", fileitem.Path)}
+	}
+
+	result := ChangeResult{File: fileitem, Matched: true, Searches: []string{changeset.SearchPlain}}
+	if bytes.Equal(replaced, content) && fileitem.Output == fileitem.Path && !r.opts.ForceWrite {
+		result.Output = fmt.Sprintf("%s not changed, replacements are identical", fileitem.Path)
+		return result
+	}
+
+	result.Replacements = 1
+	result.Changes = []ChangeCount{{changeset.SearchPlain, changeset.Replace, 1}}
+
+	var buffer bytes.Buffer
+	buffer.Write(replaced)
+	result.Output, result.Error = r.writeContentToFile(fileitem, buffer)
+	result.Changed = result.Error == nil
+
+	return result
+}
+
+// Replace value at --yaml-path in the YAML document read from in (--mode=yaml),
+// the document is written unchanged if the path doesn't exist
+func (r *Replacer) applyYAMLToReader(in io.Reader, out io.Writer, name string, changesets []Changeset) error {
+	content, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	replaced, _, err := replaceYAMLValue(content, r.opts.yamlPath, changesets[0].Replace)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	_, err = out.Write(replaced)
+	return err
+}
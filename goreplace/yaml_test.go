@@ -0,0 +1,98 @@
+package goreplace
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReplaceYAMLValue(t *testing.T) {
+	content := `# deployment
+name: app
+spec:
+  # number of pods
+  replicas: 1 # keep low
+  image: "nginx:1.0"
+  labels: {tier: web}
+  steps:
+    - checkout
+    - name: build
+      run: make
+  # trailing comment
+debug:
+tag: 'v1'
+`
+
+	tests := []struct {
+		path     string
+		value    string
+		expected string
+		found    bool
+	}{
+		{".spec.replicas", "3", strings.Replace(content, "replicas: 1 # keep low", "replicas: 3 # keep low", 1), true},
+		{".spec.image", "nginx:2.0", strings.Replace(content, `"nginx:1.0"`, `"nginx:2.0"`, 1), true},
+		{".spec.steps[0]", "clone", strings.Replace(content, "- checkout", "- clone", 1), true},
+		{".spec.steps[1].run", "make test", strings.Replace(content, "run: make", "run: make test", 1), true},
+		{".name", "a: b", strings.Replace(content, "name: app", `name: "a: b"`, 1), true},
+		{".debug", "true", strings.Replace(content, "debug:\n", "debug: true\n", 1), true},
+		{".tag", "it's", strings.Replace(content, "'v1'", "'it''s'", 1), true},
+		{".spec.missing", "x", content, false},
+		{".spec.steps[2]", "x", content, false},
+		{".replicas", "x", content, false},
+	}
+
+	for _, test := range tests {
+		path, err := parseJSONPath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		replaced, found, err := replaceYAMLValue([]byte(content), path, test.value)
+		if err != nil {
+			t.Fatalf("%s: %s", test.path, err)
+		}
+		if found != test.found {
+			t.Errorf("%s: expected found=%v, got %v", test.path, test.found, found)
+		}
+		if string(replaced) != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.path, test.expected, replaced)
+		}
+	}
+
+	for _, path := range []string{".spec", ".spec.labels", ".spec.steps", ".spec.steps[1]"} {
+		elements, err := parseJSONPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := replaceYAMLValue([]byte(content), elements, "x"); err == nil {
+			t.Errorf("%s: expected error for value which is no scalar", path)
+		}
+	}
+}
+
+func TestApplyYAMLToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goreplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "config.yaml", "server:\r\n  # public host\r\n  host: localhost\r\n  port: 80 # http\r\n")
+
+	r, changesets := newTestReplacer(t, Options{
+		Mode:     "yaml",
+		YAMLPath: ".server.host",
+		Replace:  []string{"example.com"},
+	})
+
+	if result := r.processFile(FileItem{path, path}, changesets); result.Error != nil || !result.Changed {
+		t.Fatalf("expected file to be changed, got %v", result.Error)
+	}
+
+	expected := "server:\r\n  # public host\r\n  host: example.com\r\n  port: 80 # http\r\n"
+	if content := readTestFile(t, path); content != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
@@ -3,14 +3,16 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	flags "github.com/jessevdk/go-flags"
-	"github.com/remeh/sizedwaitgroup"
-	"io/ioutil"
+	"github.com/webdevops/go-replace/goreplace"
 	"os"
-	"regexp"
+	"os/signal"
+	"sort"
 	"strings"
+	"time"
 )
 
 const (
@@ -18,297 +20,94 @@ const (
 	Version = "1.1.2"
 )
 
-type changeset struct {
-	SearchPlain string
-	Search      *regexp.Regexp
-	Replace     string
-	MatchFound  bool
-}
-
-type changeresult struct {
-	File   fileitem
-	Output string
-	Status bool
-	Error  error
-}
-
-type fileitem struct {
-	Path   string
-	Output string
-}
+// exit codes
+const (
+	ExitCodeOk          = 0   // files changed or nothing to do
+	ExitCodeUsageError  = 1   // invalid options or arguments
+	ExitCodeNoMatch     = 2   // no search term matched (with --fail-on-no-match) or one didn't match (with --require-match)
+	ExitCodeFileError   = 3   // one or more files could not be processed
+	ExitCodeCheckFailed = 4   // search term found (with --check)
+	ExitCodeInterrupted = 130 // processing was interrupted by SIGINT
+)
 
 var opts struct {
-	ThreadCount        int    `           long:"threads"                       description:"Set thread concurrency for replacing in multiple files at same time" default:"20"`
-	Mode               string `short:"m"  long:"mode"                          description:"replacement mode - replace: replace match with term; line: replace line with term; lineinfile: replace line with term or if not found append to term to file; template: parse content as golang template, search value have to start uppercase" default:"replace" choice:"replace" choice:"line" choice:"lineinfile" choice:"template"`
-	ModeIsReplaceMatch bool
-	ModeIsReplaceLine  bool
-	ModeIsLineInFile   bool
-	ModeIsTemplate     bool
-	Search             []string `short:"s"  long:"search"                        description:"search term"`
-	Replace            []string `short:"r"  long:"replace"                       description:"replacement term"`
-	LineinfileBefore   string   `           long:"lineinfile-before"             description:"add line before this regex"`
-	LineinfileAfter    string   `           long:"lineinfile-after"              description:"add line after this regex"`
-	CaseInsensitive    bool     `short:"i"  long:"case-insensitive"              description:"ignore case of pattern to match upper and lowercase characters"`
-	Stdin              bool     `           long:"stdin"                         description:"process stdin as input"`
-	Output             string   `short:"o"  long:"output"                        description:"write changes to this file (in one file mode)"`
-	OutputStripFileExt string   `           long:"output-strip-ext"              description:"strip file extension from written files (also available in multi file mode)"`
-	Once               string   `           long:"once"                          description:"replace search term only one in a file, keep duplicaes (keep, default) or remove them (unique)" optional:"true" optional-value:"keep" choice:"keep" choice:"unique"`
-	Regex              bool     `           long:"regex"                         description:"treat pattern as regex"`
-	RegexBackref       bool     `           long:"regex-backrefs"                description:"enable backreferences in replace term"`
-	RegexPosix         bool     `           long:"regex-posix"                   description:"parse regex term as POSIX regex"`
-	Path               string   `           long:"path"                          description:"use files in this path"`
-	PathPattern        string   `           long:"path-pattern"                  description:"file pattern (* for wildcard, only basename of file)"`
-	PathRegex          string   `           long:"path-regex"                    description:"file pattern (regex, full path)"`
-	IgnoreEmpty        bool     `           long:"ignore-empty"                  description:"ignore empty file list, otherwise this will result in an error"`
-	Verbose            bool     `short:"v"  long:"verbose"                       description:"verbose mode"`
-	DryRun             bool     `           long:"dry-run"                       description:"dry run mode"`
-	ShowVersion        bool     `short:"V"  long:"version"                       description:"show version and exit"`
-	ShowOnlyVersion    bool     `           long:"dumpversion"                   description:"show only version number and exit"`
-	ShowHelp           bool     `short:"h"  long:"help"                          description:"show this help message"`
-}
-
-var pathFilterDirectories = []string{"autom4te.cache", "blib", "_build", ".bzr", ".cdv", "cover_db", "CVS", "_darcs", "~.dep", "~.dot", ".git", ".hg", "~.nib", ".pc", "~.plst", "RCS", "SCCS", "_sgbak", ".svn", "_obj", ".idea"}
-
-// Apply changesets to file
-func applyChangesetsToFile(fileitem fileitem, changesets []changeset) (string, bool, error) {
-	var (
-		err    error  = nil
-		output string = ""
-		status bool   = true
-	)
-
-	// try open file
-	file, err := os.Open(fileitem.Path)
-	if err != nil {
-		return output, false, err
-	}
-
-	writeBufferToFile := false
-	var buffer bytes.Buffer
-
-	r := bufio.NewReader(file)
-	line, e := Readln(r)
-	for e == nil {
-		newLine, lineChanged, skipLine := applyChangesetsToLine(line, changesets)
-
-		if lineChanged || skipLine {
-			writeBufferToFile = true
-		}
-
-		if !skipLine {
-			buffer.WriteString(newLine + "\n")
-		}
-
-		line, e = Readln(r)
-	}
-	file.Close()
-
-	// --mode=lineinfile
-	if opts.ModeIsLineInFile {
-		lifBuffer, lifStatus := handleLineInFile(changesets, buffer)
-		if lifStatus {
-			buffer.Reset()
-			buffer.WriteString(lifBuffer.String())
-			writeBufferToFile = lifStatus
-		}
-	}
-
-	// --output
-	// --output-strip-ext
-	// enforcing writing of file (creating new file)
-	if opts.Output != "" || opts.OutputStripFileExt != "" {
-		writeBufferToFile = true
-	}
-
-	if writeBufferToFile {
-		output, status = writeContentToFile(fileitem, buffer)
-	} else {
-		output = fmt.Sprintf("%s no match", fileitem.Path)
-	}
-
-	return output, status, err
-}
-
-// Apply changesets to file
-func applyTemplateToFile(fileitem fileitem, changesets []changeset) (string, bool, error) {
-	var (
-		err    error  = nil
-		output string = ""
-		status bool   = true
-	)
-
-	// try open file
-	buffer, err := ioutil.ReadFile(fileitem.Path)
-	if err != nil {
-		return output, false, err
-	}
-
-	content := parseContentAsTemplate(string(buffer), changesets)
-
-	output, status = writeContentToFile(fileitem, content)
-
-	return output, status, err
-}
-
-func applyChangesetsToLine(line string, changesets []changeset) (string, bool, bool) {
-	changed := false
-	skipLine := false
-
-	for i, changeset := range changesets {
-		// --once, only do changeset once if already applied to file
-		if opts.Once != "" && changeset.MatchFound {
-			// --once=unique, skip matching lines
-			if opts.Once == "unique" && searchMatch(line, changeset) {
-				// matching line, not writing to buffer as requsted
-				skipLine = true
-				changed = true
-				break
-			}
-		} else {
-			// search and replace
-			if searchMatch(line, changeset) {
-				// --mode=line or --mode=lineinfile
-				if opts.ModeIsReplaceLine || opts.ModeIsLineInFile {
-					if opts.RegexBackref {
-						// get match
-						line = string(changeset.Search.Find([]byte(line)))
-
-						// replace regex backrefs in match
-						line = changeset.Search.ReplaceAllString(line, changeset.Replace)
-					} else {
-						// replace whole line with replace term
-						line = changeset.Replace
-					}
-				} else {
-					// replace only term inside line
-					line = replaceText(line, changeset)
-				}
-
-				changesets[i].MatchFound = true
-				changed = true
-			}
-		}
-	}
-
-	return line, changed, skipLine
-}
-
-// Build search term
-// Compiles regexp if regexp is used
-func buildSearchTerm(term string) *regexp.Regexp {
-	var ret *regexp.Regexp
-	var regex string
-
-	// --regex
-	if opts.Regex {
-		// use search term as regex
-		regex = term
-	} else {
-		// use search term as normal string, escape it for regex usage
-		regex = regexp.QuoteMeta(term)
-	}
-
-	// --ignore-case
-	if opts.CaseInsensitive {
-		regex = "(?i:" + regex + ")"
-	}
-
-	// --verbose
-	if opts.Verbose {
-		logMessage(fmt.Sprintf("Using regular expression: %s", regex))
-	}
-
-	// --regex-posix
-	if opts.RegexPosix {
-		ret = regexp.MustCompilePOSIX(regex)
-	} else {
-		ret = regexp.MustCompile(regex)
-	}
-
-	return ret
+	goreplace.Options
+	Stdin           bool   `           long:"stdin"                         description:"process stdin as input"`
+	StdinFilename   string `           long:"stdin-filename"                description:"file name used for stdin in output and templates" default:"<stdin>"`
+	IgnoreEmpty     bool   `           long:"ignore-empty"                  description:"ignore empty file list, otherwise this will result in an error"`
+	ReportUnchanged bool   `           long:"report-unchanged"              description:"list files without changes on stderr after processing"`
+	FailOnNoMatch   bool   `           long:"fail-on-no-match"              description:"exit with code 2 if no search term matched in any file"`
+	RequireMatch    bool   `           long:"require-match"                 description:"exit with code 2 and list the search terms which didn't match in any file"`
+	SummaryJSON     string `           long:"summary-json"                  description:"write totals and a per file breakdown as JSON document to this file after processing"`
+	AuditLog        string `           long:"audit-log"                     description:"append a line \"timestamp path search->replace count\" for each replaced search term of changed files to this file"`
+	Timing          int    `           long:"timing"                        description:"report duration of searching and processing files and the N slowest files on stderr" optional:"true" optional-value:"10"`
+	GroupByDir      bool   `           long:"group-by-dir"                  description:"report changed files and replacements grouped by directory on stderr after processing"`
+	Benchmark       bool   `           long:"benchmark"                     description:"report processing throughput (files/sec, MB/sec) on stderr, use --dry-run to keep files unchanged"`
+	OutputFormat    string `           long:"output-format"                 description:"output format of the results (jsonl: one JSON object per file as soon as it is processed; sarif: matches of --check or --locations as SARIF document)" choice:"text" choice:"jsonl" choice:"sarif" default:"text"`
+	ShowVersion     bool   `short:"V"  long:"version"                       description:"show version and exit"`
+	ShowOnlyVersion bool   `           long:"dumpversion"                   description:"show only version number and exit"`
+	ShowHelp        bool   `short:"h"  long:"help"                          description:"show this help message"`
 }
 
 // handle special cli options
 // eg. --help
 //     --version
-//     --path
-//     --mode=...
-func handleSpecialCliOptions(args []string) {
+func handleSpecialCliOptions() {
 	// --dumpversion
 	if opts.ShowOnlyVersion {
 		fmt.Println(Version)
-		os.Exit(0)
+		os.Exit(ExitCodeOk)
 	}
 
 	// --version
 	if opts.ShowVersion {
 		fmt.Println(fmt.Sprintf("go-replace version %s", Version))
 		fmt.Println(fmt.Sprintf("Copyright (C) 2017 %s", Author))
-		os.Exit(0)
+		os.Exit(ExitCodeOk)
 	}
 
 	// --help
 	if opts.ShowHelp {
 		argparser.WriteHelp(os.Stdout)
-		os.Exit(1)
-	}
-
-	// --mode
-	switch mode := opts.Mode; mode {
-	case "replace":
-		opts.ModeIsReplaceMatch = true
-		opts.ModeIsReplaceLine = false
-		opts.ModeIsLineInFile = false
-		opts.ModeIsTemplate = false
-	case "line":
-		opts.ModeIsReplaceMatch = false
-		opts.ModeIsReplaceLine = true
-		opts.ModeIsLineInFile = false
-		opts.ModeIsTemplate = false
-	case "lineinfile":
-		opts.ModeIsReplaceMatch = false
-		opts.ModeIsReplaceLine = false
-		opts.ModeIsLineInFile = true
-		opts.ModeIsTemplate = false
-	case "template":
-		opts.ModeIsReplaceMatch = false
-		opts.ModeIsReplaceLine = false
-		opts.ModeIsLineInFile = false
-		opts.ModeIsTemplate = true
-	}
-
-	// --output
-	if opts.Output != "" && len(args) > 1 {
-		logFatalErrorAndExit(errors.New("Only one file is allowed when using --output"), 1)
-	}
-
-	if opts.LineinfileBefore != "" || opts.LineinfileAfter != "" {
-		if !opts.ModeIsLineInFile {
-			logFatalErrorAndExit(errors.New("--lineinfile-after and --lineinfile-before only valid in --mode=lineinfile"), 1)
-		}
-
-		if opts.LineinfileBefore != "" && opts.LineinfileAfter != "" {
-			logFatalErrorAndExit(errors.New("Only --lineinfile-after or --lineinfile-before is allowed in --mode=lineinfile"), 1)
-		}
+		os.Exit(ExitCodeUsageError)
 	}
 }
 
-func actionProcessStdinReplace(changesets []changeset) int {
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		line := scanner.Text()
+func actionProcessStdinReplace(changesets []goreplace.Changeset) int {
+	if err := replacer.ApplyChangesetsToReader(os.Stdin, os.Stdout, opts.StdinFilename, changesets); err != nil {
+		logError(err)
+		return ExitCodeFileError
+	}
+
+	return ExitCodeOk
+}
 
-		newLine, _, skipLine := applyChangesetsToLine(line, changesets)
+// Search stdin without writing it (--check, --locations, --files-with-matches)
+func actionProcessStdinCheck(changesets []goreplace.Changeset) int {
+	output, matched, err := replacer.CheckReader(os.Stdin, opts.StdinFilename, changesets)
+	if err != nil {
+		logError(err)
+		return ExitCodeFileError
+	}
 
-		if !skipLine {
-			fmt.Println(newLine)
+	if matched {
+		if opts.FilesWithMatches {
+			fmt.Println(opts.StdinFilename)
+		} else {
+			fmt.Println(output)
 		}
 	}
 
-	return 0
+	// --check
+	if opts.Check && matched {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("[CHECK] %s found search terms in %s", argparser.Command.Name, opts.StdinFilename))
+		return ExitCodeCheckFailed
+	}
+
+	return ExitCodeOk
 }
 
-func actionProcessStdinTemplate(changesets []changeset) int {
+func actionProcessStdinTemplate(changesets []goreplace.Changeset) int {
 	var buffer bytes.Buffer
 
 	scanner := bufio.NewScanner(os.Stdin)
@@ -316,59 +115,99 @@ func actionProcessStdinTemplate(changesets []changeset) int {
 		buffer.WriteString(scanner.Text() + "\n")
 	}
 
-	content := parseContentAsTemplate(buffer.String(), changesets)
+	content, err := replacer.ParseContentAsTemplate(buffer.String(), changesets)
+	if err != nil {
+		logFatalErrorAndExit(err, ExitCodeUsageError)
+	}
 	fmt.Print(content.String())
 
-	return 0
+	return ExitCodeOk
 }
 
-func actionProcessFiles(changesets []changeset, fileitems []fileitem) int {
+func actionProcessFiles(ctx context.Context, changesets []goreplace.Changeset, fileitems []goreplace.FileItem) int {
 	// check if there is at least one file to process
 	if len(fileitems) == 0 {
 		if opts.IgnoreEmpty {
 			// no files found, but we should ignore empty filelist
 			logMessage("No files found, requsted to ignore this")
-			os.Exit(0)
+			os.Exit(ExitCodeOk)
 		} else {
 			// no files found, print error and exit with error code
-			logFatalErrorAndExit(errors.New("No files specified"), 1)
+			logFatalErrorAndExit(errors.New("No files specified"), ExitCodeUsageError)
 		}
 	}
 
-	swg := sizedwaitgroup.New(8)
-	results := make(chan changeresult, len(fileitems))
+	// --output-format=jsonl
+	// results are streamed to stdout while files are processed
+	if opts.OutputFormat == "jsonl" {
+		replacer.OnResult = goreplace.JSONLWriter(os.Stdout)
+	}
 
-	// process file list
-	for _, file := range fileitems {
-		swg.Add()
-		go func(file fileitem, changesets []changeset) {
-			var (
-				err    error  = nil
-				output string = ""
-				status bool   = true
-			)
+	// --audit-log
+	if opts.AuditLog != "" {
+		auditLog, err := goreplace.OpenAuditLog(opts.AuditLog)
+		if err != nil {
+			logFatalErrorAndExit(err, ExitCodeFileError)
+		}
+		defer auditLog.Close()
+		replacer.AuditLog = auditLog
+	}
 
-			if opts.ModeIsTemplate {
-				output, status, err = applyTemplateToFile(file, changesets)
-			} else {
-				output, status, err = applyChangesetsToFile(file, changesets)
-			}
+	// --benchmark, size is taken before files are changed
+	var size int64
+	if opts.Benchmark {
+		size = replacer.FileitemsSize(fileitems)
+	}
 
-			results <- changeresult{file, output, status, err}
-			swg.Done()
-		}(file, changesets)
+	processingStart := time.Now()
+	var (
+		results []goreplace.ChangeResult
+		err     error
+	)
+	if opts.Sample > 0 {
+		// --sample, only the first changed lines are needed
+		results, err = replacer.SampleFiles(ctx, changesets, fileitems, opts.Sample)
+	} else {
+		results, err = replacer.ProcessFiles(ctx, changesets, fileitems)
 	}
 
-	// wait for all changes to be processed
-	swg.Wait()
-	close(results)
+	processingDuration := time.Since(processingStart)
+
+	// --timing
+	if opts.Timing > 0 {
+		goreplace.WriteTimingReport(os.Stderr, walkDuration, processingDuration, results, opts.Timing)
+	}
+
+	// --benchmark
+	if opts.Benchmark {
+		goreplace.WriteBenchmarkReport(os.Stderr, processingDuration, len(results), size)
+	}
 
 	// show results
 	errorCount := 0
-	for result := range results {
+	for _, result := range results {
 		if result.Error != nil {
 			logError(result.Error)
 			errorCount++
+		} else if opts.OutputFormat == "jsonl" {
+			// already written while processing
+		} else if opts.OutputFormat == "sarif" {
+			// written as one document after processing
+		} else if opts.Check || opts.Locations || opts.FilesWithMatches {
+			// --check, --locations, --files-with-matches
+			if result.Matched {
+				fmt.Println(result.Output)
+			}
+		} else if opts.Diff {
+			// --diff
+			if result.Changed {
+				fmt.Print(result.Output)
+			}
+		} else if opts.Preview || opts.Sample > 0 {
+			// --preview, --sample
+			if result.Changed {
+				fmt.Println(result.Output)
+			}
 		} else if opts.Verbose {
 			title := fmt.Sprintf("%s:", result.File.Path)
 
@@ -381,116 +220,216 @@ func actionProcessFiles(changesets []changeset, fileitems []fileitem) int {
 		}
 	}
 
-	if errorCount >= 1 {
-		fmt.Fprintln(os.Stderr, fmt.Sprintf("[ERROR] %s failed with %d error(s)", argparser.Command.Name, errorCount))
-		return 1
+	// --output-format=sarif
+	if opts.OutputFormat == "sarif" {
+		if sarifErr := goreplace.WriteSARIF(os.Stdout, Version, results); sarifErr != nil {
+			logError(sarifErr)
+			errorCount++
+		}
 	}
 
-	return 0
-}
+	// --patch-file
+	if opts.PatchFile != "" {
+		if patchErr := replacer.WritePatchFile(); patchErr != nil {
+			logError(patchErr)
+			errorCount++
+		}
+	}
 
-func buildChangesets() []changeset {
-	var changesets []changeset
+	// --report-unchanged
+	if opts.ReportUnchanged {
+		reportUnchangedFiles(results)
+	}
 
-	if !opts.ModeIsTemplate {
-		if len(opts.Search) == 0 || len(opts.Replace) == 0 {
-			// error: unequal numbers of search and replace options
-			logFatalErrorAndExit(errors.New("Missing either --search or --replace for this mode"), 1)
+	// --group-by-dir
+	if opts.GroupByDir {
+		goreplace.WriteDirectoryReport(os.Stderr, results)
+	}
+
+	// --summary-json
+	if opts.SummaryJSON != "" {
+		if summaryErr := goreplace.WriteSummaryJSON(opts.SummaryJSON, results); summaryErr != nil {
+			logError(summaryErr)
+			errorCount++
 		}
 	}
 
-	// check if search and replace options have equal lenght (equal number of options)
-	if len(opts.Search) != len(opts.Replace) {
-		// error: unequal numbers of search and replace options
-		logFatalErrorAndExit(errors.New("Unequal numbers of search or replace options"), 1)
+	// interrupted, show which files were completed
+	if err == context.Canceled {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("[INTERRUPTED] %s processed %d of %d file(s):", argparser.Command.Name, len(results), len(fileitems)))
+		for _, result := range results {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("  %s", result.File.Path))
+		}
+		return ExitCodeInterrupted
+	} else if err != nil {
+		logError(err)
+		return ExitCodeFileError
 	}
 
-	// build changesets
-	for i := range opts.Search {
-		search := opts.Search[i]
-		replace := opts.Replace[i]
+	if errorCount >= 1 {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("[ERROR] %s failed with %d error(s)", argparser.Command.Name, errorCount))
+		return ExitCodeFileError
+	}
 
-		changeset := changeset{search, buildSearchTerm(search), replace, false}
-		changesets = append(changesets, changeset)
+	// --require-match
+	// before --check, otherwise unmatched search terms are never listed
+	if opts.RequireMatch {
+		if unmatched := goreplace.UnmatchedSearches(changesets, results); len(unmatched) > 0 {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("[NO MATCH] %s found no match for %d search term(s):", argparser.Command.Name, len(unmatched)))
+			for _, search := range unmatched {
+				fmt.Fprintln(os.Stderr, fmt.Sprintf("  %s", search))
+			}
+			return ExitCodeNoMatch
+		}
 	}
 
-	return changesets
-}
+	// --check
+	if opts.Check && resultsMatched(results) {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("[CHECK] %s found search terms in %d file(s)", argparser.Command.Name, countMatchedResults(results)))
+		return ExitCodeCheckFailed
+	}
 
-func buildFileitems(args []string) []fileitem {
-	var (
-		fileitems []fileitem
-		file      fileitem
-	)
+	// --fail-on-no-match
+	if opts.FailOnNoMatch && !resultsMatched(results) {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("[NO MATCH] %s found no match in %d file(s)", argparser.Command.Name, len(results)))
+		return ExitCodeNoMatch
+	}
+
+	return ExitCodeOk
+}
 
-	// Build filelist from arguments
-	for _, filepath := range args {
-		file = fileitem{filepath, filepath}
-
-		if opts.Output != "" {
-			// use specific output
-			file.Output = opts.Output
-		} else if opts.OutputStripFileExt != "" {
-			// remove file ext from saving destination
-			file.Output = strings.TrimSuffix(file.Output, opts.OutputStripFileExt)
-		} else if strings.Contains(filepath, ":") {
-			// argument like "source:destination"
-			split := strings.SplitN(filepath, ":", 2)
-
-			file.Path = split[0]
-			file.Output = split[1]
+// Process changed files again until interrupted (--watch)
+func actionWatch(ctx context.Context, changesets []goreplace.Changeset) int {
+	// --output-format=jsonl keeps streaming the results
+	if opts.OutputFormat != "jsonl" {
+		replacer.OnResult = func(result goreplace.ChangeResult) {
+			if result.Error != nil {
+				logError(result.Error)
+			} else if result.Changed {
+				fmt.Fprintln(os.Stderr, strings.TrimSpace(result.Output))
+			}
 		}
+	}
 
-		fileitems = append(fileitems, file)
+	logMessage(fmt.Sprintf("Watching %s for changes", opts.Path))
+	if err := replacer.Watch(ctx, changesets, nil); err != nil {
+		logError(err)
+		return ExitCodeFileError
 	}
 
-	// --path parsing
-	if opts.Path != "" {
-		searchFilesInPath(opts.Path, func(f os.FileInfo, filepath string) {
-			file := fileitem{filepath, filepath}
+	return ExitCodeInterrupted
+}
 
-			if opts.OutputStripFileExt != "" {
-				// remove file ext from saving destination
-				file.Output = strings.TrimSuffix(file.Output, opts.OutputStripFileExt)
-			}
+// Checks if a search term matched in any processed file
+func resultsMatched(results []goreplace.ChangeResult) bool {
+	return countMatchedResults(results) > 0
+}
 
-			// no colon parsing here
+// Number of processed files with matching search terms
+func countMatchedResults(results []goreplace.ChangeResult) int {
+	count := 0
+	for _, result := range results {
+		if result.Matched {
+			count++
+		}
+	}
+
+	return count
+}
 
-			fileitems = append(fileitems, file)
-		})
+// List files which were processed without error but not changed
+func reportUnchangedFiles(results []goreplace.ChangeResult) {
+	var unchanged []string
+	for _, result := range results {
+		if result.Error == nil && !result.Changed {
+			unchanged = append(unchanged, result.File.Path)
+		}
 	}
+	sort.Strings(unchanged)
 
-	return fileitems
+	fmt.Fprintln(os.Stderr, fmt.Sprintf("Unchanged files (%d):", len(unchanged)))
+	for _, path := range unchanged {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("  %s", path))
+	}
 }
 
-var argparser *flags.Parser
+var (
+	argparser    *flags.Parser
+	replacer     *goreplace.Replacer
+	walkDuration time.Duration // searching files (--timing)
+)
 
 func main() {
 	argparser = flags.NewParser(&opts, flags.PassDoubleDash)
 	args, err := argparser.Parse()
 
-	handleSpecialCliOptions(args)
+	handleSpecialCliOptions()
 
 	// check if there is an parse error
 	if err != nil {
-		logFatalErrorAndExit(err, 1)
+		logFatalErrorAndExit(err, ExitCodeUsageError)
+	}
+
+	// --output-format=sarif
+	if opts.OutputFormat == "sarif" && ((!opts.Check && !opts.Locations) || opts.Stdin || opts.Watch) {
+		logFatalErrorAndExit(errors.New("--output-format=sarif requires --check or --locations and can't be used together with --stdin or --watch"), ExitCodeUsageError)
+	}
+
+	// --require-match
+	if opts.RequireMatch && (opts.Concat || opts.Sample > 0 || opts.FilesWithMatches || opts.Mode == "template" || opts.Stdin || opts.Watch) {
+		logFatalErrorAndExit(errors.New("--require-match can't be used together with --concat, --sample, --files-with-matches, --mode=template, --stdin or --watch"), ExitCodeUsageError)
+	}
+
+	// stop dispatching new files on SIGINT, files in progress are finished
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	replacer, err = goreplace.NewReplacer(opts.Options)
+	if err != nil {
+		logFatalErrorAndExit(err, ExitCodeUsageError)
 	}
 
-	changesets := buildChangesets()
-	fileitems := buildFileitems(args)
+	changesets, err := replacer.BuildChangesets()
+	if err != nil {
+		logFatalErrorAndExit(err, ExitCodeUsageError)
+	}
+
+	walkStart := time.Now()
+	fileitems, err := replacer.BuildFileitems(ctx, args)
+	walkDuration = time.Since(walkStart)
+	if err == context.Canceled {
+		logFatalErrorAndExit(errors.New("Interrupted while searching files"), ExitCodeInterrupted)
+	} else if err != nil {
+		logFatalErrorAndExit(err, ExitCodeUsageError)
+	}
 
 	exitMode := 0
 	if opts.Stdin {
-		if opts.ModeIsTemplate {
+		if replacer.Options().ModeIsTemplate {
 			// use stdin as input
 			exitMode = actionProcessStdinTemplate(changesets)
+		} else if opts.Check || opts.Locations || opts.FilesWithMatches {
+			// --check, --locations, --files-with-matches, stdin is only searched
+			exitMode = actionProcessStdinCheck(changesets)
 		} else {
 			// use stdin as input
 			exitMode = actionProcessStdinReplace(changesets)
 		}
 	} else {
 		// use and process files (see args)
-		exitMode = actionProcessFiles(changesets, fileitems)
+		exitMode = actionProcessFiles(ctx, changesets, fileitems)
+
+		// --watch
+		if opts.Watch && exitMode != ExitCodeInterrupted {
+			exitMode = actionWatch(ctx, changesets)
+		}
 	}
 
 	os.Exit(exitMode)